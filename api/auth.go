@@ -0,0 +1,31 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin allows a request through only if it carries the admin token as a bearer token,
+// as in "Authorization: Bearer <token>". Requests without a token are answered with 401 and
+// requests with a wrong one with 403. Without a configured admin token every request is
+// answered with 403, which makes the API read-only.
+func (h *APIHandler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.adminToken == "" {
+			respondWithError(w, http.StatusForbidden, "Changes through the API are disabled because no admin token is configured")
+			return
+		}
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="guptime"`)
+			respondWithError(w, http.StatusUnauthorized, "A bearer token is required")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(h.adminToken)) != 1 {
+			respondWithError(w, http.StatusForbidden, "Invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
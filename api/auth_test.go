@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		want          int
+	}{
+		{"no admin token configured", "", "Bearer secret", http.StatusForbidden},
+		{"no admin token configured or sent", "", "", http.StatusForbidden},
+		{"missing", "secret", "", http.StatusUnauthorized},
+		{"other scheme", "secret", "Basic c2VjcmV0", http.StatusUnauthorized},
+		{"empty bearer", "secret", "Bearer ", http.StatusUnauthorized},
+		{"wrong", "secret", "Bearer guess", http.StatusForbidden},
+		{"prefix of the token", "secret", "Bearer secre", http.StatusForbidden},
+		{"correct", "secret", "Bearer secret", http.StatusOK},
+		{"lowercase scheme", "secret", "bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &APIHandler{adminToken: tt.adminToken}
+			handler := h.requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/monitors", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestMutatingRoutesRequireAdmin(t *testing.T) {
+	r := chi.NewRouter()
+	(&APIHandler{adminToken: "secret"}).RegisterRoutes(r)
+	routes := []struct{ method, path string }{
+		{http.MethodPost, "/monitors"},
+		{http.MethodPost, "/monitors/apply"},
+		{http.MethodPut, "/monitors/prod/api"},
+		{http.MethodPatch, "/monitors/prod/api"},
+		{http.MethodDelete, "/monitors/prod/api"},
+		{http.MethodPost, "/monitors/prod/api/pause"},
+		{http.MethodPost, "/monitors/prod/api/resume"},
+		{http.MethodPost, "/admin/reload"},
+	}
+	for _, route := range routes {
+		req := httptest.NewRequest(route.method, route.path, nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a token = %d, want %d", route.method, route.path, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
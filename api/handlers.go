@@ -2,11 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"guptime/monitor"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -17,36 +19,63 @@ import (
 type APIHandler struct {
 	monitorService *monitor.Service
 	cache          *cache.Cache
+	// adminToken authorizes the routes that change monitors. When empty, those routes are disabled.
+	adminToken string
 }
 
-// NewAPIHandler creates a new handler with necessary dependencies.
-func NewAPIHandler(service *monitor.Service) *APIHandler {
+// NewAPIHandler creates a new handler with necessary dependencies. Routes that change monitors
+// require adminToken as a bearer token, and are disabled if it is empty.
+func NewAPIHandler(service *monitor.Service, adminToken string) *APIHandler {
 	// Initialize a new in-memory cache.
 	// Cache items will expire after 60 seconds and the cache is cleaned up every 5 minutes.
 	return &APIHandler{
 		monitorService: service,
 		cache:          cache.New(60*time.Second, 5*time.Minute),
+		adminToken:     adminToken,
 	}
 }
 
 // RegisterRoutes sets up the API routes on the given chi router.
 func (h *APIHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/monitors", h.getMonitors)
+	r.Get("/dependencies", h.getDependencies)
+	r.Get("/slos", h.getSLOs)
 
 	// Slug-based endpoints
 	r.Get("/monitors/slug/{slug}", h.getMonitorsBySlug)
 	r.Get("/monitors/slug/{slug}/summary", h.getSlugSummary)
 	r.Get("/monitors/slug/{slug}/history", h.getSlugHistory) // NEW: 90 days status history
 	r.Get("/monitors/slug/{slug}/checks", h.getSlugChecks)
+	r.Get("/monitors/slug/{slug}/incidents", h.getSlugIncidents)
 
 	// Monitor endpoints now use both slug and name
 	r.Get("/monitors/{slug}/{name}/summary", h.getMonitorSummary)
 	r.Get("/monitors/{slug}/{name}/checks", h.getMonitorChecks)
+	r.Get("/monitors/{slug}/{name}/transitions", h.getMonitorTransitions)
+	r.Get("/monitors/{slug}/{name}/incidents", h.getMonitorIncidents)
+	r.Get("/monitors/{slug}/{name}/latency", h.getMonitorLatency)
+	r.Get("/monitors/{slug}/{name}/latency-histogram", h.getMonitorLatencyHistogram)
+
+	// Routes that change monitors require the admin token.
+	r.Group(func(r chi.Router) {
+		r.Use(h.requireAdmin)
+
+		// Monitors managed through the API; the ones in monitors.json are read-only.
+		r.Post("/monitors", h.createMonitor)
+		r.Post("/monitors/apply", h.applyMonitors)
+		r.Put("/monitors/{slug}/{name}", h.updateMonitor)
+		r.Patch("/monitors/{slug}/{name}", h.patchMonitor)
+		r.Delete("/monitors/{slug}/{name}", h.deleteMonitor)
+		r.Post("/monitors/{slug}/{name}/pause", h.pauseMonitor)
+		r.Post("/monitors/{slug}/{name}/resume", h.resumeMonitor)
+
+		r.Post("/admin/reload", h.reloadConfig)
+	})
 }
 
 // getMonitors returns a list of all configured monitors.
 // @Summary      List all monitors
-// @Description  get a list of all monitors configured in the system
+// @Description  get a list of all monitors, from monitors.json (source "file"), managed through the API (source "api") and found by discovery providers (source "docker", "kubernetes" or the name of a file or DNS SRV provider), with header values redacted
 // @Tags         monitors
 // @Accept       json
 // @Produce      json
@@ -57,6 +86,36 @@ func (h *APIHandler) getMonitors(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, monitors)
 }
 
+// getDependencies returns the dependency graph between monitors.
+// @Summary      Get the monitor dependency graph
+// @Description  get all monitors with their current state and the edges from each dependent monitor to the monitors it depends on
+// @Tags         monitors
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  monitor.DependencyGraph
+// @Router       /dependencies [get]
+func (h *APIHandler) getDependencies(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, h.monitorService.GetDependencyGraph())
+}
+
+// getSLOs evaluates every configured SLO.
+// @Summary      List SLOs with their error budgets
+// @Description  get every configured SLO with its current SLI, remaining error budget and multi-window burn rates
+// @Tags         slos
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   monitor.SLOStatus
+// @Failure      500  {object}  map[string]string
+// @Router       /slos [get]
+func (h *APIHandler) getSLOs(w http.ResponseWriter, r *http.Request) {
+	slos, err := h.monitorService.GetSLOs(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, slos)
+}
+
 // getMonitorSummary provides a high-level summary for a single monitor (by slug and name).
 // @Summary      Get a monitor summary
 // @Description  get a high-level summary of a single monitor's performance over the last 24 hours
@@ -109,10 +168,10 @@ func (h *APIHandler) getMonitorsBySlug(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	type monitorWithSummary struct {
-		Name    string                      `json:"name"`
-		Slug    string                      `json:"slug"`
-		URL     string                      `json:"url"`
-		Summary *monitor.MonitorSummary     `json:"summary"`
+		Name    string                  `json:"name"`
+		Slug    string                  `json:"slug"`
+		URL     string                  `json:"url"`
+		Summary *monitor.MonitorSummary `json:"summary"`
 	}
 	var result []monitorWithSummary
 	for _, m := range monitors {
@@ -182,28 +241,12 @@ func (h *APIHandler) getSlugHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Helper to interpret MonitorLogEntry.Response as a status string.
-	getStatus := func(response string) string {
-		if len(response) == 0 {
-			return "unknown"
-		}
-		if response[0] == '2' {
-			return "up"
-		}
-		if response[0] == '4' || response[0] == '5' {
-			return "down"
-		}
-		if len(response) >= 5 && response[:5] == "Error" {
-			return "down"
-		}
-		return "unknown"
-	}
-
 	type SlugMonitorDailyHistory struct {
-		Date           string  `json:"date"`            // YYYY-MM-DD
-		UptimePercent  float64 `json:"uptime_percent"`  // e.g. 99.99
+		Date           string  `json:"date"`           // YYYY-MM-DD
+		UptimePercent  float64 `json:"uptime_percent"` // e.g. 99.99
 		TotalChecks    int     `json:"total_checks"`
 		UpChecks       int     `json:"up_checks"`
+		DegradedChecks int     `json:"degraded_checks"`
 		DownChecks     int     `json:"down_checks"`
 		UnknownChecks  int     `json:"unknown_checks"`
 	}
@@ -212,57 +255,42 @@ func (h *APIHandler) getSlugHistory(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 	historyResult := make(map[string][]SlugMonitorDailyHistory)
 
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	first := today.AddDate(0, 0, -(days - 1))
+
 	for _, m := range monitors {
-		var dailyHistory []SlugMonitorDailyHistory
+		// One query per monitor against the daily rollups covers the whole period.
+		rollups, err := h.monitorService.GetRollups(r.Context(), m.Slug, m.Name, monitor.ResolutionDay, first.Unix(), today.AddDate(0, 0, 1).Unix())
+		if err != nil {
+			log.Printf("Error reading daily rollups for %s/%s: %v", m.Slug, m.Name, err)
+		}
+		byDate := make(map[string]monitor.Rollup, len(rollups))
+		for _, rollup := range rollups {
+			byDate[time.Unix(rollup.BucketStart, 0).Format("2006-01-02")] = rollup
+		}
+
+		// Oldest day first. Days without data are still listed, with zeros.
+		dailyHistory := make([]SlugMonitorDailyHistory, 0, days)
 		for i := 0; i < days; i++ {
-			dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -i)
-			dayEnd := dayStart.Add(24 * time.Hour)
-			startUnix := dayStart.Unix()
-			endUnix := dayEnd.Unix()
-
-			checks, err := h.monitorService.GetMonitorChecks(m.Slug, m.Name, startUnix, endUnix)
-			if err != nil || len(checks) == 0 {
-				// If no data, still add the day with zeros
-				dailyHistory = append(dailyHistory, SlugMonitorDailyHistory{
-					Date:          dayStart.Format("2006-01-02"),
-					UptimePercent: 0,
-					TotalChecks:   0,
-					UpChecks:      0,
-					DownChecks:    0,
-					UnknownChecks: 0,
-				})
+			date := first.AddDate(0, 0, i).Format("2006-01-02")
+			day, ok := byDate[date]
+			if !ok {
+				dailyHistory = append(dailyHistory, SlugMonitorDailyHistory{Date: date})
 				continue
 			}
 
-			var up, down, unknown int
-			for _, c := range checks {
-				switch getStatus(c.Response) {
-				case "up":
-					up++
-				case "down":
-					down++
-				default:
-					unknown++
-				}
-			}
-			total := up + down + unknown
-			uptimePercent := 0.0
-			if total > 0 {
-				uptimePercent = float64(up) / float64(total) * 100
-			}
+			// Degraded checks count as up; paused and maintenance checks are
+			// reported as unknown and excluded from the uptime percentage.
 			dailyHistory = append(dailyHistory, SlugMonitorDailyHistory{
-				Date:          dayStart.Format("2006-01-02"),
-				UptimePercent: uptimePercent,
-				TotalChecks:   total,
-				UpChecks:      up,
-				DownChecks:    down,
-				UnknownChecks: unknown,
+				Date:           date,
+				UptimePercent:  day.UptimePercent(),
+				TotalChecks:    day.Total(),
+				UpChecks:       day.Up,
+				DegradedChecks: day.Degraded,
+				DownChecks:     day.Down,
+				UnknownChecks:  day.Unknown,
 			})
 		}
-		// Reverse dailyHistory so oldest day is first
-		for i, j := 0, len(dailyHistory)-1; i < j; i, j = i+1, j-1 {
-			dailyHistory[i], dailyHistory[j] = dailyHistory[j], dailyHistory[i]
-		}
 		historyResult[m.Name] = dailyHistory
 	}
 	respondWithJSON(w, http.StatusOK, historyResult)
@@ -339,6 +367,222 @@ func (h *APIHandler) getMonitorChecks(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, checks)
 }
 
+// getMonitorTransitions returns the state transitions of a monitor within a specified range (by slug and name).
+// @Summary      Get monitor state transitions
+// @Description  get the state changes (up, degraded, down, paused, maintenance, pending) of a monitor with their timestamps
+// @Tags         monitors
+// @Accept       json
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Param        range query string false "Time range preset (e.g., '1h', '24h', '7d', '30d'). Default is '24h'."
+// @Param        start_time query int false "Start time as a Unix timestamp. Overrides 'range'."
+// @Param        end_time query int false "End time as a Unix timestamp. Defaults to now."
+// @Success      200  {array}   monitor.StateTransition
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /monitors/{slug}/{name}/transitions [get]
+func (h *APIHandler) getMonitorTransitions(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	name := chi.URLParam(r, "name")
+
+	startTime, endTime, err := parseTimeRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	transitions, err := h.monitorService.GetStateTransitions(slug, name, startTime, endTime)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Monitor not found or no data available for the given range")
+		return
+	}
+	if transitions == nil {
+		transitions = []monitor.StateTransition{}
+	}
+
+	respondWithJSON(w, http.StatusOK, transitions)
+}
+
+// getMonitorIncidents returns the incidents of a monitor that overlap a specified range (by slug and name).
+// @Summary      Get monitor incidents
+// @Description  get the outages of a monitor with their start, end, duration, first and last error and check count
+// @Tags         incidents
+// @Accept       json
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Param        range query string false "Time range preset (e.g., '1h', '24h', '7d', '30d'). Default is '24h'."
+// @Param        start_time query int false "Start time as a Unix timestamp. Overrides 'range'."
+// @Param        end_time query int false "End time as a Unix timestamp. Defaults to now."
+// @Success      200  {array}   monitor.Incident
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /monitors/{slug}/{name}/incidents [get]
+func (h *APIHandler) getMonitorIncidents(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	name := chi.URLParam(r, "name")
+
+	startTime, endTime, err := parseTimeRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	incidents, err := h.monitorService.GetIncidents(slug, name, startTime, endTime)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Monitor not found or no data available for the given range")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, incidents)
+}
+
+// getSlugIncidents returns the incidents of all monitors under a slug that overlap a specified range.
+// @Summary      Get incidents for all monitors under a slug
+// @Description  get the outages of all monitors under a slug, newest first
+// @Tags         incidents
+// @Accept       json
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        range query string false "Time range preset (e.g., '1h', '24h', '7d', '30d'). Default is '24h'."
+// @Param        start_time query int false "Start time as a Unix timestamp. Overrides 'range'."
+// @Param        end_time query int false "End time as a Unix timestamp. Defaults to now."
+// @Success      200  {array}   monitor.Incident
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /monitors/slug/{slug}/incidents [get]
+func (h *APIHandler) getSlugIncidents(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if _, err := h.monitorService.GetMonitorsBySlug(slug); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	incidents, err := h.monitorService.GetSlugIncidents(slug, startTime, endTime)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, incidents)
+}
+
+// getMonitorLatency returns latency percentiles for a monitor within a specified range (by slug and name).
+// @Summary      Get monitor latency percentiles
+// @Description  get the min, average, p50, p90, p95, p99 and max response time in milliseconds of a monitor within a specified time range
+// @Tags         monitors
+// @Accept       json
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Param        range query string false "Time range preset (e.g., '1h', '24h', '7d', '30d'). Default is '24h'."
+// @Param        start_time query int false "Start time as a Unix timestamp. Overrides 'range'."
+// @Param        end_time query int false "End time as a Unix timestamp. Defaults to now."
+// @Success      200  {object}  monitor.LatencyStats
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /monitors/{slug}/{name}/latency [get]
+func (h *APIHandler) getMonitorLatency(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	name := chi.URLParam(r, "name")
+
+	startTime, endTime, err := parseTimeRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, err := h.monitorService.GetLatencyStats(r.Context(), slug, name, startTime, endTime)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Monitor not found or no data available for the given range")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+// getMonitorLatencyHistogram returns a latency histogram for a monitor within a specified range (by slug and name).
+// @Summary      Get monitor latency histogram
+// @Description  get the number of checks of a monitor per response time bucket within a specified time range
+// @Tags         monitors
+// @Accept       json
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Param        range query string false "Time range preset (e.g., '1h', '24h', '7d', '30d'). Default is '24h'."
+// @Param        start_time query int false "Start time as a Unix timestamp. Overrides 'range'."
+// @Param        end_time query int false "End time as a Unix timestamp. Defaults to now."
+// @Param        buckets query string false "Comma-separated bucket upper bounds in milliseconds (e.g., '50,100,250'). Defaults to 25ms to 10s."
+// @Success      200  {array}   monitor.LatencyBucket
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /monitors/{slug}/{name}/latency-histogram [get]
+func (h *APIHandler) getMonitorLatencyHistogram(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	name := chi.URLParam(r, "name")
+
+	startTime, endTime, err := parseTimeRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var bounds []float64
+	if bucketsStr := r.URL.Query().Get("buckets"); bucketsStr != "" {
+		for _, part := range strings.Split(bucketsStr, ",") {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || bound <= 0 {
+				respondWithError(w, http.StatusBadRequest, "invalid buckets parameter, use positive millisecond bounds like '50,100,250'")
+				return
+			}
+			bounds = append(bounds, bound)
+		}
+	}
+
+	histogram, err := h.monitorService.GetLatencyHistogram(r.Context(), slug, name, startTime, endTime, bounds)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Monitor not found or no data available for the given range")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, histogram)
+}
+
+// reloadConfig re-reads monitors.json and applies it without a restart.
+// @Summary      Reload the monitors configuration
+// @Description  re-read the monitors configuration, starting new monitors, stopping removed ones and restarting changed ones; an invalid configuration is rejected with every problem found and the running one kept
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  monitor.ReloadResult
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /admin/reload [post]
+func (h *APIHandler) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	result, err := h.monitorService.Reload(r.Context())
+	var problems monitor.ConfigErrors
+	if errors.As(err, &problems) {
+		respondWithProblems(w, err, problems)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	// Cached summaries may belong to monitors that were changed or removed.
+	h.cache.Flush()
+	respondWithJSON(w, http.StatusOK, result)
+}
+
 // parseTimeRange determines the start and end timestamps from URL query parameters.
 // It supports presets like "1h", "24h", "7d", "30d", "90d" and custom "start_time" and "end_time".
 func parseTimeRange(r *http.Request) (int64, int64, error) {
@@ -374,17 +618,14 @@ func parseTimeRange(r *http.Request) (int64, int64, error) {
 	duration := 24 * time.Hour // Default
 	if rangeStr != "" {
 		var err error
-		duration, err = time.ParseDuration(rangeStr)
-		if err == nil { // e.g., "1h", "24h"
-			// special cases for days
-			if rangeStr == "7d" {
-				duration = 7 * 24 * time.Hour
-			} else if rangeStr == "30d" {
-				duration = 30 * 24 * time.Hour
-			} else if rangeStr == "90d" {
-				duration = 90 * 24 * time.Hour
-			}
-		} else {
+		if days, ok := strings.CutSuffix(rangeStr, "d"); ok { // e.g., "7d", "30d"
+			var n int
+			n, err = strconv.Atoi(days)
+			duration = time.Duration(n) * 24 * time.Hour
+		} else { // e.g., "1h", "24h"
+			duration, err = time.ParseDuration(rangeStr)
+		}
+		if err != nil || duration <= 0 {
 			return 0, 0, fmt.Errorf("invalid range parameter, use formats like '1h', '24h', '7d', '30d', '90d'")
 		}
 	}
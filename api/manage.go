@@ -0,0 +1,307 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"guptime/monitor"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxMonitorBodySize limits the size of a monitor definition sent to the API.
+	maxMonitorBodySize = 1 << 20
+	// maxApplyBodySize limits the size of a declared list of monitors sent to the API.
+	maxApplyBodySize = 16 << 20
+)
+
+// createMonitor adds a monitor managed through the API.
+// @Summary      Create a monitor
+// @Description  add a monitor with the same settings as in monitors.json and start checking it; its definition is stored in the database
+// @Tags         monitors
+// @Accept       json
+// @Produce      json
+// @Param        monitor body monitor.Monitor true "Monitor definition"
+// @Security     BearerAuth
+// @Success      201  {object}  monitor.Monitor
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /monitors [post]
+func (h *APIHandler) createMonitor(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.readMonitor(w, r)
+	if !ok {
+		return
+	}
+	created, err := h.monitorService.CreateMonitor(r.Context(), m)
+	if err != nil {
+		h.respondWithMonitorError(w, err)
+		return
+	}
+	h.cache.Flush()
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// updateMonitor replaces the definition of a monitor managed through the API (by slug and name).
+// @Summary      Replace a monitor
+// @Description  replace the definition of a monitor managed through the API and restart it; a new slug or name renames it with its history, and redacted header values are kept
+// @Tags         monitors
+// @Accept       json
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Param        monitor body monitor.Monitor true "Monitor definition"
+// @Security     BearerAuth
+// @Success      200  {object}  monitor.Monitor
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /monitors/{slug}/{name} [put]
+func (h *APIHandler) updateMonitor(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.readMonitor(w, r)
+	if !ok {
+		return
+	}
+	updated, err := h.monitorService.UpdateMonitor(r.Context(), chi.URLParam(r, "slug"), chi.URLParam(r, "name"), m)
+	if err != nil {
+		h.respondWithMonitorError(w, err)
+		return
+	}
+	h.cache.Flush()
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// patchMonitor changes some settings of a monitor managed through the API (by slug and name).
+// @Summary      Update a monitor
+// @Description  apply a JSON merge patch to the definition of a monitor managed through the API and restart it; null removes a setting
+// @Tags         monitors
+// @Accept       json
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Param        patch body object true "JSON merge patch"
+// @Security     BearerAuth
+// @Success      200  {object}  monitor.Monitor
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /monitors/{slug}/{name} [patch]
+func (h *APIHandler) patchMonitor(w http.ResponseWriter, r *http.Request) {
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMonitorBodySize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "failed to read request body: "+err.Error())
+		return
+	}
+	updated, err := h.monitorService.PatchMonitor(r.Context(), chi.URLParam(r, "slug"), chi.URLParam(r, "name"), patch)
+	if err != nil {
+		h.respondWithMonitorError(w, err)
+		return
+	}
+	h.cache.Flush()
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// deleteMonitor removes a monitor managed through the API (by slug and name).
+// @Summary      Delete a monitor
+// @Description  stop a monitor managed through the API and remove its definition; its history is archived
+// @Tags         monitors
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Security     BearerAuth
+// @Success      204
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /monitors/{slug}/{name} [delete]
+func (h *APIHandler) deleteMonitor(w http.ResponseWriter, r *http.Request) {
+	if err := h.monitorService.DeleteMonitor(r.Context(), chi.URLParam(r, "slug"), chi.URLParam(r, "name")); err != nil {
+		h.respondWithMonitorError(w, err)
+		return
+	}
+	h.cache.Flush()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pauseMonitor stops the checks of a monitor managed through the API (by slug and name).
+// @Summary      Pause a monitor
+// @Description  stop checking a monitor managed through the API until it is resumed
+// @Tags         monitors
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Security     BearerAuth
+// @Success      200  {object}  monitor.Monitor
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /monitors/{slug}/{name}/pause [post]
+func (h *APIHandler) pauseMonitor(w http.ResponseWriter, r *http.Request) {
+	h.setPaused(w, r, true)
+}
+
+// resumeMonitor restarts the checks of a paused monitor managed through the API (by slug and name).
+// @Summary      Resume a monitor
+// @Description  start checking a paused monitor managed through the API again
+// @Tags         monitors
+// @Produce      json
+// @Param        slug path string true "Slug"
+// @Param        name path string true "Monitor Name"
+// @Security     BearerAuth
+// @Success      200  {object}  monitor.Monitor
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /monitors/{slug}/{name}/resume [post]
+func (h *APIHandler) resumeMonitor(w http.ResponseWriter, r *http.Request) {
+	h.setPaused(w, r, false)
+}
+
+// setPaused pauses or resumes the monitor named in the request path.
+func (h *APIHandler) setPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	m, err := h.monitorService.SetMonitorPaused(r.Context(), chi.URLParam(r, "slug"), chi.URLParam(r, "name"), paused)
+	if err != nil {
+		h.respondWithMonitorError(w, err)
+		return
+	}
+	h.cache.Flush()
+	respondWithJSON(w, http.StatusOK, m)
+}
+
+// applyMonitors makes the monitors managed through the API match a declared list in one change.
+// @Summary      Plan or apply a declared list of monitors
+// @Description  compare a declared list of monitors with the ones managed through the API and, unless dry_run is set, add, change and (with prune) delete monitors to match it in one change; monitors in monitors.json cannot be declared
+// @Tags         monitors
+// @Accept       json
+// @Produce      json
+// @Param        monitors body []monitor.Monitor true "Declared monitors"
+// @Param        prune query bool false "Delete managed monitors that are not declared"
+// @Param        dry_run query bool false "Only return the plan"
+// @Security     BearerAuth
+// @Success      200  {object}  monitor.MonitorPlan
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /monitors/apply [post]
+func (h *APIHandler) applyMonitors(w http.ResponseWriter, r *http.Request) {
+	prune, err := parseBoolParam(r, "prune")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun, err := parseBoolParam(r, "dry_run")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxApplyBodySize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "failed to read request body: "+err.Error())
+		return
+	}
+
+	// Each definition is validated on its own, so that the problems of all of them are reported.
+	var definitions []json.RawMessage
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		problems := monitor.ConfigErrors{{Message: "expected a list of monitors: " + err.Error()}}
+		respondWithProblems(w, problems, problems)
+		return
+	}
+	declared := make([]monitor.Monitor, 0, len(definitions))
+	var problems monitor.ConfigErrors
+	for i, definition := range definitions {
+		m, err := monitor.ParseMonitor(definition)
+		var errs monitor.ConfigErrors
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				e.Message = fmt.Sprintf("monitors[%d]: %s", i, e.Message)
+				problems = append(problems, e)
+			}
+			continue
+		}
+		declared = append(declared, m)
+	}
+	if len(problems) > 0 {
+		respondWithProblems(w, problems, problems)
+		return
+	}
+
+	plan, err := h.monitorService.ApplyMonitors(r.Context(), declared, prune, dryRun)
+	if err != nil {
+		h.respondWithMonitorError(w, err)
+		return
+	}
+	if plan.Applied {
+		h.cache.Flush()
+	}
+	respondWithJSON(w, http.StatusOK, plan)
+}
+
+// parseBoolParam reads an optional boolean query parameter.
+func parseBoolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s parameter, use true or false", name)
+	}
+	return b, nil
+}
+
+// readMonitor reads and validates the monitor definition in the request body. If it is invalid,
+// the error response has been written.
+func (h *APIHandler) readMonitor(w http.ResponseWriter, r *http.Request) (monitor.Monitor, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMonitorBodySize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "failed to read request body: "+err.Error())
+		return monitor.Monitor{}, false
+	}
+	m, err := monitor.ParseMonitor(data)
+	if err != nil {
+		h.respondWithMonitorError(w, err)
+		return monitor.Monitor{}, false
+	}
+	return m, true
+}
+
+// respondWithMonitorError maps an error from changing a monitor to a status code.
+func (h *APIHandler) respondWithMonitorError(w http.ResponseWriter, err error) {
+	var problems monitor.ConfigErrors
+	switch {
+	case errors.As(err, &problems):
+		respondWithProblems(w, err, problems)
+	case errors.Is(err, monitor.ErrRedactedHeader):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, monitor.ErrMonitorNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, monitor.ErrMonitorExists), errors.Is(err, monitor.ErrMonitorReadOnly):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// respondWithProblems sends the problems of an invalid configuration or monitor definition.
+func respondWithProblems(w http.ResponseWriter, err error, problems monitor.ConfigErrors) {
+	log.Printf("API Error: status=%d, message=%s", http.StatusUnprocessableEntity, err)
+	respondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "problems": problems})
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"guptime/monitor"
+)
+
+func TestRespondWithMonitorError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: monitor 'prod/api' has no current value for header 'X-Token'", monitor.ErrRedactedHeader), http.StatusBadRequest},
+		{monitor.ConfigErrors{{Message: "url is required"}}, http.StatusUnprocessableEntity},
+		{fmt.Errorf("%w: 'prod/api'", monitor.ErrMonitorNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: 'prod/api'", monitor.ErrMonitorExists), http.StatusConflict},
+		{fmt.Errorf("%w: 'prod/api'", monitor.ErrMonitorReadOnly), http.StatusConflict},
+		{errors.New("database is locked"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		(&APIHandler{}).respondWithMonitorError(rec, tt.err)
+		if rec.Code != tt.want {
+			t.Errorf("respondWithMonitorError(%v) status = %d, want %d", tt.err, rec.Code, tt.want)
+		}
+	}
+}
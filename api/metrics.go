@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Metrics serves the service's internal metrics in the Prometheus text exposition format.
+// @Summary      Get service metrics
+// @Description  get the result writer's queue depth, flush latency and write counters in the Prometheus text format
+// @Tags         metrics
+// @Produce      plain
+// @Success      200  {string}  string
+// @Router       /metrics [get]
+func (h *APIHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	m := h.monitorService.WriterMetrics()
+
+	var b strings.Builder
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	metric("guptime_write_queue_depth", "gauge", "Check results waiting to be written.", m.QueueDepth)
+	metric("guptime_write_queue_capacity", "gauge", "Check results that can wait before checks block.", m.QueueCapacity)
+	metric("guptime_checks_written_total", "counter", "Check results written to the database.", m.ChecksWritten)
+	metric("guptime_checks_failed_total", "counter", "Check results that could not be written.", m.ChecksFailed)
+	metric("guptime_write_flushes_total", "counter", "Batches of check results written.", m.Flushes)
+	metric("guptime_write_flush_seconds_total", "counter", "Time spent writing batches of check results.", m.FlushSeconds)
+	metric("guptime_write_flush_last_seconds", "gauge", "Duration of the last batch write.", m.LastFlushSeconds)
+	metric("guptime_write_flush_max_seconds", "gauge", "Longest batch write since startup.", m.MaxFlushSeconds)
+	metric("guptime_write_flush_last_batch_size", "gauge", "Check results in the last batch written.", m.LastFlushBatchLen)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
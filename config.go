@@ -1,20 +1,58 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"time"
+
+	"guptime/monitor"
 )
 
 // Config holds the application's configuration values.
 type Config struct {
-	DBPath        string
-	ServerPort    string
-	CheckInterval time.Duration
-	RetentionDays int
-	Environment   string
-	CORSAllowedHosts []string
+	DBDriver           string
+	DBPath             string
+	DatabaseURL        string
+	MonitorsConfig     string
+	ServerPort         string
+	CheckInterval      time.Duration
+	RetentionRaw       time.Duration
+	RetentionHourly    time.Duration
+	RetentionDaily     time.Duration
+	Environment        string
+	CORSAllowedHosts   []string
+	DrainTimeout       time.Duration
+	AlertWebhookURL    string
+	FlapWindow         int
+	FlapLowPercent     float64
+	FlapHighPercent    float64
+	WriteBatchSize     int
+	WriteFlushInterval time.Duration
+	WriteQueueSize     int
+	// ConfigWatchInterval is how often monitors.json is checked for changes; 0 disables watching.
+	ConfigWatchInterval time.Duration
+	// AdminToken is the bearer token that authorizes changes through the API. When empty, the
+	// routes that change monitors are disabled.
+	AdminToken string
+	// ServerURL is the running instance that the plan and apply subcommands talk to, with
+	// ServerToken as their bearer token.
+	ServerURL   string
+	ServerToken string
+	// DockerDiscovery enables discovering monitors from the labels of the containers of DockerHost.
+	DockerDiscovery bool
+	DockerHost      string
+	DockerRefresh   time.Duration
+	// KubernetesDiscovery enables discovering monitors from the annotations of the Ingresses and
+	// Services of a cluster, in KubernetesNamespace or all namespaces.
+	KubernetesDiscovery bool
+	Kubeconfig          string
+	KubernetesNamespace string
+	// DiscoveryConfig is a file that configures file and DNS SRV discovery providers.
+	DiscoveryConfig string
 }
 
 // LoadConfig loads configuration from environment variables, providing sensible defaults.
@@ -25,6 +63,13 @@ func LoadConfig() (*Config, error) {
 	// Get the database path, default to './data.db'.
 	dbPath := getEnv("DB_PATH", "./data.db")
 
+	// Get the database driver, default to 'sqlite'. 'postgres' connects to DATABASE_URL instead.
+	dbDriver := getEnv("DB_DRIVER", "sqlite")
+	databaseURL := getEnv("DATABASE_URL", "")
+
+	// Get the monitors configuration, a file or a directory of fragments, default to 'monitors.json'.
+	monitorsConfig := getEnv("MONITORS_CONFIG", "monitors.json")
+
 	// Get the server port, default to '8080'.
 	serverPort := getEnv("HTTP_PORT", "8080")
 
@@ -34,13 +79,104 @@ func LoadConfig() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if checkInterval < monitor.MinCheckInterval {
+		return nil, fmt.Errorf("CHECK_INTERVAL must be at least %s, got %s", monitor.MinCheckInterval, checkIntervalStr)
+	}
+
+	// Get how many days of raw checks to keep, default to RETENTION_DAYS or '14'.
+	retentionRaw, err := getEnvDays("RETENTION_RAW_DAYS", getEnv("RETENTION_DAYS", "14"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Get how many days of hourly rollups to keep, default to '365'.
+	retentionHourly, err := getEnvDays("RETENTION_HOURLY_DAYS", "365")
+	if err != nil {
+		return nil, err
+	}
+
+	// Get how many days of daily rollups to keep, default to '0' (forever).
+	retentionDaily, err := getEnvDays("RETENTION_DAILY_DAYS", "0")
+	if err != nil {
+		return nil, err
+	}
+
+	// Get how long shutdown waits for in-flight checks, default to '10s'.
+	drainTimeoutStr := getEnv("SHUTDOWN_DRAIN_TIMEOUT", "10s")
+	drainTimeout, err := time.ParseDuration(drainTimeoutStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the webhook that receives alert notifications, default to none (alerts are only logged).
+	alertWebhookURL := getEnv("ALERT_WEBHOOK_URL", "")
+
+	// Get the flap detection window and thresholds, default to 21 checks, 25% and 50%.
+	flapWindow, err := strconv.Atoi(getEnv("FLAP_WINDOW", "21"))
+	if err != nil {
+		return nil, err
+	}
+	flapLow, err := strconv.ParseFloat(getEnv("FLAP_LOW_THRESHOLD", "25"), 64)
+	if err != nil {
+		return nil, err
+	}
+	flapHigh, err := strconv.ParseFloat(getEnv("FLAP_HIGH_THRESHOLD", "50"), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get how check results are batched into the database, default to 100 rows or '500ms',
+	// with room for 1000 queued results.
+	writeBatchSize, err := strconv.Atoi(getEnv("WRITE_BATCH_SIZE", "100"))
+	if err != nil {
+		return nil, err
+	}
+	writeFlushInterval, err := time.ParseDuration(getEnv("WRITE_FLUSH_INTERVAL", "500ms"))
+	if err != nil {
+		return nil, err
+	}
+	writeQueueSize, err := strconv.Atoi(getEnv("WRITE_QUEUE_SIZE", "1000"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Get how often monitors.json is checked for changes, default to '10s'. '0' disables watching.
+	configWatchInterval, err := time.ParseDuration(getEnv("CONFIG_WATCH_INTERVAL", "10s"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the token that authorizes changes through the API, default to none, which disables them.
+	adminToken := getEnv("ADMIN_TOKEN", "")
+
+	// Get the running instance that plan and apply talk to, default to localhost on the server port,
+	// and the token they send, default to ADMIN_TOKEN.
+	serverURL := getEnv("GUPTIME_URL", "http://localhost:"+serverPort)
+	serverToken := getEnv("GUPTIME_TOKEN", adminToken)
+
+	// Get whether monitors are discovered from Docker container labels, default to 'false', from the
+	// Docker Engine at DOCKER_HOST, listing the containers again every '1m'.
+	dockerDiscovery, err := strconv.ParseBool(getEnv("DISCOVERY_DOCKER", "false"))
+	if err != nil {
+		return nil, err
+	}
+	dockerHost := getEnv("DOCKER_HOST", monitor.DefaultDockerHost)
+	dockerRefresh, err := time.ParseDuration(getEnv("DISCOVERY_DOCKER_REFRESH", "1m"))
+	if err != nil {
+		return nil, err
+	}
 
-	// Get the data retention period in days, default to '90'.
-	retentionDaysStr := getEnv("RETENTION_DAYS", "90")
-	retentionDays, err := strconv.Atoi(retentionDaysStr)
+	// Get whether monitors are discovered from Kubernetes annotations, default to 'false', in the
+	// cluster of KUBECONFIG or else the one guptime runs in, in all namespaces unless one is set.
+	kubernetesDiscovery, err := strconv.ParseBool(getEnv("DISCOVERY_KUBERNETES", "false"))
 	if err != nil {
 		return nil, err
 	}
+	kubeconfig := getEnv("KUBECONFIG", "")
+	kubernetesNamespace := getEnv("DISCOVERY_KUBERNETES_NAMESPACE", "")
+
+	// Get the file that configures file and DNS SRV discovery, default to none.
+	discoveryConfig := getEnv("DISCOVERY_CONFIG", "")
 
 	// Get CORS allowed hosts, comma-separated, default to "*"
 	corsAllowedHostsStr := getEnv("CORS_ALLOWED_HOSTS", "*")
@@ -52,18 +188,92 @@ func LoadConfig() (*Config, error) {
 	}
 
 	conf := &Config{
-		Environment:      env,
-		DBPath:           dbPath,
-		ServerPort:       ":" + serverPort,
-		CheckInterval:    checkInterval,
-		RetentionDays:    retentionDays,
-		CORSAllowedHosts: corsAllowedHosts,
+		Environment:         env,
+		DBDriver:            dbDriver,
+		DBPath:              dbPath,
+		DatabaseURL:         databaseURL,
+		MonitorsConfig:      monitorsConfig,
+		ServerPort:          ":" + serverPort,
+		CheckInterval:       checkInterval,
+		RetentionRaw:        retentionRaw,
+		RetentionHourly:     retentionHourly,
+		RetentionDaily:      retentionDaily,
+		CORSAllowedHosts:    corsAllowedHosts,
+		DrainTimeout:        drainTimeout,
+		AlertWebhookURL:     alertWebhookURL,
+		FlapWindow:          flapWindow,
+		FlapLowPercent:      flapLow,
+		FlapHighPercent:     flapHigh,
+		WriteBatchSize:      writeBatchSize,
+		WriteFlushInterval:  writeFlushInterval,
+		WriteQueueSize:      writeQueueSize,
+		ConfigWatchInterval: configWatchInterval,
+		AdminToken:          adminToken,
+		ServerURL:           serverURL,
+		ServerToken:         serverToken,
+		DockerDiscovery:     dockerDiscovery,
+		DockerHost:          dockerHost,
+		DockerRefresh:       dockerRefresh,
+		KubernetesDiscovery: kubernetesDiscovery,
+		Kubeconfig:          kubeconfig,
+		KubernetesNamespace: kubernetesNamespace,
+		DiscoveryConfig:     discoveryConfig,
 	}
 
-	log.Printf("Configuration loaded: %+v", conf)
+	// The tokens and the database password are secrets, so they are not logged.
+	logged := *conf
+	logged.DatabaseURL = redactDatabaseURL(logged.DatabaseURL)
+	logged.AdminToken = redact(logged.AdminToken)
+	logged.ServerToken = redact(logged.ServerToken)
+	log.Printf("Configuration loaded: %+v", &logged)
 	return conf, nil
 }
 
+// DatabaseSource returns what the configured database driver connects to: the file path for
+// SQLite and the connection URL for PostgreSQL.
+func (c *Config) DatabaseSource() string {
+	if c.DBDriver == "postgres" || c.DBDriver == "postgresql" {
+		return c.DatabaseURL
+	}
+	return c.DBPath
+}
+
+// RetentionPolicy returns the service-wide retention policy.
+func (c *Config) RetentionPolicy() monitor.RetentionPolicy {
+	return monitor.RetentionPolicy{
+		Raw:    monitor.Duration(c.RetentionRaw),
+		Hourly: monitor.Duration(c.RetentionHourly),
+		Daily:  monitor.Duration(c.RetentionDaily),
+	}
+}
+
+// DiscoveryProviders returns the enabled monitor discovery providers.
+func (c *Config) DiscoveryProviders() ([]monitor.DiscoveryProvider, error) {
+	var providers []monitor.DiscoveryProvider
+	if c.DockerDiscovery {
+		docker, err := monitor.NewDockerDiscovery(c.DockerHost, c.DockerRefresh)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, docker)
+	}
+	if c.KubernetesDiscovery {
+		kubernetes, err := monitor.NewKubernetesDiscovery(c.Kubeconfig, c.KubernetesNamespace)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, kubernetes)
+	}
+	if c.DiscoveryConfig != "" {
+		configured, err := monitor.LoadDiscoveryConfig(c.DiscoveryConfig)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, configured...)
+	}
+	return providers, nil
+}
+
 // splitAndTrim splits a string by sep and trims whitespace from each element.
 func splitAndTrim(s, sep string) []string {
 	var result []string
@@ -104,6 +314,15 @@ func trim(s string) string {
 	return s[start:end]
 }
 
+// getEnvDays retrieves a number of days from an environment variable as a duration.
+func getEnvDays(key, fallback string) (time.Duration, error) {
+	days, err := strconv.Atoi(getEnv(key, fallback))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
 // getEnv retrieves an environment variable or returns a fallback value.
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -111,3 +330,23 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// redact hides a secret setting in logs, showing only whether it is set.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// databasePassword matches a password in a connection string of key=value pairs or in the query
+// of a connection URL.
+var databasePassword = regexp.MustCompile(`(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s&]+)`)
+
+// redactDatabaseURL hides the password of a database connection URL or key=value string.
+func redactDatabaseURL(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		dsn = u.Redacted()
+	}
+	return databasePassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
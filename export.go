@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"guptime/monitor"
+)
+
+// runBackup implements the 'guptime backup' subcommand:
+//
+//	guptime backup [-db source] <file>
+func runBackup(config *Config, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	source := flags.String("db", config.DatabaseSource(), "SQLite database path or PostgreSQL URL, depending on DB_DRIVER")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: guptime backup [-db source] <file>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	dest := flags.Arg(0)
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	store, err := monitor.OpenStore(config.DBDriver, *source)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.Backup(context.Background(), dest); err != nil {
+		return err
+	}
+	fmt.Printf("Backed up database to %s\n", dest)
+	return nil
+}
+
+// runExport implements the 'guptime export' subcommand:
+//
+//	guptime export [-db source] [-slug slug] [-from time] [-to time] [-format ndjson|csv] [-out path]
+//
+// NDJSON is written to a single file (stdout by default); CSV is written as one file per
+// kind of record into the -out directory.
+func runExport(config *Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	source := flags.String("db", config.DatabaseSource(), "SQLite database path or PostgreSQL URL, depending on DB_DRIVER")
+	slug := flags.String("slug", "", "only export monitors under this slug")
+	from := flags.String("from", "", "only export data from this time on (YYYY-MM-DD or RFC 3339)")
+	to := flags.String("to", "", "only export data up to this time (YYYY-MM-DD or RFC 3339)")
+	format := flags.String("format", "ndjson", "output format: ndjson or csv")
+	out := flags.String("out", "-", "output file for ndjson ('-' for stdout), or output directory for csv")
+	flags.Parse(args)
+
+	filter := monitor.ExportFilter{Slug: *slug}
+	var err error
+	if filter.Start, err = parseTimeFlag(*from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if filter.End, err = parseTimeFlag(*to); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	store, err := monitor.OpenStore(config.DBDriver, *source)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	switch *format {
+	case "ndjson":
+		w := io.Writer(os.Stdout)
+		if *out != "-" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", *out, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		buf := bufio.NewWriter(w)
+		enc := json.NewEncoder(buf)
+		if err := monitor.Export(ctx, store, filter, func(r monitor.ExportRecord) error { return enc.Encode(r) }); err != nil {
+			return err
+		}
+		return buf.Flush()
+	case "csv":
+		if *out == "-" {
+			return fmt.Errorf("csv export needs an output directory (-out)")
+		}
+		return exportCSV(ctx, store, filter, *out)
+	default:
+		return fmt.Errorf("unknown format '%s'", *format)
+	}
+}
+
+// csvHeaders are the columns of each CSV file written by exportCSV, keyed by record kind.
+var csvHeaders = map[string][]string{
+	monitor.RecordMonitor: {"slug", "name", "id", "url", "archived_at"},
+	monitor.RecordCheck: {"slug", "name", "timestamp", "time", "state", "status_code", "error_class",
+		"error_message", "response_size", "resolved_ip", "interval_seconds", "response"},
+	monitor.RecordIncident: {"slug", "name", "started_at", "ended_at", "first_error", "last_error", "check_count"},
+	monitor.RecordRollup: {"slug", "name", "resolution", "bucket_start", "up", "degraded", "down", "unknown",
+		"latency_count", "latency_sum", "latency_min", "latency_max", "histogram"},
+}
+
+// exportCSV writes monitors.csv, checks.csv, incidents.csv and rollups.csv into dir.
+func exportCSV(ctx context.Context, store monitor.Store, filter monitor.ExportFilter, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	writers := make(map[string]*csv.Writer, len(csvHeaders))
+	for kind, header := range csvHeaders {
+		f, err := os.Create(filepath.Join(dir, kind+"s.csv"))
+		if err != nil {
+			return fmt.Errorf("failed to create %s.csv: %w", kind, err)
+		}
+		defer f.Close()
+		w := csv.NewWriter(f)
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		writers[kind] = w
+	}
+
+	err := monitor.Export(ctx, store, filter, func(r monitor.ExportRecord) error {
+		return writers[r.Kind].Write(csvRow(r))
+	})
+	if err != nil {
+		return err
+	}
+	for kind, w := range writers {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return fmt.Errorf("failed to write %ss.csv: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// csvRow formats a record in the column order of csvHeaders.
+func csvRow(r monitor.ExportRecord) []string {
+	i := strconv.Itoa
+	i64 := func(v int64) string { return strconv.FormatInt(v, 10) }
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	optional := func(v *int64) string {
+		if v == nil {
+			return ""
+		}
+		return i64(*v)
+	}
+
+	switch r.Kind {
+	case monitor.RecordMonitor:
+		return []string{r.Slug, r.Name, r.Monitor.ID, r.Monitor.URL, optional(r.Monitor.ArchivedAt)}
+	case monitor.RecordCheck:
+		c := r.Check
+		return []string{r.Slug, r.Name, i64(c.Timestamp), f(c.Time), string(c.State), i(c.StatusCode), string(c.ErrorClass),
+			c.ErrorMessage, i64(c.ResponseSize), c.ResolvedIP, i64(c.IntervalSeconds), c.Response}
+	case monitor.RecordIncident:
+		inc := r.Incident
+		return []string{r.Slug, r.Name, i64(inc.StartedAt), optional(inc.EndedAt), inc.FirstError, inc.LastError, i(inc.CheckCount)}
+	default:
+		ru := r.Rollup
+		hist, _ := json.Marshal(ru.Histogram)
+		return []string{r.Slug, r.Name, string(r.Resolution), i64(ru.BucketStart), i(ru.Up), i(ru.Degraded), i(ru.Down), i(ru.Unknown),
+			i(ru.LatencyCount), f(ru.LatencySum), f(ru.LatencyMin), f(ru.LatencyMax), string(hist)}
+	}
+}
+
+// runImport implements the 'guptime import' subcommand:
+//
+//	guptime import [-db source] [-batch n] <file>
+//
+// The file is an NDJSON export ('-' for stdin). Records are written in batches, each in its own
+// transaction, and importing the same records twice changes nothing, so an interrupted import
+// can simply be run again.
+func runImport(config *Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	source := flags.String("db", config.DatabaseSource(), "SQLite database path or PostgreSQL URL, depending on DB_DRIVER")
+	batchSize := flags.Int("batch", 500, "records written per transaction")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: guptime import [-db source] [-batch n] <file.ndjson>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || *batchSize <= 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	in := io.Reader(os.Stdin)
+	if path := flags.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	store, err := monitor.OpenStore(config.DBDriver, *source)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if _, err := store.Migrate(ctx); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(in))
+	batch := make([]monitor.ExportRecord, 0, *batchSize)
+	imported := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.Import(ctx, batch); err != nil {
+			return fmt.Errorf("import stopped after %d records: %w", imported, err)
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		var r monitor.ExportRecord
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read record %d: %w", imported+len(batch)+1, err)
+		}
+		batch = append(batch, r)
+		if len(batch) == *batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d records.\n", imported)
+	return nil
+}
+
+// parseTimeFlag parses a date (YYYY-MM-DD, local midnight) or an RFC 3339 time as a Unix
+// timestamp. An empty value is 0.
+func parseTimeFlag(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -19,6 +21,17 @@ import (
 	"guptime/monitor"
 )
 
+// subcommands are run instead of the server when named as the first argument.
+var subcommands = map[string]func(*Config, []string) error{
+	"migrate":  runMigrate,
+	"backup":   runBackup,
+	"export":   runExport,
+	"import":   runImport,
+	"validate": runValidate,
+	"plan":     runPlan,
+	"apply":    runApply,
+}
+
 // @title           Guptime API
 // @version         1.0
 // @description     An API for monitoring website uptime and performance.
@@ -30,6 +43,10 @@ import (
 // @license.url   https://opensource.org/licenses/MIT
 // @host      localhost:8080
 // @BasePath  /api/v1
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+// @description                 "Bearer " followed by the admin token, required to change monitors.
 func main() {
 	// Load .env file. It's okay if it does not exist.
 	if err := godotenv.Load(); err != nil {
@@ -37,7 +54,16 @@ func main() {
 	}
 
 	// --- Setup Logging ---
-	log.SetOutput(os.Stdout)
+	// Subcommands log to stderr, so that their own output, such as an export, stays clean.
+	var subcommand func(*Config, []string) error
+	if len(os.Args) > 1 {
+		subcommand = subcommands[os.Args[1]]
+	}
+	if subcommand != nil {
+		log.SetOutput(os.Stderr)
+	} else {
+		log.SetOutput(os.Stdout)
+	}
 	log.Println("Initializing Guptime API service...")
 
 	// --- Load Configuration ---
@@ -46,25 +72,65 @@ func main() {
 		log.Fatalf("Fatal: Failed to load configuration: %v", err)
 	}
 
+	// --- Subcommands ---
+	if subcommand != nil {
+		err := subcommand(config, os.Args[2:])
+		if errors.Is(err, errChangesPending) {
+			os.Exit(exitChangesPending)
+		}
+		if err != nil {
+			log.Fatalf("Fatal: %s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+	flag.StringVar(&config.MonitorsConfig, "config", config.MonitorsConfig, "monitors configuration file, or directory of JSON, YAML and TOML files")
+	flag.Parse()
+
+	// --- Open the Database ---
+	store, err := monitor.OpenStore(config.DBDriver, config.DatabaseSource())
+	if err != nil {
+		log.Fatalf("Fatal: Failed to open database: %v", err)
+	}
+
 	// --- Initialize Monitoring Service ---
 	// The monitor service runs in the background, handling all monitoring tasks.
+	discovery, err := config.DiscoveryProviders()
+	if err != nil {
+		log.Fatalf("Fatal: Failed to configure monitor discovery: %v", err)
+	}
 	monitorConfig := &monitor.Config{
-		DBPath:        config.DBPath,
-		CheckInterval: config.CheckInterval,
-		RetentionDays: config.RetentionDays,
+		Store:               store,
+		ConfigPath:          config.MonitorsConfig,
+		CheckInterval:       config.CheckInterval,
+		Retention:           config.RetentionPolicy(),
+		FlapWindow:          config.FlapWindow,
+		FlapLowThreshold:    config.FlapLowPercent,
+		FlapHighThreshold:   config.FlapHighPercent,
+		WriteBatchSize:      config.WriteBatchSize,
+		WriteFlushInterval:  config.WriteFlushInterval,
+		WriteQueueSize:      config.WriteQueueSize,
+		ConfigWatchInterval: config.ConfigWatchInterval,
+		Discovery:           discovery,
+	}
+	if config.AlertWebhookURL != "" {
+		monitorConfig.Notifier = monitor.NewWebhookNotifier(config.AlertWebhookURL)
 	}
 	monitorService, err := monitor.NewService(monitorConfig)
 	if err != nil {
 		log.Fatalf("Fatal: Failed to initialize monitor service: %v", err)
 	}
 
-	// Start the monitoring service. It will run its own goroutines for checks.
-	if err := monitorService.Start(); err != nil {
+	// Start the monitoring service. It will run its own goroutines for checks
+	// until it is closed during shutdown.
+	if err := monitorService.Start(context.Background()); err != nil {
 		log.Fatalf("Fatal: Failed to start monitor service: %v", err)
 	}
 
 	// --- Initialize API Handler ---
-	apiHandler := api.NewAPIHandler(monitorService)
+	apiHandler := api.NewAPIHandler(monitorService, config.AdminToken)
+	if config.AdminToken == "" {
+		log.Println("Warning: ADMIN_TOKEN is not set, so monitors cannot be changed through the API.")
+	}
 
 	// --- Setup Chi Router for the API ---
 	r := chi.NewRouter()
@@ -72,20 +138,24 @@ func main() {
 	// --- CORS Middleware ---
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			allowed := false
+			// Listed origins are echoed and may send credentials; "*" allows any origin, but
+			// without credentials, so that any site cannot make requests on a user's behalf.
+			listed, wildcard := false, false
 			origin := req.Header.Get("Origin")
 			for _, h := range config.CORSAllowedHosts {
-				if h == "*" || h == origin {
-					allowed = true
-					break
-				}
+				listed = listed || h == origin
+				wildcard = wildcard || h == "*"
 			}
-			if allowed && origin != "" {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
+			if origin != "" && (listed || wildcard) {
 				w.Header().Set("Vary", "Origin")
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				if listed {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				}
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
 			if req.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusNoContent)
@@ -108,6 +178,7 @@ func main() {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"status": "ok", "service": "guptime-api"}`))
 	})
+	r.Get("/metrics", apiHandler.Metrics)
 
 	// Swagger documentation endpoint, only enabled in development.
 	if config.Environment == "development" {
@@ -126,9 +197,21 @@ func main() {
 	server := &http.Server{Addr: config.ServerPort, Handler: r}
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 
+	// Reload the monitors configuration on SIGHUP.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Println("SIGHUP received, reloading the monitors configuration.")
+			if _, err := monitorService.Reload(context.Background()); err != nil {
+				log.Printf("Error: Reload failed: %v", err)
+			}
+		}
+	}()
+
 	// Listen for OS signals to trigger a graceful shutdown.
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	go func() {
 		<-sig
 		log.Println("Shutdown signal received.")
@@ -147,7 +230,12 @@ func main() {
 			log.Fatalf("Server shutdown failed: %v", err)
 		}
 
-		monitorService.Close()
+		// Give in-flight checks a bounded amount of time to drain before the database is closed.
+		drainCtx, cancelDrain := context.WithTimeout(shutdownCtx, config.DrainTimeout)
+		defer cancelDrain()
+		if err := monitorService.Close(drainCtx); err != nil {
+			log.Printf("Monitor service shutdown: %v", err)
+		}
 		serverStopCtx()
 	}()
 
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"guptime/monitor"
+)
+
+// runMigrate implements the 'guptime migrate' subcommand:
+//
+//	guptime migrate [-db source] up
+//	guptime migrate [-db source] status
+//	guptime migrate [-db source] down-to <version>
+func runMigrate(config *Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	source := flags.String("db", config.DatabaseSource(), "SQLite database path or PostgreSQL URL, depending on DB_DRIVER")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: guptime migrate [-db source] up | status | down-to <version>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	command := flags.Arg(0)
+	if command != "up" && command != "status" && command != "down-to" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	store, err := monitor.OpenStore(config.DBDriver, *source)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := store.Migrate(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date.")
+		}
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+	case "status":
+		statuses, err := store.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range statuses {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+				if m.AppliedAt > 0 {
+					state += " " + time.Unix(m.AppliedAt, 0).Format(time.RFC3339)
+				}
+			}
+			fmt.Printf("%04d_%-30s %s\n", m.Version, m.Name, state)
+		}
+	case "down-to":
+		version, err := strconv.Atoi(flags.Arg(1))
+		if err != nil || version < 0 {
+			flags.Usage()
+			return fmt.Errorf("down-to needs a version number")
+		}
+		reverted, err := store.MigrateDownTo(ctx, version)
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Printf("Database is already at or below version %d.\n", version)
+		}
+		for _, m := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigPath is the monitors configuration read when none is configured.
+const DefaultConfigPath = "monitors.json"
+
+// configExtensions are the file extensions read from a configuration directory.
+var configExtensions = map[string]bool{".json": true, ".yaml": true, ".yml": true, ".toml": true}
+
+// configFiles returns the configuration files at path: the file itself, or the JSON, YAML and
+// TOML files directly inside it, in name order, if it is a directory.
+func configFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || !configExtensions[strings.ToLower(filepath.Ext(e.Name()))] {
+			continue
+		}
+		files = append(files, filepath.Join(path, e.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadConfig reads, merges and validates the configuration files at path. The error lists every
+// problem found as ConfigErrors.
+func loadConfig(path string, retention RetentionPolicy) (*monitorsFile, error) {
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveConfig(config, retention, path); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readConfig reads and merges the configuration files at path. Every file has the form of
+// monitors.json, in JSON, YAML or TOML, with the defaults described at expandConfig. A monitor or
+// a slug's retention may only be defined once across all files. Checks that span monitors, such
+// as dependencies, are left to resolveConfig.
+func readConfig(path string) (*monitorsFile, error) {
+	files, err := configFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	merged := &monitorsFile{}
+	var errs ConfigErrors
+	definedAt := make(map[string]ConfigError)
+	retentionAt := make(map[string]ConfigError)
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			errs = append(errs, ConfigError{File: name, Message: err.Error()})
+			continue
+		}
+		f, config, monitors := parseConfigFile(name, data)
+		errs = append(errs, f.errs...)
+
+		for _, m := range monitors {
+			key := monitorKey(m.Slug, m.Name)
+			at := ConfigError{File: name, Line: f.line(m.path)}
+			if first, ok := definedAt[key]; ok {
+				at.Message = fmt.Sprintf("monitor '%s' is already defined at %s", key, first.location())
+				errs = append(errs, at)
+				continue
+			}
+			definedAt[key] = at
+		}
+		if config == nil {
+			continue
+		}
+		merged.Monitors = append(merged.Monitors, config.Monitors...)
+		merged.SLOs = append(merged.SLOs, config.SLOs...)
+
+		for _, slug := range sortedKeys(config.Retention) {
+			at := ConfigError{File: name, Line: f.line(configPath{"retention", slug})}
+			if first, ok := retentionAt[slug]; ok {
+				at.Message = fmt.Sprintf("retention for slug '%s' is already defined at %s", slug, first.location())
+				errs = append(errs, at)
+				continue
+			}
+			retentionAt[slug] = at
+			if merged.Retention == nil {
+				merged.Retention = make(map[string]retentionOverride)
+			}
+			merged.Retention[slug] = config.Retention[slug]
+		}
+	}
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			if errs[i].File != errs[j].File {
+				return errs[i].File < errs[j].File
+			}
+			return errs[i].Line < errs[j].Line
+		})
+		return nil, errs
+	}
+	return merged, nil
+}
+
+// resolveConfig runs the checks that span monitors, filling in omitted slugs of references and
+// the retention policy of each slug. These checks span all files, so their problems are located
+// at source, the configuration path.
+func resolveConfig(config *monitorsFile, retention RetentionPolicy, source string) error {
+	var errs ConfigErrors
+	monitors := config.Monitors
+	if err := resolveDependencies(monitors); err != nil {
+		errs = append(errs, ConfigError{File: source, Message: err.Error()})
+	}
+	if err := resolvePreviousNames(monitors); err != nil {
+		errs = append(errs, ConfigError{File: source, Message: err.Error()})
+	}
+	if err := validateSLOs(config.SLOs, monitors); err != nil {
+		errs = append(errs, ConfigError{File: source, Message: err.Error()})
+	}
+	var err error
+	if config.slugRetention, err = resolveRetention(retention, config.Retention, monitors); err != nil {
+		errs = append(errs, ConfigError{File: source, Message: err.Error()})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// configMonitor is a monitor decoded from a configuration file, with its location in the file.
+type configMonitor struct {
+	Monitor
+	path configPath
+}
+
+// parseConfigFile decodes, checks and expands one configuration file. Its problems are recorded
+// in the returned configFile; the configuration is nil if there were any. The monitors that could
+// be decoded are returned either way, so that they can be checked against other files.
+func parseConfigFile(name string, data []byte) (*configFile, *monitorsFile, []configMonitor) {
+	f := &configFile{name: name}
+	doc, err := f.decode(data)
+	if err != nil {
+		return f, nil, nil
+	}
+
+	// The array form is a list of monitors; treat it as the object form for paths.
+	if list, ok := doc.([]interface{}); ok {
+		line := f.line
+		f.line = func(path configPath) int {
+			if len(path) > 0 && path[0] == "monitors" {
+				path = path[1:]
+			}
+			return line(path)
+		}
+		doc = map[string]interface{}{"monitors": list}
+	}
+	if doc == nil {
+		return f, &monitorsFile{}, nil
+	}
+	file, ok := doc.(map[string]interface{})
+	if !ok {
+		f.errorf(nil, "expected a list of monitors or an object, got %s", describeValue(doc))
+		return f, nil, nil
+	}
+
+	f.expandEnv(nil, file)
+	f.expandConfig(file)
+
+	// Monitors are validated one by one, so that problems are found in every monitor that
+	// decodes, even if others do not.
+	var monitors []configMonitor
+	list, _ := file["monitors"].([]interface{})
+	for i, v := range list {
+		m := configMonitor{path: configPath{"monitors", i}}
+		if decodeAs(v, &m.Monitor) == nil {
+			f.validateMonitor(m.path, m.Monitor)
+			monitors = append(monitors, m)
+		}
+	}
+	sort.SliceStable(f.errs, func(i, j int) bool { return f.errs[i].Line < f.errs[j].Line })
+	if len(f.errs) > 0 {
+		return f, nil, monitors
+	}
+
+	// Every format is decoded through JSON, so that they all share the JSON decoding of monitors.
+	encoded, err := json.Marshal(file)
+	if err == nil {
+		var config *monitorsFile
+		if config, err = parseMonitorsFile(encoded); err == nil {
+			return f, config, monitors
+		}
+	}
+	f.errorf(nil, "%v", err)
+	return f, nil, monitors
+}
+
+// decode decodes a file in the format of its extension, JSON by default, into generic values and
+// indexes its lines. A syntax error is recorded and returned.
+func (f *configFile) decode(data []byte) (interface{}, error) {
+	var doc interface{}
+	var err error
+	switch strings.ToLower(filepath.Ext(f.name)) {
+	case ".yaml", ".yml":
+		f.line = yamlLines(data).line
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		f.line = tomlLines(data)
+		// Arrays of tables decode as []map[string]interface{}; go through JSON for plain values.
+		var table map[string]interface{}
+		if err = toml.Unmarshal(data, &table); err == nil && table != nil {
+			encoded, _ := json.Marshal(table)
+			err = json.Unmarshal(encoded, &doc)
+		}
+	default:
+		f.line = jsonLines(data).line
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		f.errs = append(f.errs, syntaxError(f.name, data, err))
+		return nil, err
+	}
+	return doc, nil
+}
+
+// errorLine matches the line number in YAML and TOML decoding errors.
+var errorLine = regexp.MustCompile(`^(?:yaml|toml): line (\d+)(?: \([^)]*\))?: (.*)$`)
+
+// syntaxError locates an error from decoding a configuration file.
+func syntaxError(name string, data []byte, err error) ConfigError {
+	e := ConfigError{File: name, Message: err.Error()}
+	var jsonErr *json.SyntaxError
+	if errors.As(err, &jsonErr) {
+		e.Line = bytes.Count(data[:jsonErr.Offset], []byte("\n")) + 1
+	} else if m := errorLine.FindStringSubmatch(e.Message); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+		e.Message = m[2]
+	}
+	return e
+}
+
+// identityKeys are the monitor fields that defaults and groups may not set.
+var identityKeys = []string{"id", "slug", "name", "previous_names"}
+
+// expandConfig checks the keys and values of a decoded configuration file and fills in its
+// monitors from its defaults. A file in object form may have a "defaults" block that applies to
+// all of its monitors and a "groups" block of defaults per slug:
+//
+//	defaults:
+//	  interval: 1m
+//	groups:
+//	  jh:
+//	    interval: 30s
+//	    headers:
+//	      Authorization: Bearer ${JH_TOKEN}
+//
+// A monitor's own settings take precedence over its group's, which take precedence over the
+// defaults. Objects such as headers are merged key by key; any other setting is replaced.
+func (f *configFile) expandConfig(file map[string]interface{}) {
+	defaults := f.checkDefaults(configPath{"defaults"}, file["defaults"])
+	groups := make(map[string]map[string]interface{})
+	switch v := file["groups"].(type) {
+	case nil:
+	case map[string]interface{}:
+		for _, slug := range sortedKeys(v) {
+			groups[slug] = f.checkDefaults(configPath{"groups", slug}, v[slug])
+		}
+	default:
+		f.errorf(configPath{"groups"}, "expected an object of defaults per slug, got %s", describeValue(v))
+	}
+	delete(file, "defaults")
+	delete(file, "groups")
+
+	f.checkValue(nil, file, reflect.TypeOf(monitorsFile{}))
+
+	used := make(map[string]bool)
+	monitors, _ := file["monitors"].([]interface{})
+	for i, m := range monitors {
+		monitor, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		slug, _ := monitor["slug"].(string)
+		used[slug] = true
+		monitors[i] = mergeObjects(mergeObjects(defaults, groups[slug]), monitor)
+	}
+	for _, slug := range sortedKeys(groups) {
+		if !used[slug] {
+			f.errorf(configPath{"groups", slug}, "group matches no monitors")
+		}
+	}
+}
+
+// checkDefaults checks a defaults or group block, which holds monitor settings other than the
+// ones that identify a monitor. It returns nil if the block is absent or not an object.
+func (f *configFile) checkDefaults(path configPath, v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	block, ok := v.(map[string]interface{})
+	if !ok {
+		f.errorf(path, "expected an object of monitor settings, got %s", describeValue(v))
+		return nil
+	}
+	for _, key := range identityKeys {
+		if _, ok := block[key]; ok {
+			f.errorf(path.with(key), "cannot be set for several monitors")
+		}
+	}
+	f.checkValue(path, block, reflect.TypeOf(Monitor{}))
+	return block
+}
+
+// mergeObjects returns a copy of base with the keys of override applied on top. Objects present
+// in both are merged recursively.
+func mergeObjects(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		if sub, ok := v.(map[string]interface{}); ok {
+			if baseSub, ok := merged[k].(map[string]interface{}); ok {
+				v = mergeObjects(baseSub, sub)
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// envReference matches ${NAME} in configuration strings.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} in every string of a decoded configuration value with the value of
+// the environment variable NAME, which must be set.
+func (f *configFile) expandEnv(path configPath, v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		return envReference.ReplaceAllStringFunc(value, func(ref string) string {
+			name := envReference.FindStringSubmatch(ref)[1]
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				f.errorf(path, "environment variable %s is not set", name)
+			}
+			return env
+		})
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = f.expandEnv(path.with(k), item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = f.expandEnv(path.with(i), item)
+		}
+	}
+	return v
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hashConfig returns a hash of the names and contents of the configuration files at path, or a
+// zero hash if they cannot be read.
+func hashConfig(path string) [sha256.Size]byte {
+	files, err := configFiles(path)
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return [sha256.Size]byte{}
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", file, len(data))
+		h.Write(data)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
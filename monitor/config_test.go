@@ -0,0 +1,229 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30s", 30 * time.Second, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"-1d", -24 * time.Hour, false},
+		{"1.5d", 0, true},
+		{"1d12h", 0, true},
+		{"10", 0, true},
+		{"5x", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDuration(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseDuration(%q) = %v, %v; want %v, error %t", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigDuration(t *testing.T) {
+	// Each format writes a monitor with the interval given as a literal of that format.
+	formats := map[string]string{
+		"monitors.json": `[{"slug": "prod", "name": "api", "url": "https://example.com/", "interval": %s}]`,
+		"monitors.yaml": "- slug: prod\n  name: api\n  url: https://example.com/\n  interval: %s\n",
+		"monitors.toml": "[[monitors]]\nslug = \"prod\"\nname = \"api\"\nurl = \"https://example.com/\"\ninterval = %s\n",
+	}
+	tests := []struct {
+		name    string
+		file    string
+		literal string
+		want    time.Duration
+		wantErr string
+	}{
+		{"JSON string", "monitors.json", `"30s"`, 30 * time.Second, ""},
+		{"JSON days", "monitors.json", `"2d"`, 48 * time.Hour, ""},
+		{"JSON bare integer", "monitors.json", `90`, 90 * time.Second, ""},
+		{"JSON fraction of seconds", "monitors.json", `1.5`, 1500 * time.Millisecond, ""},
+		{"JSON invalid unit", "monitors.json", `"5x"`, 0, `invalid duration "5x"`},
+		{"JSON missing unit", "monitors.json", `"10"`, 0, `invalid duration "10"`},
+		{"JSON wrong type", "monitors.json", `true`, 0, "invalid duration true"},
+		{"JSON too short", "monitors.json", `"500ms"`, 0, "interval must be at least 1s"},
+		{"JSON negative", "monitors.json", `"-1m"`, 0, "interval must not be negative"},
+		{"YAML plain", "monitors.yaml", `30s`, 30 * time.Second, ""},
+		{"YAML quoted", "monitors.yaml", `"1h"`, time.Hour, ""},
+		{"YAML days", "monitors.yaml", `7d`, 7 * 24 * time.Hour, ""},
+		{"YAML bare integer", "monitors.yaml", `90`, 90 * time.Second, ""},
+		{"YAML invalid unit", "monitors.yaml", `1.5d`, 0, `invalid duration "1.5d"`},
+		{"YAML too short", "monitors.yaml", `0.5`, 0, "interval must be at least 1s"},
+		{"TOML string", "monitors.toml", `"30s"`, 30 * time.Second, ""},
+		{"TOML days", "monitors.toml", `"3d"`, 72 * time.Hour, ""},
+		{"TOML bare integer", "monitors.toml", `90`, 90 * time.Second, ""},
+		{"TOML float", "monitors.toml", `2.5`, 2500 * time.Millisecond, ""},
+		{"TOML invalid unit", "monitors.toml", `"10y"`, 0, `invalid duration "10y"`},
+		{"TOML wrong type", "monitors.toml", `[1]`, 0, "invalid duration [1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := fmt.Sprintf(formats[tt.file], tt.literal)
+			f, config, _ := parseConfigFile(tt.file, []byte(data))
+			if tt.wantErr != "" {
+				if len(f.errs) == 0 || !strings.Contains(f.errs.Error(), tt.wantErr) {
+					t.Fatalf("errors = %v, want %q", f.errs, tt.wantErr)
+				}
+				return
+			}
+			if len(f.errs) > 0 {
+				t.Fatalf("parseConfigFile: %v", f.errs)
+			}
+			if got := time.Duration(config.Monitors[0].Interval); got != tt.want {
+				t.Errorf("interval = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeConfigDir writes files, keyed by name, into a new directory and returns its path.
+func writeConfigDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"web.json":          `[]`,
+		"payments.YAML":     `[]`,
+		"batch.yml":         `[]`,
+		"infra.toml":        ``,
+		"README.md":         `notes`,
+		"web.json.bak":      `[]`,
+		".hidden.json":      `[]`,
+		"nested/more.json":  `[]`,
+		"monitors.json.swp": ``,
+	})
+	files, err := configFiles(dir)
+	if err != nil {
+		t.Fatalf("configFiles: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	want := []string{"batch.yml", "infra.toml", "payments.YAML", "web.json"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("configFiles = %v, want %v", names, want)
+	}
+
+	// A file, whatever its name, is read as given.
+	single := filepath.Join(dir, "README.md")
+	if files, err := configFiles(single); err != nil || len(files) != 1 || files[0] != single {
+		t.Errorf("configFiles(%s) = %v, %v", single, files, err)
+	}
+	if _, err := configFiles(filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("configFiles of a missing path: error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestReadConfigDirectory(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"web.json": `{
+  "monitors": [
+    {"slug": "prod", "name": "web", "url": "https://example.com/"}
+  ],
+  "slos": [{"name": "web", "slug": "prod", "monitor": "web", "type": "availability", "target": 99}]
+}`,
+		"payments.yaml": `retention:
+  prod:
+    raw: 7d
+monitors:
+  - slug: prod
+    name: payments
+    url: https://pay.example.com/
+`,
+		"batch.toml": `[[monitors]]
+slug = "batch"
+name = "jobs"
+url = "https://jobs.example.com/"
+`,
+		"notes.txt": `this is not a configuration file`,
+	})
+	config, err := readConfig(dir)
+	if err != nil {
+		t.Fatalf("readConfig: %v", err)
+	}
+	var monitors []string
+	for _, m := range config.Monitors {
+		monitors = append(monitors, monitorKey(m.Slug, m.Name))
+	}
+	// Files are merged in name order.
+	if want := []string{"batch/jobs", "prod/payments", "prod/web"}; !reflect.DeepEqual(monitors, want) {
+		t.Errorf("monitors = %v, want %v", monitors, want)
+	}
+	if len(config.SLOs) != 1 || config.SLOs[0].Name != "web" {
+		t.Errorf("SLOs = %+v, want web's", config.SLOs)
+	}
+	if _, ok := config.Retention["prod"]; !ok || len(config.Retention) != 1 {
+		t.Errorf("retention = %+v, want prod's", config.Retention)
+	}
+}
+
+func TestReadConfigDirectoryDuplicates(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"a.json": `{
+  "retention": {"prod": {"raw": "7d"}},
+  "monitors": [
+    {"slug": "prod", "name": "web", "url": "https://example.com/"}
+  ]
+}`,
+		"b.yaml": `retention:
+  prod:
+    raw: 14d
+monitors:
+  - slug: prod
+    name: api
+    url: https://api.example.com/
+  - slug: prod
+    name: web
+    url: https://www.example.com/
+`,
+	})
+	_, err := readConfig(dir)
+	var errs ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("readConfig error = %v, want ConfigErrors", err)
+	}
+	a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.yaml")
+	want := []string{
+		b + ":2: retention for slug 'prod' is already defined at " + a + ":2",
+		b + ":8: monitor 'prod/web' is already defined at " + a + ":4",
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,176 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MonitorRef identifies another monitor by slug and name.
+type MonitorRef struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// String returns the reference in "slug/name" form.
+func (r MonitorRef) String() string {
+	return monitorKey(r.Slug, r.Name)
+}
+
+// UnmarshalJSON accepts either an object with slug and name or a "slug/name" string.
+// A string without a slash refers to a monitor under the same slug as the referring monitor.
+func (r *MonitorRef) UnmarshalJSON(data []byte) error {
+	var ref string
+	if err := json.Unmarshal(data, &ref); err == nil {
+		if slug, name, ok := strings.Cut(ref, "/"); ok {
+			r.Slug, r.Name = slug, name
+		} else {
+			r.Slug, r.Name = "", ref
+		}
+		return nil
+	}
+
+	type plain MonitorRef
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("invalid monitor reference %s: %w", string(data), err)
+	}
+	*r = MonitorRef(p)
+	return nil
+}
+
+// DependencyGraph describes which monitors depend on which others.
+type DependencyGraph struct {
+	Nodes []DependencyNode `json:"nodes"`
+	Edges []DependencyEdge `json:"edges"`
+}
+
+// DependencyNode is a monitor in the dependency graph with its current state.
+type DependencyNode struct {
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	State State  `json:"state"`
+}
+
+// DependencyEdge points from a dependent monitor to the monitor it depends on.
+type DependencyEdge struct {
+	From MonitorRef `json:"from"`
+	To   MonitorRef `json:"to"`
+}
+
+// resolveDependencies fills in omitted slugs, checks that every dependency exists and
+// rejects dependency cycles.
+func resolveDependencies(monitors []Monitor) error {
+	known := make(map[string]bool, len(monitors))
+	for _, m := range monitors {
+		known[monitorKey(m.Slug, m.Name)] = true
+	}
+
+	for i := range monitors {
+		m := &monitors[i]
+		for j := range m.DependsOn {
+			ref := &m.DependsOn[j]
+			if ref.Slug == "" {
+				ref.Slug = m.Slug
+			}
+			if !known[ref.String()] {
+				return fmt.Errorf("monitor '%s/%s' depends on unknown monitor '%s'", m.Slug, m.Name, ref)
+			}
+			if ref.Slug == m.Slug && ref.Name == m.Name {
+				return fmt.Errorf("monitor '%s/%s' depends on itself", m.Slug, m.Name)
+			}
+		}
+	}
+
+	return detectDependencyCycle(monitors)
+}
+
+// detectDependencyCycle returns an error describing the first dependency cycle found, if any.
+func detectDependencyCycle(monitors []Monitor) error {
+	parents := make(map[string][]string, len(monitors))
+	var keys []string
+	for _, m := range monitors {
+		key := monitorKey(m.Slug, m.Name)
+		keys = append(keys, key)
+		for _, ref := range m.DependsOn {
+			parents[key] = append(parents[key], ref.String())
+		}
+	}
+	sort.Strings(keys)
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	color := make(map[string]int, len(keys))
+	var path []string
+
+	var visit func(key string) error
+	visit = func(key string) error {
+		color[key] = visiting
+		path = append(path, key)
+		for _, parent := range parents[key] {
+			switch color[parent] {
+			case visiting:
+				start := 0
+				for i, k := range path {
+					if k == parent {
+						start = i
+						break
+					}
+				}
+				cycle := append(append([]string{}, path[start:]...), parent)
+				return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+			case unvisited:
+				if err := visit(parent); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		color[key] = done
+		return nil
+	}
+
+	for _, key := range keys {
+		if color[key] == unvisited {
+			if err := visit(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unreachableParent returns the first parent of a monitor that is currently down or itself
+// unreachable, if any.
+func (s *Service) unreachableParent(m Monitor) (MonitorRef, bool) {
+	for _, ref := range m.DependsOn {
+		status, ok := s.currentStatus(ref.Slug, ref.Name)
+		if ok && (status.State == StateDown || status.State == StateUnreachable) {
+			return ref, true
+		}
+	}
+	return MonitorRef{}, false
+}
+
+// GetDependencyGraph returns the dependency graph of all configured monitors.
+func (s *Service) GetDependencyGraph() DependencyGraph {
+	graph := DependencyGraph{Nodes: []DependencyNode{}, Edges: []DependencyEdge{}}
+	for _, m := range s.GetMonitors() {
+		node := DependencyNode{Slug: m.Slug, Name: m.Name, State: StatePending}
+		if status, ok := s.currentStatus(m.Slug, m.Name); ok {
+			node.State = status.State
+		}
+		graph.Nodes = append(graph.Nodes, node)
+		for _, ref := range m.DependsOn {
+			graph.Edges = append(graph.Edges, DependencyEdge{
+				From: MonitorRef{Slug: m.Slug, Name: m.Name},
+				To:   ref,
+			})
+		}
+	}
+	return graph
+}
@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	monitor := func(name string, paused bool, dependsOn ...string) Monitor {
+		m := Monitor{Slug: "prod", Name: name, URL: "http://example.com/", Paused: paused}
+		for _, ref := range dependsOn {
+			r := MonitorRef{Name: ref}
+			if slug, name, ok := strings.Cut(ref, "/"); ok {
+				r = MonitorRef{Slug: slug, Name: name}
+			}
+			m.DependsOn = append(m.DependsOn, r)
+		}
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		monitors []Monitor
+		wantErr  string
+	}{
+		{"no dependencies", []Monitor{monitor("a", false), monitor("b", false)}, ""},
+		{"chain", []Monitor{monitor("a", false, "b"), monitor("b", false, "prod/c"), monitor("c", false)}, ""},
+		{"diamond", []Monitor{monitor("a", false, "b", "c"), monitor("b", false, "d"), monitor("c", false, "d"), monitor("d", false)}, ""},
+		{"unknown", []Monitor{monitor("a", false, "b")}, "monitor 'prod/a' depends on unknown monitor 'prod/b'"},
+		{"unknown slug", []Monitor{monitor("a", false, "staging/a")}, "monitor 'prod/a' depends on unknown monitor 'staging/a'"},
+		{"self by name", []Monitor{monitor("a", false, "a")}, "monitor 'prod/a' depends on itself"},
+		{"self by slug and name", []Monitor{monitor("a", false, "prod/a")}, "monitor 'prod/a' depends on itself"},
+		{"two monitors", []Monitor{monitor("a", false, "b"), monitor("b", false, "a")},
+			"dependency cycle detected: prod/a -> prod/b -> prod/a"},
+		{"through a paused monitor", []Monitor{monitor("a", false, "b"), monitor("b", true, "c"), monitor("c", false, "a")},
+			"dependency cycle detected: prod/a -> prod/b -> prod/c -> prod/a"},
+		{"between paused monitors", []Monitor{monitor("a", false, "b"), monitor("b", true, "c"), monitor("c", true, "b")},
+			"dependency cycle detected: prod/b -> prod/c -> prod/b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := resolveDependencies(tt.monitors)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("resolveDependencies: %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("resolveDependencies = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDetectDependencyCycleSelfEdge(t *testing.T) {
+	monitors := []Monitor{{Slug: "prod", Name: "a", DependsOn: []MonitorRef{{Slug: "prod", Name: "a"}}}}
+	want := "dependency cycle detected: prod/a -> prod/a"
+	if err := detectDependencyCycle(monitors); err == nil || err.Error() != want {
+		t.Fatalf("detectDependencyCycle = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,168 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiscoveryRetryInterval is how long a discovery provider waits before running again after an error.
+const DiscoveryRetryInterval = 30 * time.Second
+
+// DiscoveryProvider finds monitors in an external system, such as the labels of running containers.
+type DiscoveryProvider interface {
+	// Name identifies the provider, as the source of the monitors it finds.
+	Name() string
+	// Run watches for monitors until ctx is cancelled, calling update with the complete set
+	// found whenever it may have changed. Monitors are validated by the service, which skips
+	// invalid ones.
+	Run(ctx context.Context, update func([]Monitor)) error
+}
+
+// runDiscovery runs a discovery provider until ctx is cancelled, starting it again after errors.
+func (s *Service) runDiscovery(ctx context.Context, p DiscoveryProvider) {
+	log.Printf("Discovering monitors with %s.", p.Name())
+	for {
+		err := p.Run(ctx, func(monitors []Monitor) {
+			s.setDiscovered(ctx, p.Name(), monitors)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Error: %s discovery failed, retrying in %s: %v", p.Name(), DiscoveryRetryInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(DiscoveryRetryInterval):
+		}
+	}
+}
+
+// setDiscovered replaces the monitors found by a discovery provider and applies the result to the
+// running service. Invalid monitors are skipped with a warning. If the result cannot be applied,
+// the previous monitors of the provider are kept.
+func (s *Service) setDiscovered(ctx context.Context, provider string, monitors []Monitor) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.runCtx == nil || s.runCtx.Err() != nil {
+		return
+	}
+
+	valid := make([]Monitor, 0, len(monitors))
+	keys := make(map[string]bool, len(monitors))
+	var skipped []ConfigErrors
+	for _, m := range monitors {
+		f := &configFile{name: provider + " discovery", line: func(configPath) int { return 0 }}
+		f.validateMonitor(nil, m)
+		key := monitorKey(m.Slug, m.Name)
+		if len(f.errs) == 0 && keys[key] {
+			f.monitorErrorf(nil, m, "found more than once")
+		}
+		if len(f.errs) > 0 {
+			skipped = append(skipped, f.errs)
+			continue
+		}
+		keys[key] = true
+		valid = append(valid, m)
+	}
+	// Problems are reported when the monitors change, not every time they are found.
+	if previous := s.discovered[provider]; reflect.DeepEqual(valid, previous) || len(valid)+len(previous) == 0 {
+		return
+	}
+	for _, errs := range skipped {
+		log.Printf("Warning: Skipping a discovered monitor: %v", errs)
+	}
+
+	discovered := make(map[string][]Monitor, len(s.discovered)+1)
+	for name, found := range s.discovered {
+		discovered[name] = found
+	}
+	discovered[provider] = valid
+	config, err := s.combineConfig(s.fileConfig, s.managed, discovered, provider+" discovery")
+	if err != nil {
+		log.Printf("Error: Monitors found by %s discovery are invalid, keeping the previous ones: %v", provider, err)
+		return
+	}
+	result, err := s.applyConfig(ctx, config)
+	if err != nil {
+		log.Printf("Error: Failed to apply monitors found by %s discovery: %v", provider, err)
+		return
+	}
+	s.discovered = discovered
+
+	log.Printf("Monitors discovered by %s: %d added, %d removed, %d updated, %d unchanged.",
+		provider, len(result.Added), len(result.Removed), len(result.Updated), result.Unchanged)
+}
+
+// monitorFromLabels builds a monitor from the labels or annotations of a discovered resource whose
+// keys start with prefix, such as "guptime.url" for the prefix "guptime.". The other keys are the
+// settings of monitors.json: headers and labels are set one per key, as in
+// "guptime.headers.Authorization", and monitor lists such as depends_on are comma-separated. Settings found in defaults, such as a
+// slug and name derived from the resource, apply unless a label overrides them. The error lists
+// every problem found as ConfigErrors.
+func monitorFromLabels(labels map[string]string, prefix string, defaults map[string]interface{}) (Monitor, error) {
+	values := make(map[string]interface{}, len(defaults)+len(labels))
+	for key, value := range defaults {
+		values[key] = value
+	}
+	for label, value := range labels {
+		key, found := strings.CutPrefix(label, prefix)
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if object, field, found := strings.Cut(key, "."); found && (object == "headers" || object == "labels") {
+			entries, _ := values[object].(map[string]interface{})
+			if entries == nil {
+				entries = make(map[string]interface{})
+				values[object] = entries
+			}
+			entries[field] = value
+			continue
+		}
+		switch key {
+		case "depends_on", "previous_names":
+			var refs []interface{}
+			for _, ref := range strings.Split(value, ",") {
+				if ref = strings.TrimSpace(ref); ref != "" {
+					refs = append(refs, ref)
+				}
+			}
+			values[key] = refs
+		case "paused":
+			if paused, err := strconv.ParseBool(value); err == nil {
+				values[key] = paused
+				continue
+			}
+			values[key] = value
+		default:
+			values[key] = value
+		}
+	}
+
+	return buildMonitor(values)
+}
+
+// buildMonitor decodes and validates the settings of a discovered monitor as strictly as a
+// monitor in monitors.json. The error lists every problem found as ConfigErrors.
+func buildMonitor(values map[string]interface{}) (Monitor, error) {
+	var m Monitor
+	f := &configFile{line: func(configPath) int { return 0 }}
+	f.checkValue(nil, values, reflect.TypeOf(Monitor{}))
+	if len(f.errs) == 0 {
+		if err := decodeAs(values, &m); err != nil {
+			f.errorf(nil, "%v", err)
+		}
+	}
+	if len(f.errs) == 0 {
+		f.validateMonitor(nil, m)
+	}
+	if len(f.errs) > 0 {
+		return m, f.errs
+	}
+	return m, nil
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorFromLabels(t *testing.T) {
+	defaults := map[string]interface{}{"slug": "shop", "name": "web-1"}
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    Monitor
+		wantErr string
+	}{
+		{
+			name:   "url only",
+			labels: map[string]string{"guptime.url": "http://web/"},
+			want:   Monitor{Slug: "shop", Name: "web-1", URL: "http://web/"},
+		},
+		{
+			name: "other labels are ignored",
+			labels: map[string]string{"guptime.url": "http://web/", "com.docker.compose.service": "web",
+				"guptimeurl": "x", "org.guptime.url": "x"},
+			want: Monitor{Slug: "shop", Name: "web-1", URL: "http://web/"},
+		},
+		{
+			name:   "slug and name override the defaults",
+			labels: map[string]string{"guptime.url": "http://web/", "guptime.slug": "prod", "guptime.name": "web"},
+			want:   Monitor{Slug: "prod", Name: "web", URL: "http://web/"},
+		},
+		{
+			name: "settings",
+			labels: map[string]string{
+				"guptime.url":               " http://web/ ",
+				"guptime.interval":          "30s",
+				"guptime.down_interval":     "10s",
+				"guptime.latency_threshold": "250ms",
+				"guptime.paused":            "true",
+			},
+			want: Monitor{Slug: "shop", Name: "web-1", URL: "http://web/", Interval: Duration(30 * time.Second),
+				DownInterval: Duration(10 * time.Second), LatencyThreshold: Duration(250 * time.Millisecond), Paused: true},
+		},
+		{
+			name: "headers and labels one per key",
+			labels: map[string]string{
+				"guptime.url":                   "http://web/",
+				"guptime.headers.Authorization": "Bearer token",
+				"guptime.headers.X-Env":         "prod",
+				"guptime.labels.team":           "payments",
+			},
+			want: Monitor{Slug: "shop", Name: "web-1", URL: "http://web/",
+				Headers: map[string]string{"Authorization": "Bearer token", "X-Env": "prod"},
+				Labels:  map[string]string{"team": "payments"}},
+		},
+		{
+			name:   "comma-separated lists",
+			labels: map[string]string{"guptime.url": "http://web/", "guptime.depends_on": "db, infra/dns,", "guptime.previous_names": "www"},
+			want: Monitor{Slug: "shop", Name: "web-1", URL: "http://web/",
+				DependsOn:     []MonitorRef{{Name: "db"}, {Slug: "infra", Name: "dns"}},
+				PreviousNames: []MonitorRef{{Name: "www"}}},
+		},
+		{
+			name:    "missing url",
+			labels:  map[string]string{"guptime.interval": "30s"},
+			wantErr: "url is required",
+		},
+		{
+			name:    "invalid url",
+			labels:  map[string]string{"guptime.url": "ftp://web/"},
+			wantErr: "is not an absolute http or https URL",
+		},
+		{
+			name:    "invalid duration",
+			labels:  map[string]string{"guptime.url": "http://web/", "guptime.interval": "often"},
+			wantErr: `invalid duration "often"`,
+		},
+		{
+			name:    "invalid bool",
+			labels:  map[string]string{"guptime.url": "http://web/", "guptime.paused": "maybe"},
+			wantErr: `expected true or false, got "maybe"`,
+		},
+		{
+			name:    "unknown setting",
+			labels:  map[string]string{"guptime.url": "http://web/", "guptime.intervall": "30s"},
+			wantErr: "unknown key 'intervall'",
+		},
+		{
+			name:    "source cannot be set",
+			labels:  map[string]string{"guptime.url": "http://web/", "guptime.source": "file"},
+			wantErr: "source is set by the service",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := monitorFromLabels(tt.labels, "guptime.", defaults)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("monitorFromLabels error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("monitorFromLabels: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("monitorFromLabels = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dnsLookupTimeout bounds the lookup of one SRV record.
+const dnsLookupTimeout = 10 * time.Second
+
+// DNSSRVDiscovery finds monitors in DNS SRV records, such as the ones a service registry like
+// Consul serves. Every target and port of the records is expanded into a monitor from the
+// provider's monitor template, with the provider's labels. The records are looked up again
+// every refresh interval; a record whose lookup fails keeps its previous targets, and a record
+// that no longer exists removes them.
+type DNSSRVDiscovery struct {
+	name            string
+	records         []string
+	nameserver      string
+	labels          map[string]string
+	refreshInterval time.Duration
+	template        *monitorTemplate
+	// lookup resolves the records instead of the resolver of the nameserver, if it is set.
+	lookup srvResolver
+
+	// found holds the targets last found for each record.
+	found map[string][]string
+	// warned holds the last problem reported for each record and target, so that it is logged once.
+	warned map[string]string
+}
+
+// Name returns the configured name of the provider.
+func (d *DNSSRVDiscovery) Name() string {
+	return d.name
+}
+
+// Run looks up the records every refresh interval until ctx is cancelled.
+func (d *DNSSRVDiscovery) Run(ctx context.Context, update func([]Monitor)) error {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+	for {
+		update(d.monitors(ctx))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// srvResolver looks up SRV records, as a net.Resolver does.
+type srvResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// resolver returns the resolver for the configured nameserver, or the system's if there is none.
+func (d *DNSSRVDiscovery) resolver() srvResolver {
+	if d.lookup != nil {
+		return d.lookup
+	}
+	if d.nameserver == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, d.nameserver)
+		},
+	}
+}
+
+// monitors looks up the records and expands their targets. Failed lookups and invalid targets
+// are reported once, until they succeed again.
+func (d *DNSSRVDiscovery) monitors(ctx context.Context) []Monitor {
+	// Lookup errors name a random local port, so a problem is reported when it starts.
+	warned := make(map[string]string, len(d.warned))
+	warn := func(key, format string, args ...interface{}) {
+		warned[key] = fmt.Sprintf(format, args...)
+		if _, ok := d.warned[key]; !ok {
+			log.Printf("Warning: %s", warned[key])
+		}
+	}
+
+	resolver := d.resolver()
+	found := make(map[string][]string, len(d.records))
+	for _, record := range d.records {
+		targets, err := lookupSRV(ctx, resolver, record)
+		if err != nil {
+			if previous, ok := d.found[record]; ok {
+				found[record] = previous
+			}
+			warn(record, "%s discovery could not look up %s, keeping its previous targets: %v", d.name, record, err)
+			continue
+		}
+		found[record] = targets
+	}
+	d.found = found
+
+	var monitors []Monitor
+	for _, record := range d.records {
+		for _, target := range found[record] {
+			m, err := d.template.expand(newDiscoveredTarget(target, d.labels))
+			if err != nil {
+				warn(record+"/"+target, "Skipping target '%s' of %s: %v", target, record, err)
+				continue
+			}
+			monitors = append(monitors, m)
+		}
+	}
+	d.warned = warned
+	return monitors
+}
+
+// lookupSRV returns the targets of an SRV record as "host:port", in order. A record that does not
+// exist has no targets.
+func lookupSRV(ctx context.Context, resolver srvResolver, record string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	_, srvs, err := resolver.LookupSRV(ctx, "", "", record)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Records of equal priority are shuffled by weight; sort them so that the monitors are stable.
+	targets := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		targets = append(targets, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
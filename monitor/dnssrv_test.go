@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeResolver answers SRV lookups from a map of records; a missing record does not exist.
+type fakeResolver struct {
+	srvs map[string][]*net.SRV
+	errs map[string]error
+}
+
+func (r *fakeResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "" || proto != "" {
+		return "", nil, &net.DNSError{Err: "unexpected service or proto", Name: name}
+	}
+	if err := r.errs[name]; err != nil {
+		return "", nil, err
+	}
+	srvs, ok := r.srvs[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return name, srvs, nil
+}
+
+func TestDNSSRVDiscovery(t *testing.T) {
+	resolver := &fakeResolver{srvs: map[string][]*net.SRV{
+		"_http._tcp.web.example.com": {
+			{Target: "web-2.example.com.", Port: 8080, Priority: 10, Weight: 5},
+			{Target: "web-1.example.com.", Port: 8080, Priority: 10, Weight: 50},
+			{Target: "web-1.example.com.", Port: 8443, Priority: 20},
+		},
+	}}
+	d := &DNSSRVDiscovery{
+		name:     "consul",
+		records:  []string{"_http._tcp.web.example.com", "_http._tcp.api.example.com"},
+		labels:   map[string]string{"env": "prod"},
+		template: newTestTemplate(t, map[string]interface{}{"name": "{{.Host}}-{{.Port}}-{{.Labels.env}}"}),
+		lookup:   resolver,
+	}
+	check := func(want ...string) {
+		t.Helper()
+		var got []string
+		for _, m := range d.monitors(context.Background()) {
+			if m.Labels["env"] != "prod" {
+				t.Errorf("monitor %s has labels %v, want the provider's", m.Name, m.Labels)
+			}
+			got = append(got, m.Name+" "+m.URL)
+		}
+		if strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Fatalf("monitors = %q, want %q", got, want)
+		}
+	}
+
+	// Targets are sorted, and a record that does not exist has none.
+	check(
+		"web-1.example.com-8080-prod http://web-1.example.com:8080/",
+		"web-1.example.com-8443-prod http://web-1.example.com:8443/",
+		"web-2.example.com-8080-prod http://web-2.example.com:8080/",
+	)
+	if len(d.warned) > 0 {
+		t.Errorf("warned = %v, want nothing", d.warned)
+	}
+
+	// A failed lookup keeps the previous targets of its record.
+	resolver.errs = map[string]error{
+		"_http._tcp.web.example.com": &net.DNSError{Err: "i/o timeout", Name: "_http._tcp.web.example.com", IsTimeout: true},
+	}
+	resolver.srvs["_http._tcp.api.example.com"] = []*net.SRV{{Target: "api.example.com.", Port: 80}}
+	check(
+		"web-1.example.com-8080-prod http://web-1.example.com:8080/",
+		"web-1.example.com-8443-prod http://web-1.example.com:8443/",
+		"web-2.example.com-8080-prod http://web-2.example.com:8080/",
+		"api.example.com-80-prod http://api.example.com:80/",
+	)
+	if _, ok := d.warned["_http._tcp.web.example.com"]; !ok {
+		t.Errorf("failed lookup not reported: %v", d.warned)
+	}
+
+	// A record that no longer exists removes its targets.
+	resolver.errs = nil
+	delete(resolver.srvs, "_http._tcp.web.example.com")
+	check("api.example.com-80-prod http://api.example.com:80/")
+	if len(d.warned) > 0 {
+		t.Errorf("warned = %v, want nothing", d.warned)
+	}
+}
+
+func TestLookupSRV(t *testing.T) {
+	resolver := &fakeResolver{
+		srvs: map[string][]*net.SRV{
+			"_http._tcp.empty.example.com": {},
+			"_http._tcp.web.example.com": {
+				{Target: "b.example.com.", Port: 80},
+				{Target: "a.example.com.", Port: 8080},
+				{Target: "a.example.com.", Port: 80},
+			},
+		},
+		errs: map[string]error{
+			"_http._tcp.broken.example.com": &net.DNSError{Err: "server misbehaving", Name: "_http._tcp.broken.example.com"},
+		},
+	}
+	tests := []struct {
+		record  string
+		want    string
+		wantErr bool
+	}{
+		{"_http._tcp.web.example.com", "a.example.com:80 a.example.com:8080 b.example.com:80", false},
+		{"_http._tcp.empty.example.com", "", false},
+		{"_http._tcp.missing.example.com", "", false},
+		{"_http._tcp.broken.example.com", "", true},
+	}
+	for _, tt := range tests {
+		targets, err := lookupSRV(context.Background(), resolver, tt.record)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("lookupSRV(%s) error = %v, want error %t", tt.record, err, tt.wantErr)
+			continue
+		}
+		if got := strings.Join(targets, " "); got != tt.want {
+			t.Errorf("lookupSRV(%s) = %q, want %q", tt.record, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDockerHost is the Docker Engine API socket used when no host is configured.
+	DefaultDockerHost = "unix:///var/run/docker.sock"
+	// DefaultDockerRefreshInterval is how often the containers are listed again, in case an
+	// event was missed.
+	DefaultDockerRefreshInterval = time.Minute
+	// dockerLabelPrefix starts the container labels that define a monitor, as in "guptime.url".
+	dockerLabelPrefix = "guptime."
+	// dockerRequestTimeout bounds a request to the Docker Engine API, other than the event stream.
+	dockerRequestTimeout = 10 * time.Second
+)
+
+// DockerDiscovery finds monitors in the labels of the running containers of a Docker Engine. A
+// container is monitored if it has a guptime.url label. Its other guptime.* labels are monitor
+// settings as in monitors.json, such as guptime.interval. The slug defaults to the Compose project
+// of the container, or "docker", and the name to the container name. Monitors are added and
+// removed as containers start and stop.
+type DockerDiscovery struct {
+	// Host is the Docker Engine API address, as in DOCKER_HOST: unix:///path, tcp://host:port
+	// or an http(s) URL.
+	Host string
+	// RefreshInterval is how often the containers are listed again besides on container events.
+	RefreshInterval time.Duration
+
+	client  *http.Client
+	baseURL string
+	// warned holds the last problem reported for each container, so that it is logged once.
+	warned map[string]string
+}
+
+// NewDockerDiscovery creates a provider for the Docker Engine at host, or DefaultDockerHost if
+// host is empty. A zero refresh falls back to DefaultDockerRefreshInterval.
+func NewDockerDiscovery(host string, refresh time.Duration) (*DockerDiscovery, error) {
+	if host == "" {
+		host = DefaultDockerHost
+	}
+	if refresh <= 0 {
+		refresh = DefaultDockerRefreshInterval
+	}
+	d := &DockerDiscovery{Host: host, RefreshInterval: refresh, warned: make(map[string]string)}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q: %w", host, err)
+	}
+	// The event stream stays open, so requests are bounded by their context instead of a client timeout.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		d.baseURL = "http://docker"
+	case "tcp":
+		d.baseURL = "http://" + u.Host
+	case "http", "https":
+		d.baseURL = strings.TrimSuffix(host, "/")
+	default:
+		return nil, fmt.Errorf("invalid Docker host %q: expected unix://, tcp://, http:// or https://", host)
+	}
+	d.client = &http.Client{Transport: transport}
+	return d, nil
+}
+
+// Name returns "docker".
+func (d *DockerDiscovery) Name() string {
+	return "docker"
+}
+
+// Run lists the labelled containers, then again on every container start, stop or rename and
+// every RefreshInterval, until ctx is cancelled or the Docker Engine cannot be reached.
+func (d *DockerDiscovery) Run(ctx context.Context, update func([]Monitor)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- d.watchEvents(ctx, changed)
+	}()
+
+	ticker := time.NewTicker(d.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		monitors, err := d.monitors(ctx)
+		if err != nil {
+			return err
+		}
+		update(monitors)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watchErr:
+			return err
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// dockerContainer is a container as listed by the Docker Engine API.
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// monitors lists the running containers with a guptime.url label and builds their monitors.
+// Containers with invalid labels are skipped with a warning.
+func (d *DockerDiscovery) monitors(ctx context.Context) ([]Monitor, error) {
+	ctx, cancel := context.WithTimeout(ctx, dockerRequestTimeout)
+	defer cancel()
+	filters := `{"label":["` + dockerLabelPrefix + `url"]}`
+	resp, err := d.get(ctx, "/containers/json?filters="+url.QueryEscape(filters))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("failed to decode Docker containers: %w", err)
+	}
+
+	monitors := make([]Monitor, 0, len(containers))
+	warned := make(map[string]string, len(d.warned))
+	for _, c := range containers {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		slug := c.Labels["com.docker.compose.project"]
+		if slug == "" {
+			slug = "docker"
+		}
+		m, err := monitorFromLabels(c.Labels, dockerLabelPrefix, map[string]interface{}{"slug": slug, "name": name})
+		if err != nil {
+			warned[c.ID] = err.Error()
+			if d.warned[c.ID] != warned[c.ID] {
+				log.Printf("Warning: Skipping container '%s', its labels are invalid: %v", name, err)
+			}
+			continue
+		}
+		monitors = append(monitors, m)
+	}
+	d.warned = warned
+	return monitors, nil
+}
+
+// watchEvents signals changed whenever a container starts, stops or is renamed, until ctx is
+// cancelled or the event stream ends.
+func (d *DockerDiscovery) watchEvents(ctx context.Context, changed chan<- struct{}) error {
+	filters := `{"type":["container"],"event":["start","die","rename"]}`
+	resp, err := d.get(ctx, "/events?filters="+url.QueryEscape(filters))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event json.RawMessage
+		if err := dec.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				return fmt.Errorf("the Docker event stream ended")
+			}
+			return fmt.Errorf("failed to read Docker events: %w", err)
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// get sends a GET request to the Docker Engine API and checks that it succeeded.
+func (d *DockerDiscovery) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Docker request: %w", err)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Docker at %s: %w", d.Host, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Docker responded to %s with status %d", strings.SplitN(path, "?", 2)[0], resp.StatusCode)
+	}
+	return resp, nil
+}
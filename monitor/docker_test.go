@@ -0,0 +1,173 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker serves the parts of the Docker Engine API that discovery uses: the list of running
+// containers and the event stream.
+type fakeDocker struct {
+	mu         sync.Mutex
+	containers []dockerContainer
+	events     chan string
+}
+
+func newFakeDocker(t *testing.T, containers ...dockerContainer) (*fakeDocker, *httptest.Server) {
+	d := &fakeDocker{containers: containers, events: make(chan string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		listed := []dockerContainer{}
+		for _, c := range d.containers {
+			if _, ok := c.Labels[strings.Join(filters["label"], "")]; ok {
+				listed = append(listed, c)
+			}
+		}
+		json.NewEncoder(w).Encode(listed)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case action := <-d.events:
+				json.NewEncoder(w).Encode(map[string]string{"Type": "container", "Action": action})
+				w.(http.Flusher).Flush()
+			}
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return d, server
+}
+
+// start runs a container and sends its start event.
+func (d *fakeDocker) start(c dockerContainer) {
+	d.mu.Lock()
+	d.containers = append(d.containers, c)
+	d.mu.Unlock()
+	d.events <- "start"
+}
+
+// stop removes a container and sends its die event.
+func (d *fakeDocker) stop(id string) {
+	d.mu.Lock()
+	for i, c := range d.containers {
+		if c.ID == id {
+			d.containers = append(d.containers[:i], d.containers[i+1:]...)
+			break
+		}
+	}
+	d.mu.Unlock()
+	d.events <- "die"
+}
+
+func TestDockerDiscovery(t *testing.T) {
+	docker, server := newFakeDocker(t,
+		dockerContainer{ID: "1", Names: []string{"/shop-web-1"}, Labels: map[string]string{
+			"com.docker.compose.project": "shop",
+			"guptime.url":                "http://web:8080/health",
+			"guptime.interval":           "30s",
+		}},
+		dockerContainer{ID: "2", Names: []string{"/db"}, Labels: map[string]string{"maintainer": "ops"}},
+		dockerContainer{ID: "3", Names: []string{"/broken"}, Labels: map[string]string{"guptime.url": "not a url"}},
+	)
+	d, err := NewDockerDiscovery(server.URL, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []Monitor)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(ctx, func(monitors []Monitor) { updates <- monitors })
+	}()
+	next := func(want ...string) {
+		t.Helper()
+		select {
+		case monitors := <-updates:
+			var got []string
+			for _, m := range monitors {
+				got = append(got, monitorKey(m.Slug, m.Name)+" "+m.URL)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ", ") != strings.Join(want, ", ") {
+				t.Fatalf("monitors = %q, want %q", got, want)
+			}
+		case err := <-done:
+			t.Fatalf("Run stopped: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+		}
+	}
+
+	next("shop/shop-web-1 http://web:8080/health")
+	docker.start(dockerContainer{ID: "4", Names: []string{"/api"}, Labels: map[string]string{
+		"guptime.url":  "http://api/",
+		"guptime.name": "public-api",
+	}})
+	next("docker/public-api http://api/", "shop/shop-web-1 http://web:8080/health")
+	docker.stop("1")
+	next("docker/public-api http://api/")
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestDockerDiscoveryUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	d, err := NewDockerDiscovery(server.URL, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Run(context.Background(), func([]Monitor) { t.Error("update called") })
+	if err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Run = %v, want a status 404 error", err)
+	}
+}
+
+func TestNewDockerDiscoveryHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		baseURL string
+		wantErr bool
+	}{
+		{"", "http://docker", false},
+		{"unix:///run/user/1000/docker.sock", "http://docker", false},
+		{"tcp://10.0.0.1:2375", "http://10.0.0.1:2375", false},
+		{"https://docker.example.com:2376/", "https://docker.example.com:2376", false},
+		{"ssh://docker.example.com", "", true},
+	}
+	for _, tt := range tests {
+		d, err := NewDockerDiscovery(tt.host, 0)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewDockerDiscovery(%q) error = %v, want error %t", tt.host, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (d.baseURL != tt.baseURL || d.RefreshInterval != DefaultDockerRefreshInterval) {
+			t.Errorf("NewDockerDiscovery(%q) = %s every %s, want %s every %s",
+				tt.host, d.baseURL, d.RefreshInterval, tt.baseURL, DefaultDockerRefreshInterval)
+		}
+	}
+}
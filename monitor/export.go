@@ -0,0 +1,307 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of ExportRecord.
+const (
+	RecordMonitor  = "monitor"
+	RecordCheck    = "check"
+	RecordIncident = "incident"
+	RecordRollup   = "rollup"
+)
+
+// ExportedMonitor is a stored monitor, including archived ones.
+type ExportedMonitor struct {
+	ID         string `json:"id"`
+	Slug       string `json:"slug"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	ArchivedAt *int64 `json:"archived_at,omitempty"`
+}
+
+// ExportRecord is one row of exported monitoring data. Kind says which of the other fields is set.
+type ExportRecord struct {
+	Kind string `json:"kind"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+
+	Monitor  *ExportedMonitor `json:"monitor,omitempty"`
+	Check    *MonitorLogEntry `json:"check,omitempty"`
+	Incident *Incident        `json:"incident,omitempty"`
+	// Resolution is the rollup table a Rollup belongs to.
+	Resolution Resolution `json:"resolution,omitempty"`
+	Rollup     *Rollup    `json:"rollup,omitempty"`
+}
+
+// ExportFilter selects the data to export. An empty Slug exports every slug; Start and End
+// bound check timestamps, incident times and rollup buckets. A zero End means now.
+type ExportFilter struct {
+	Slug  string
+	Start int64
+	End   int64
+}
+
+// Export walks the data of a store that matches filter and passes it to fn one record at a time:
+// each monitor is followed by its checks, incidents and rollups, so a monitor is always seen
+// before the data that refers to it.
+func Export(ctx context.Context, store Store, filter ExportFilter, fn func(ExportRecord) error) error {
+	end := filter.End
+	if end == 0 {
+		end = time.Now().Unix()
+	}
+
+	monitors, err := store.ListAllMonitors(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range monitors {
+		if filter.Slug != "" && m.Slug != filter.Slug {
+			continue
+		}
+		m := m
+		if err := fn(ExportRecord{Kind: RecordMonitor, Slug: m.Slug, Name: m.Name, Monitor: &m}); err != nil {
+			return err
+		}
+
+		checks, err := store.ListChecks(ctx, m.Slug, m.Name, filter.Start, end)
+		if err != nil {
+			return err
+		}
+		for i := range checks {
+			if err := fn(ExportRecord{Kind: RecordCheck, Slug: m.Slug, Name: m.Name, Check: &checks[i]}); err != nil {
+				return err
+			}
+		}
+
+		incidents, err := store.Incidents(ctx, m.Slug, m.Name, filter.Start, end)
+		if err != nil {
+			return err
+		}
+		for i := range incidents {
+			if err := fn(ExportRecord{Kind: RecordIncident, Slug: m.Slug, Name: m.Name, Incident: &incidents[i]}); err != nil {
+				return err
+			}
+		}
+
+		for _, res := range resolutions {
+			rollups, err := store.Rollups(ctx, res, m.Slug, m.Name, filter.Start, end+1)
+			if err != nil {
+				return err
+			}
+			for i := range rollups {
+				if err := fn(ExportRecord{Kind: RecordRollup, Slug: m.Slug, Name: m.Name, Resolution: res, Rollup: &rollups[i]}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks that a record names its monitor and carries the data its kind needs.
+func (r ExportRecord) validate() error {
+	if r.Slug == "" || r.Name == "" {
+		return fmt.Errorf("%s record has no slug or name", r.Kind)
+	}
+	switch r.Kind {
+	case RecordMonitor:
+		if r.Monitor == nil {
+			return fmt.Errorf("monitor record for '%s/%s' has no monitor", r.Slug, r.Name)
+		}
+	case RecordCheck:
+		if r.Check == nil {
+			return fmt.Errorf("check record for '%s/%s' has no check", r.Slug, r.Name)
+		}
+	case RecordIncident:
+		if r.Incident == nil {
+			return fmt.Errorf("incident record for '%s/%s' has no incident", r.Slug, r.Name)
+		}
+	case RecordRollup:
+		if r.Rollup == nil {
+			return fmt.Errorf("rollup record for '%s/%s' has no rollup", r.Slug, r.Name)
+		}
+		if r.Resolution != ResolutionMinute && r.Resolution != ResolutionHour && r.Resolution != ResolutionDay {
+			return fmt.Errorf("rollup record for '%s/%s' has unknown resolution '%s'", r.Slug, r.Name, r.Resolution)
+		}
+		if len(r.Rollup.Histogram) != rollupBuckets {
+			return fmt.Errorf("rollup record for '%s/%s' has %d histogram buckets, want %d",
+				r.Slug, r.Name, len(r.Rollup.Histogram), rollupBuckets)
+		}
+	default:
+		return fmt.Errorf("unknown record kind '%s'", r.Kind)
+	}
+	return nil
+}
+
+// ListAllMonitors returns every stored monitor, including archived ones, ordered by slug and name.
+func (s *sqlStore) ListAllMonitors(ctx context.Context) ([]ExportedMonitor, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, slug, name, url, archived_at FROM monitors ORDER BY slug, name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list monitors: %w", err)
+	}
+	defer rows.Close()
+
+	var monitors []ExportedMonitor
+	for rows.Next() {
+		var m ExportedMonitor
+		var archivedAt sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.Slug, &m.Name, &m.URL, &archivedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan monitor: %w", err)
+		}
+		if archivedAt.Valid {
+			m.ArchivedAt = &archivedAt.Int64
+		}
+		monitors = append(monitors, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration for monitors: %w", err)
+	}
+	return monitors, nil
+}
+
+// Import writes exported records in one transaction. It is idempotent: monitors that already
+// exist are kept, checks and incidents are matched by monitor and timestamp, and rollups are
+// only written for buckets the store does not have, so an interrupted import can simply be run
+// again. Imported checks are counted into the rollups like saved ones; since an export lists
+// the checks of a monitor before its rollups, the rollups only add the buckets of checks that
+// are no longer kept, and the data already stored is never replaced.
+func (s *sqlStore) Import(ctx context.Context, records []ExportRecord) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, r := range records {
+		if err := r.validate(); err != nil {
+			return err
+		}
+		switch r.Kind {
+		case RecordMonitor:
+			err = s.importMonitor(ctx, tx, r)
+		case RecordCheck:
+			err = s.importCheck(ctx, tx, r)
+		case RecordIncident:
+			err = s.importIncident(ctx, tx, r)
+		case RecordRollup:
+			err = s.importRollup(ctx, tx, r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import: %w", err)
+	}
+	return nil
+}
+
+// importMonitor adds a monitor unless one with the same slug and name already exists. A monitor
+// whose id is already used by another slug and name cannot be imported, since its data would
+// belong to neither.
+func (s *sqlStore) importMonitor(ctx context.Context, tx *sql.Tx, r ExportRecord) error {
+	id := r.Monitor.ID
+	if id == "" {
+		var err error
+		if id, err = newMonitorID(); err != nil {
+			return err
+		}
+	}
+	var slug, name string
+	err := tx.QueryRowContext(ctx, s.q(`SELECT slug, name FROM monitors WHERE id = ?`), id).Scan(&slug, &name)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("failed to look up monitor id %s: %w", id, err)
+	case slug != r.Slug || name != r.Name:
+		return fmt.Errorf("cannot import monitor '%s/%s': its id %s is already used by '%s/%s'", r.Slug, r.Name, id, slug, name)
+	}
+	_, err = tx.ExecContext(ctx, s.q(`
+		INSERT INTO monitors (id, slug, name, url, archived_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(slug, name) DO NOTHING
+	`), id, r.Slug, r.Name, r.Monitor.URL, r.Monitor.ArchivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to import monitor '%s/%s': %w", r.Slug, r.Name, err)
+	}
+	return nil
+}
+
+// importCheck adds a check unless the monitor already has one at the same timestamp, and
+// counts it into the rollups.
+func (s *sqlStore) importCheck(ctx context.Context, tx *sql.Tx, r ExportRecord) error {
+	var exists int
+	err := tx.QueryRowContext(ctx, s.q(`
+		SELECT COUNT(*) FROM log_entries WHERE monitor_slug = ? AND monitor_name = ? AND timestamp = ?
+	`), r.Slug, r.Name, r.Check.Timestamp).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look up check of '%s/%s': %w", r.Slug, r.Name, err)
+	}
+	if exists > 0 {
+		return nil
+	}
+	return s.insertCheck(ctx, tx, r.Slug, r.Name, *r.Check)
+}
+
+// importIncident adds an incident, or updates the one the monitor already has with the same start.
+func (s *sqlStore) importIncident(ctx context.Context, tx *sql.Tx, r ExportRecord) error {
+	inc := r.Incident
+	result, err := tx.ExecContext(ctx, s.q(`
+		UPDATE incidents SET ended_at = ?, first_error = ?, last_error = ?, check_count = ?
+		WHERE monitor_slug = ? AND monitor_name = ? AND started_at = ?
+	`), inc.EndedAt, inc.FirstError, inc.LastError, inc.CheckCount, r.Slug, r.Name, inc.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to import incident of '%s/%s': %w", r.Slug, r.Name, err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, s.q(`
+		INSERT INTO incidents (monitor_slug, monitor_name, started_at, ended_at, first_error, last_error, check_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`), r.Slug, r.Name, inc.StartedAt, inc.EndedAt, inc.FirstError, inc.LastError, inc.CheckCount)
+	if err != nil {
+		return fmt.Errorf("failed to import incident of '%s/%s': %w", r.Slug, r.Name, err)
+	}
+	return nil
+}
+
+// importRollup adds a rollup bucket unless the store already has it, either from its own
+// checks or from checks imported before it.
+func (s *sqlStore) importRollup(ctx context.Context, tx *sql.Tx, r ExportRecord) error {
+	table := r.Resolution.table()
+	columns := append([]string{"monitor_slug", "monitor_name", "bucket_start", "up_count", "degraded_count",
+		"down_count", "unknown_count", "latency_count", "latency_sum", "latency_min", "latency_max"}, histogramColumns()...)
+	ru := r.Rollup
+	args := []interface{}{r.Slug, r.Name, ru.BucketStart, ru.Up, ru.Degraded, ru.Down, ru.Unknown,
+		ru.LatencyCount, ru.LatencySum, ru.LatencyMin, ru.LatencyMax}
+	for _, count := range ru.Histogram {
+		args = append(args, count)
+	}
+	_, err := tx.ExecContext(ctx, s.q(`
+		INSERT INTO `+table+` (`+strings.Join(columns, ", ")+`)
+		VALUES (`+strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")+`)
+		ON CONFLICT(monitor_slug, monitor_name, bucket_start) DO NOTHING`),
+		args...)
+	if err != nil {
+		return fmt.Errorf("failed to import %s for %s/%s: %w", table, r.Slug, r.Name, err)
+	}
+	return nil
+}
+
+// Backup writes a consistent copy of the SQLite database to path while it stays in use.
+func (s *sqlStore) Backup(ctx context.Context, path string) error {
+	if s.dialect.name != "sqlite" {
+		return fmt.Errorf("backup is not supported for %s; use the database's own tools, such as pg_dump", s.dialect.name)
+	}
+	if _, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to back up database to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// targetGroup is a group of targets that share labels, as in a Prometheus file_sd file.
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// FileDiscovery finds monitors in files of targets written by other tools, in the JSON or YAML
+// format of Prometheus file-based service discovery: a list of groups of targets that share labels.
+//
+//	[{"targets": ["10.0.0.1:8080", "10.0.0.2:8080"], "labels": {"service": "web"}}]
+//
+// Every target is expanded into a monitor from the provider's monitor template. The files are
+// read again every refresh interval; a file that cannot be read keeps its previous targets, and
+// a deleted file removes them.
+type FileDiscovery struct {
+	name            string
+	files           []string
+	refreshInterval time.Duration
+	template        *monitorTemplate
+
+	// groups holds the targets last read from each file.
+	groups map[string][]targetGroup
+	// warned holds the last problem reported for each file and target, so that it is logged once.
+	warned map[string]string
+}
+
+// Name returns the configured name of the provider.
+func (d *FileDiscovery) Name() string {
+	return d.name
+}
+
+// Run reads the target files every refresh interval until ctx is cancelled.
+func (d *FileDiscovery) Run(ctx context.Context, update func([]Monitor)) error {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+	for {
+		update(d.monitors())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// monitors reads the target files and expands their targets. Invalid files and targets are
+// reported once.
+func (d *FileDiscovery) monitors() []Monitor {
+	warned := make(map[string]string, len(d.warned))
+	warn := func(key, format string, args ...interface{}) {
+		warned[key] = fmt.Sprintf(format, args...)
+		if d.warned[key] != warned[key] {
+			log.Printf("Warning: %s", warned[key])
+		}
+	}
+
+	groups := make(map[string][]targetGroup, len(d.groups))
+	for _, pattern := range d.files {
+		// Patterns are checked when the provider is configured.
+		matches, _ := filepath.Glob(pattern)
+		for _, file := range matches {
+			found, err := readTargetGroups(file)
+			if err != nil {
+				if previous, ok := d.groups[file]; ok {
+					groups[file] = previous
+				}
+				warn(file, "%s discovery could not read %s, keeping its previous targets: %v", d.name, file, err)
+				continue
+			}
+			groups[file] = found
+		}
+	}
+	d.groups = groups
+
+	var monitors []Monitor
+	for _, file := range sortedKeys(groups) {
+		for _, group := range groups[file] {
+			for _, target := range group.Targets {
+				m, err := d.template.expand(newDiscoveredTarget(target, group.Labels))
+				if err != nil {
+					warn(file+"/"+target, "Skipping target '%s' of %s: %v", target, file, err)
+					continue
+				}
+				monitors = append(monitors, m)
+			}
+		}
+	}
+	d.warned = warned
+	return monitors
+}
+
+// readTargetGroups reads a file of target groups, checking it as strictly as a monitors file.
+// The error lists every problem found as ConfigErrors.
+func readTargetGroups(file string) ([]targetGroup, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f := &configFile{name: file}
+	doc, err := f.decode(data)
+	if err != nil {
+		return nil, f.errs
+	}
+	if doc == nil {
+		return nil, nil
+	}
+	f.checkValue(nil, doc, reflect.TypeOf([]targetGroup{}))
+	if len(f.errs) > 0 {
+		return nil, f.errs
+	}
+	var groups []targetGroup
+	if err := decodeAs(doc, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
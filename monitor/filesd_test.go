@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileDiscoveryReload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := &FileDiscovery{
+		name:  "web",
+		files: []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yaml")},
+		template: newTestTemplate(t, map[string]interface{}{
+			"name": "{{.Labels.service}}-{{.Host}}",
+			"url":  "http://{{.Target}}/{{.Labels.path}}",
+		}),
+	}
+	check := func(want ...string) {
+		t.Helper()
+		var got []string
+		for _, m := range d.monitors() {
+			got = append(got, monitorKey(m.Slug, m.Name)+" "+m.URL)
+		}
+		if strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Fatalf("monitors = %q, want %q", got, want)
+		}
+	}
+
+	write("a.json", `[{"targets": ["10.0.0.1:8080", "10.0.0.2:8080"], "labels": {"service": "shop"}}]`)
+	write("b.yaml", "- targets: [\"10.0.1.1:80\"]\n  labels: {service: api, path: health}\n")
+	write("ignored.txt", `[{"targets": ["10.0.9.9:80"]}]`)
+	check(
+		"web/shop-10.0.0.1 http://10.0.0.1:8080/",
+		"web/shop-10.0.0.2 http://10.0.0.2:8080/",
+		"web/api-10.0.1.1 http://10.0.1.1:80/health",
+	)
+
+	// A changed file replaces its targets, and an invalid one keeps them.
+	write("a.json", `[{"targets": ["10.0.0.2:8080", "10.0.0.3:8080"], "labels": {"service": "shop"}}]`)
+	write("b.yaml", "- targets: 10.0.1.1:80\n")
+	check(
+		"web/shop-10.0.0.2 http://10.0.0.2:8080/",
+		"web/shop-10.0.0.3 http://10.0.0.3:8080/",
+		"web/api-10.0.1.1 http://10.0.1.1:80/health",
+	)
+	if _, ok := d.warned[filepath.Join(dir, "b.yaml")]; !ok {
+		t.Errorf("invalid file not reported: %v", d.warned)
+	}
+
+	// A deleted file removes its targets, a new file adds them, and invalid targets are skipped.
+	if err := os.Remove(filepath.Join(dir, "a.json")); err != nil {
+		t.Fatal(err)
+	}
+	write("b.yaml", "- targets: [\"10.0.1.1:80\", \"10.0.1.2:80\"]\n  labels: {service: api}\n")
+	write("c.json", `[{"targets": ["10.0.2.1:80", "bad host:80"], "labels": {"service": "db"}}]`)
+	check(
+		"web/api-10.0.1.1 http://10.0.1.1:80/",
+		"web/api-10.0.1.2 http://10.0.1.2:80/",
+		"web/db-10.0.2.1 http://10.0.2.1:80/",
+	)
+	if _, ok := d.warned[filepath.Join(dir, "c.json")+"/bad host:80"]; !ok {
+		t.Errorf("invalid target not reported: %v", d.warned)
+	}
+	if _, ok := d.warned[filepath.Join(dir, "b.yaml")]; ok {
+		t.Errorf("fixed file still reported: %v", d.warned)
+	}
+
+	// A file that becomes empty removes its targets.
+	write("b.yaml", "")
+	write("c.json", "[]")
+	check()
+}
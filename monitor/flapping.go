@@ -0,0 +1,67 @@
+package monitor
+
+const (
+	// DefaultFlapWindow is the number of recent states used for flap detection.
+	DefaultFlapWindow = 21
+	// DefaultFlapLowThreshold is the percent state change below which a flapping monitor is considered stable again.
+	DefaultFlapLowThreshold = 25.0
+	// DefaultFlapHighThreshold is the percent state change above which a monitor is considered to be flapping.
+	DefaultFlapHighThreshold = 50.0
+)
+
+// flapDetector tracks a sliding window of recent states and decides whether a monitor is flapping,
+// in the style of Nagios' percent state change with separate start and stop thresholds.
+type flapDetector struct {
+	window   int
+	low      float64
+	high     float64
+	states   []State
+	flapping bool
+	percent  float64
+}
+
+// observe adds a state to the window, recomputes the percent state change and
+// reports whether the flapping flag changed.
+func (d *flapDetector) observe(state State) bool {
+	d.states = append(d.states, state)
+	if len(d.states) > d.window {
+		d.states = d.states[len(d.states)-d.window:]
+	}
+	d.percent = d.percentStateChange()
+
+	switch {
+	case !d.flapping && d.percent >= d.high:
+		d.flapping = true
+		return true
+	case d.flapping && d.percent < d.low:
+		d.flapping = false
+		return true
+	}
+	return false
+}
+
+// percentStateChange returns the weighted percentage of transitions in the window that changed state.
+// Recent transitions weigh more (1.2) than the oldest ones (0.8). Windows that are not yet full are
+// treated as if the missing transitions were stable, so new monitors are not flagged too eagerly.
+func (d *flapDetector) percentStateChange() float64 {
+	transitions := d.window - 1
+	if transitions < 1 || len(d.states) < 2 {
+		return 0
+	}
+
+	// Align the observed transitions with the newest end of the window.
+	offset := d.window - len(d.states)
+	var changed float64
+	for i := 1; i < len(d.states); i++ {
+		if d.states[i] == d.states[i-1] {
+			continue
+		}
+		position := offset + i - 1 // 0 is the oldest transition in a full window.
+		weight := 0.8
+		if transitions > 1 {
+			weight += 0.4 * float64(position) / float64(transitions-1)
+		}
+		changed += weight
+	}
+	return changed / float64(transitions) * 100
+}
@@ -0,0 +1,67 @@
+package monitor
+
+import "testing"
+
+func TestFlapDetectorHysteresis(t *testing.T) {
+	// With a window of 5 states the 4 transitions weigh 0.8, 0.93, 1.07 and 1.2, so one
+	// change in the newest transition is 30% and two alternating changes are 56.7%.
+	tests := []struct {
+		name   string
+		states string // u is up, d is down
+		want   string // F is flapping after the state, . is not
+	}{
+		{"stable", "uuuuuuu", "......."},
+		{"single change stays below high", "uuuud", "....."},
+		{"starts above high threshold", "uudu", "...F"},
+		{"between thresholds does not start", "uddddddd", "........"},
+		{"between thresholds keeps flapping", "ududuuu", "..FFFFF"},
+		{"stops below low threshold", "udududuuuuu", "..FFFFFFF.."},
+		{"starts again after stopping", "udududuuuuudud", "..FFFFFFF...FF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &flapDetector{window: 5, low: 25, high: 50}
+			flapping := false
+			for i, c := range tt.states {
+				state := StateUp
+				if c == 'd' {
+					state = StateDown
+				}
+				changed := d.observe(state)
+				want := tt.want[i] == 'F'
+				if d.flapping != want {
+					t.Fatalf("after %q: flapping = %t (%.1f%%), want %t", tt.states[:i+1], d.flapping, d.percent, want)
+				}
+				if changed != (want != flapping) {
+					t.Fatalf("after %q: observe = %t, want %t", tt.states[:i+1], changed, want != flapping)
+				}
+				flapping = want
+			}
+		})
+	}
+}
+
+func TestPercentStateChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		window int
+		states []State
+		want   float64
+	}{
+		{"empty", 5, nil, 0},
+		{"one state", 5, []State{StateUp}, 0},
+		{"window of one", 1, []State{StateUp, StateDown}, 0},
+		{"newest change", 5, []State{StateUp, StateDown}, 30},
+		{"oldest change", 5, []State{StateUp, StateDown, StateDown, StateDown, StateDown}, 20},
+		{"every change", 5, []State{StateUp, StateDown, StateUp, StateDown, StateUp}, 100},
+		{"degraded counts as a change", 3, []State{StateUp, StateDegraded, StateDegraded}, 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &flapDetector{window: tt.window, states: tt.states}
+			if got := d.percentStateChange(); got < tt.want-1e-9 || got > tt.want+1e-9 {
+				t.Errorf("percentStateChange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Incident is a period during which a monitor was down.
+type Incident struct {
+	ID         int64  `json:"id"`
+	Slug       string `json:"slug"`
+	Name       string `json:"name"`
+	StartedAt  int64  `json:"started_at"`
+	EndedAt    *int64 `json:"ended_at"`
+	Duration   int64  `json:"duration_seconds"`
+	Ongoing    bool   `json:"ongoing"`
+	FirstError string `json:"first_error"`
+	LastError  string `json:"last_error"`
+	CheckCount int    `json:"check_count"`
+}
+
+// trackIncident opens, extends or closes the monitor's incident based on the state of its latest check.
+// A down check extends the open incident or opens a new one; a recovery closes it. Other states,
+// such as maintenance, leave an open incident untouched.
+func (s *sqlStore) trackIncident(ctx context.Context, tx *sql.Tx, slug, name string, entry MonitorLogEntry) error {
+	switch {
+	case entry.State == StateDown:
+		result, err := tx.ExecContext(ctx, s.q(`
+			UPDATE incidents SET last_error = ?, check_count = check_count + 1
+			WHERE monitor_slug = ? AND monitor_name = ? AND ended_at IS NULL
+		`), incidentError(entry), slug, name)
+		if err != nil {
+			return fmt.Errorf("failed to update incident for %s/%s: %w", slug, name, err)
+		}
+		if n, err := result.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.q(`
+			INSERT INTO incidents (monitor_slug, monitor_name, started_at, first_error, last_error, check_count)
+			VALUES (?, ?, ?, ?, ?, 1)
+		`), slug, name, entry.Timestamp, incidentError(entry), incidentError(entry))
+		if err != nil {
+			return fmt.Errorf("failed to open incident for %s/%s: %w", slug, name, err)
+		}
+	case entry.State.IsAvailable():
+		_, err := tx.ExecContext(ctx, s.q(`
+			UPDATE incidents SET ended_at = ?
+			WHERE monitor_slug = ? AND monitor_name = ? AND ended_at IS NULL
+		`), entry.Timestamp, slug, name)
+		if err != nil {
+			return fmt.Errorf("failed to close incident for %s/%s: %w", slug, name, err)
+		}
+	}
+	return nil
+}
+
+// incidentError describes why a check failed as "class: message". Checks stored before errors
+// were classified only have their response text.
+func incidentError(entry MonitorLogEntry) string {
+	switch {
+	case entry.ErrorMessage == "":
+		return entry.Response
+	case entry.ErrorClass == "":
+		return entry.ErrorMessage
+	default:
+		return string(entry.ErrorClass) + ": " + entry.ErrorMessage
+	}
+}
+
+// GetIncidents returns the incidents of a monitor that overlap a given time range, newest first.
+func (s *Service) GetIncidents(monitorSlug, monitorName string, start, end int64) ([]Incident, error) {
+	if !s.isConfigured(monitorSlug, monitorName) {
+		return nil, fmt.Errorf("monitor '%s/%s' not found in configuration", monitorSlug, monitorName)
+	}
+	return s.store.Incidents(context.Background(), monitorSlug, monitorName, start, end)
+}
+
+// GetSlugIncidents returns the incidents of all monitors under a slug that overlap a given time range, newest first.
+func (s *Service) GetSlugIncidents(slug string, start, end int64) ([]Incident, error) {
+	return s.store.Incidents(context.Background(), slug, "", start, end)
+}
+
+// Incidents returns the incidents overlapping [start, end], newest first, of one monitor or,
+// when name is empty, of every monitor under the slug.
+func (s *sqlStore) Incidents(ctx context.Context, slug, name string, start, end int64) ([]Incident, error) {
+	filter := `monitor_slug = ?`
+	args := []interface{}{slug}
+	if name != "" {
+		filter += ` AND monitor_name = ?`
+		args = append(args, name)
+	}
+	args = append(args, end, start)
+	rows, err := s.db.QueryContext(ctx, s.q(`
+		SELECT id, monitor_slug, monitor_name, started_at, ended_at, first_error, last_error, check_count
+		FROM incidents
+		WHERE `+filter+` AND started_at <= ? AND (ended_at IS NULL OR ended_at >= ?)
+		ORDER BY started_at DESC
+	`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now().Unix()
+	incidents := []Incident{}
+	for rows.Next() {
+		var inc Incident
+		var endedAt sql.NullInt64
+		if err := rows.Scan(&inc.ID, &inc.Slug, &inc.Name, &inc.StartedAt, &endedAt, &inc.FirstError, &inc.LastError, &inc.CheckCount); err != nil {
+			return nil, fmt.Errorf("failed to scan incident: %w", err)
+		}
+		if endedAt.Valid {
+			inc.EndedAt = &endedAt.Int64
+			inc.Duration = endedAt.Int64 - inc.StartedAt
+		} else {
+			inc.Ongoing = true
+			inc.Duration = now - inc.StartedAt
+		}
+		incidents = append(incidents, inc)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration for incidents: %w", err)
+	}
+
+	return incidents, nil
+}
@@ -0,0 +1,273 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// kubernetesAnnotationPrefix starts the annotations that define a monitor, as in "guptime.io/url".
+	kubernetesAnnotationPrefix = "guptime.io/"
+	// kubernetesPathAnnotation is the path checked on the URL derived from a resource.
+	kubernetesPathAnnotation = kubernetesAnnotationPrefix + "path"
+	// kubernetesSettleDelay batches the changes of a burst of events into one update.
+	kubernetesSettleDelay = time.Second
+)
+
+// kubernetesResource is an Ingress or Service that may define a monitor.
+type kubernetesResource struct {
+	kind string
+	metav1.ObjectMeta
+	// url is the URL derived from the resource, or "" if it has none.
+	url string
+}
+
+// ingressURL returns the first host of an Ingress, over HTTPS if its TLS section covers it.
+func ingressURL(ingress *networkingv1.Ingress) string {
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host == "" || strings.HasPrefix(rule.Host, "*") {
+			continue
+		}
+		for _, tls := range ingress.Spec.TLS {
+			for _, host := range tls.Hosts {
+				if host == rule.Host {
+					return "https://" + rule.Host
+				}
+			}
+		}
+		return "http://" + rule.Host
+	}
+	return ""
+}
+
+// serviceURL returns the cluster DNS name of a Service on its first port, over HTTPS for port 443.
+func serviceURL(service *corev1.Service) string {
+	if len(service.Spec.Ports) == 0 {
+		return ""
+	}
+	port := service.Spec.Ports[0].Port
+	scheme := "http"
+	if port == 443 {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s.%s.svc:%d", scheme, service.Name, service.Namespace, port)
+}
+
+// KubernetesDiscovery finds monitors in the annotations of the Ingresses and Services of a
+// Kubernetes cluster. A resource is monitored if it has any guptime.io/* annotation; they are
+// monitor settings as in monitors.json, such as guptime.io/interval. The slug defaults to the
+// namespace and the name to the resource name. The URL defaults to the first host of an Ingress,
+// or the cluster DNS name and first port of a Service, with the path in guptime.io/path.
+// Monitors are added and removed as resources are created, annotated and deleted.
+type KubernetesDiscovery struct {
+	// Namespace limits discovery to one namespace. Empty watches all namespaces.
+	Namespace string
+
+	client kubernetes.Interface
+	// warned holds the last problem reported for each resource, so that it is logged once.
+	warned map[string]string
+}
+
+// NewKubernetesDiscovery creates a provider for the cluster of the kubeconfig files at kubeconfig,
+// a list as in $KUBECONFIG, or, if it is empty, the cluster the service runs in, or else the one
+// of $HOME/.kube/config.
+func NewKubernetesDiscovery(kubeconfig, namespace string) (*KubernetesDiscovery, error) {
+	config, err := kubernetesConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return newKubernetesDiscovery(client, namespace), nil
+}
+
+// newKubernetesDiscovery creates a provider for the cluster of client.
+func newKubernetesDiscovery(client kubernetes.Interface, namespace string) *KubernetesDiscovery {
+	return &KubernetesDiscovery{Namespace: namespace, client: client, warned: make(map[string]string)}
+}
+
+// Name returns "kubernetes".
+func (k *KubernetesDiscovery) Name() string {
+	return "kubernetes"
+}
+
+// kubernetesConfig loads the configuration of the cluster to connect to: the current context of
+// the kubeconfig files at path or, if path is empty, the service account of the pod when running
+// in a cluster and $HOME/.kube/config otherwise.
+func kubernetesConfig(path string) (*rest.Config, error) {
+	if path == "" {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, nil
+		}
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, fmt.Errorf("failed to load the in-cluster Kubernetes configuration: %w", err)
+		}
+	}
+	rules := &clientcmd.ClientConfigLoadingRules{Precedence: filepath.SplitList(path)}
+	if path == "" {
+		rules.Precedence = []string{clientcmd.RecommendedHomeFile}
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return config, nil
+}
+
+// Run watches the Ingresses and Services with informers and calls update with their monitors
+// whenever they change, until ctx is cancelled or they cannot be listed or watched.
+func (k *KubernetesDiscovery) Run(ctx context.Context, update func([]Monitor)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	factory := informers.NewSharedInformerFactoryWithOptions(k.client, 0, informers.WithNamespace(k.Namespace))
+	defer factory.Shutdown()
+	ingresses := factory.Networking().V1().Ingresses()
+	services := factory.Core().V1().Services()
+
+	changed := make(chan struct{}, 1)
+	signal := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { signal() },
+		UpdateFunc: func(interface{}, interface{}) { signal() },
+		DeleteFunc: func(interface{}) { signal() },
+	}
+	// Informers retry failed requests on their own; failures other than the ones they expect end
+	// the run, so that they are reported and the provider is started again.
+	errs := make(chan error, 2)
+	for _, informer := range []struct {
+		plural   string
+		informer cache.SharedIndexInformer
+	}{
+		{"Ingresses", ingresses.Informer()},
+		{"Services", services.Informer()},
+	} {
+		if _, err := informer.informer.AddEventHandler(handler); err != nil {
+			return err
+		}
+		err := informer.informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+			if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) || errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return
+			}
+			select {
+			case errs <- fmt.Errorf("failed to watch Kubernetes %s: %w", informer.plural, err):
+			default:
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	factory.Start(ctx.Done())
+
+	// No update is made before every kind is listed.
+	synced := make(chan bool, 1)
+	go func() {
+		synced <- cache.WaitForCacheSync(ctx.Done(), ingresses.Informer().HasSynced, services.Informer().HasSynced)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errs:
+		return err
+	case <-synced:
+	}
+
+	for {
+		var resources []kubernetesResource
+		list, err := ingresses.Lister().List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, ingress := range list {
+			resources = append(resources, kubernetesResource{"Ingress", ingress.ObjectMeta, ingressURL(ingress)})
+		}
+		serviceList, err := services.Lister().List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, service := range serviceList {
+			resources = append(resources, kubernetesResource{"Service", service.ObjectMeta, serviceURL(service)})
+		}
+		update(k.monitors(resources))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case <-changed:
+		}
+		// Wait for a burst of events to settle before applying it.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(kubernetesSettleDelay):
+		}
+	}
+}
+
+// monitors builds the monitors of the annotated resources. Resources with invalid annotations are
+// skipped with a warning.
+func (k *KubernetesDiscovery) monitors(resources []kubernetesResource) []Monitor {
+	key := func(r kubernetesResource) string {
+		return r.kind + "/" + r.Namespace + "/" + r.Name
+	}
+	sort.Slice(resources, func(i, j int) bool { return key(resources[i]) < key(resources[j]) })
+
+	monitors := make([]Monitor, 0, len(resources))
+	warned := make(map[string]string, len(k.warned))
+	for _, r := range resources {
+		annotations := make(map[string]string, len(r.Annotations))
+		for name, value := range r.Annotations {
+			if strings.HasPrefix(name, kubernetesAnnotationPrefix) && name != kubernetesPathAnnotation {
+				annotations[name] = value
+			}
+		}
+		path, hasPath := r.Annotations[kubernetesPathAnnotation]
+		if len(annotations) == 0 && !hasPath {
+			continue
+		}
+
+		defaults := map[string]interface{}{"slug": r.Namespace, "name": r.Name}
+		if r.url != "" {
+			defaults["url"] = r.url + "/" + strings.TrimPrefix(path, "/")
+		}
+		m, err := monitorFromLabels(annotations, kubernetesAnnotationPrefix, defaults)
+		if err != nil {
+			warned[key(r)] = err.Error()
+			if k.warned[key(r)] != warned[key(r)] {
+				log.Printf("Warning: Skipping %s '%s/%s', its annotations are invalid: %v", r.kind, r.Namespace, r.Name, err)
+			}
+			continue
+		}
+		monitors = append(monitors, m)
+	}
+	k.warned = warned
+	return monitors
+}
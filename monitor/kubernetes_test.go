@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetesDiscovery(t *testing.T) {
+	client := fake.NewClientset(
+		&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Annotations: map[string]string{
+				"guptime.io/path": "/health",
+			}},
+			Spec: networkingv1.IngressSpec{
+				Rules: []networkingv1.IngressRule{{Host: "*.example.com"}, {Host: "shop.example.com"}},
+				TLS:   []networkingv1.IngressTLS{{Hosts: []string{"shop.example.com"}}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop", Annotations: map[string]string{
+				"maintainer": "ops",
+			}},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 5432}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "shop", Annotations: map[string]string{
+				"guptime.io/interval": "often",
+			}},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+	)
+	d := newKubernetesDiscovery(client, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []Monitor)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(ctx, func(monitors []Monitor) { updates <- monitors })
+	}()
+	next := func(want ...string) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			var got []string
+			select {
+			case monitors := <-updates:
+				for _, m := range monitors {
+					got = append(got, monitorKey(m.Slug, m.Name)+" "+m.URL)
+				}
+			case err := <-done:
+				t.Fatalf("Run stopped: %v", err)
+			case <-timeout:
+				t.Fatalf("no update with monitors %q", want)
+			}
+			// Events of one change may be split across updates.
+			sort.Strings(got)
+			if strings.Join(got, ", ") == strings.Join(want, ", ") {
+				return
+			}
+		}
+	}
+
+	next("shop/web https://shop.example.com/health")
+
+	services := client.CoreV1().Services("api")
+	api := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "api", Annotations: map[string]string{
+			"guptime.io/name": "public-api",
+		}},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 443}, {Port: 80}}},
+	}
+	if _, err := services.Create(ctx, api, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	next("api/public-api https://api.api.svc:443/", "shop/web https://shop.example.com/health")
+
+	api.Annotations = map[string]string{"guptime.io/url": "http://api.example.com/ping", "guptime.io/slug": "public"}
+	if _, err := services.Update(ctx, api, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	next("public/api http://api.example.com/ping", "shop/web https://shop.example.com/health")
+
+	api.Annotations = nil
+	if _, err := services.Update(ctx, api, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	next("shop/web https://shop.example.com/health")
+
+	if err := client.NetworkingV1().Ingresses("shop").Delete(ctx, "web", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	next()
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestKubernetesDiscoveryNamespace(t *testing.T) {
+	annotations := map[string]string{"guptime.io/path": "/"}
+	client := fake.NewClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Annotations: annotations},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8080}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "staging", Annotations: annotations},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8080}}},
+		},
+	)
+	d := newKubernetesDiscovery(client, "shop")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	updates := make(chan []Monitor, 1)
+	go d.Run(ctx, func(monitors []Monitor) {
+		select {
+		case updates <- monitors:
+		default:
+		}
+	})
+	select {
+	case monitors := <-updates:
+		if len(monitors) != 1 || monitors[0].URL != "http://web.shop.svc:8080/" {
+			t.Errorf("monitors = %+v, want only http://web.shop.svc:8080/", monitors)
+		}
+	case <-ctx.Done():
+		t.Fatal("no update")
+	}
+}
+
+func TestKubernetesResourceURL(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"ingress without rules", ingressURL(&networkingv1.Ingress{}), ""},
+		{"ingress with only wildcard hosts", ingressURL(&networkingv1.Ingress{Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: ""}, {Host: "*.example.com"}},
+		}}), ""},
+		{"ingress over http", ingressURL(&networkingv1.Ingress{Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "a.example.com"}, {Host: "b.example.com"}},
+			TLS:   []networkingv1.IngressTLS{{Hosts: []string{"b.example.com"}}},
+		}}), "http://a.example.com"},
+		{"service without ports", serviceURL(&corev1.Service{}), ""},
+		{"service on 8080", serviceURL(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8080}, {Port: 443}}},
+		}), "http://web.shop.svc:8080"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: URL = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in milliseconds, of the default latency histogram buckets.
+// Checks slower than the last bound fall into a final unbounded bucket.
+var DefaultLatencyBuckets = []float64{25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// LatencyStats summarises the response times of a monitor's checks, in milliseconds.
+type LatencyStats struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+	// Approximate is set when the percentiles were estimated from rollup histograms.
+	Approximate bool `json:"approximate"`
+}
+
+// exactLatencyWindow is the longest range for which latency percentiles are computed from raw
+// checks. Longer ranges are estimated from the rollups.
+const exactLatencyWindow = 24 * time.Hour
+
+// LatencyBucket is one bucket of a latency histogram. MaxMs is nil for the final, unbounded bucket.
+type LatencyBucket struct {
+	MinMs float64  `json:"min_ms"`
+	MaxMs *float64 `json:"max_ms"`
+	Count int      `json:"count"`
+}
+
+// latencyFilter selects the checks of a monitor that count towards latency statistics:
+// the same checks that count towards uptime.
+const latencyFilter = `monitor_slug = ? AND monitor_name = ? AND timestamp >= ? AND timestamp <= ? AND state IN ('up', 'degraded', 'down')`
+
+// GetLatencyStats returns latency percentiles for a monitor within a given time range.
+// Percentiles use the nearest-rank method and are computed by the database with window functions.
+// Ranges longer than exactLatencyWindow are estimated from the rollup histograms instead.
+func (s *Service) GetLatencyStats(ctx context.Context, monitorSlug, monitorName string, start, end int64) (*LatencyStats, error) {
+	if !s.isConfigured(monitorSlug, monitorName) {
+		return nil, fmt.Errorf("monitor '%s/%s' not found in configuration", monitorSlug, monitorName)
+	}
+	if time.Duration(end-start)*time.Second > exactLatencyWindow {
+		r, err := s.aggregateRange(ctx, monitorSlug, monitorName, start, end+1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate latency percentiles for %s/%s: %w", monitorSlug, monitorName, err)
+		}
+		return r.LatencyStats(), nil
+	}
+	return s.store.LatencyStats(ctx, monitorSlug, monitorName, start, end)
+}
+
+// LatencyStats computes exact nearest-rank latency percentiles with window functions.
+func (s *sqlStore) LatencyStats(ctx context.Context, monitorSlug, monitorName string, start, end int64) (*LatencyStats, error) {
+	// A row number rn is at or above the nearest rank ceil(p*n) exactly when rn >= p*n.
+	var stats LatencyStats
+	err := s.db.QueryRowContext(ctx, s.q(`
+		WITH ranked AS (
+			SELECT time,
+				ROW_NUMBER() OVER (ORDER BY time) AS rn,
+				COUNT(*) OVER () AS n
+			FROM log_entries
+			WHERE `+latencyFilter+`
+		)
+		SELECT
+			COUNT(*),
+			COALESCE(MIN(time), 0),
+			COALESCE(AVG(time), 0),
+			COALESCE(MIN(CASE WHEN rn >= 0.50 * n THEN time END), 0),
+			COALESCE(MIN(CASE WHEN rn >= 0.90 * n THEN time END), 0),
+			COALESCE(MIN(CASE WHEN rn >= 0.95 * n THEN time END), 0),
+			COALESCE(MIN(CASE WHEN rn >= 0.99 * n THEN time END), 0),
+			COALESCE(MAX(time), 0)
+		FROM ranked
+	`), monitorSlug, monitorName, start, end).Scan(
+		&stats.Count, &stats.Min, &stats.Avg, &stats.P50, &stats.P90, &stats.P95, &stats.P99, &stats.Max)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate latency percentiles for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+	return &stats, nil
+}
+
+// GetLatencyHistogram counts a monitor's checks within a given time range into latency buckets.
+// bounds are the upper bounds of the buckets in milliseconds; DefaultLatencyBuckets is used when empty.
+func (s *Service) GetLatencyHistogram(ctx context.Context, monitorSlug, monitorName string, start, end int64, bounds []float64) ([]LatencyBucket, error) {
+	if !s.isConfigured(monitorSlug, monitorName) {
+		return nil, fmt.Errorf("monitor '%s/%s' not found in configuration", monitorSlug, monitorName)
+	}
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+
+	// The rollups already count checks into the default buckets.
+	if equalBounds(bounds, rollupBounds) {
+		r, err := s.aggregateRange(ctx, monitorSlug, monitorName, start, end+1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read latency histogram for %s/%s: %w", monitorSlug, monitorName, err)
+		}
+		histogram := newLatencyHistogram(bounds)
+		for i := range histogram {
+			histogram[i].Count = r.Histogram[i]
+		}
+		return histogram, nil
+	}
+
+	counts, err := s.store.LatencyHistogram(ctx, monitorSlug, monitorName, start, end, bounds)
+	if err != nil {
+		return nil, err
+	}
+	histogram := newLatencyHistogram(bounds)
+	for i := range histogram {
+		histogram[i].Count = counts[i]
+	}
+	return histogram, nil
+}
+
+// LatencyHistogram counts the checks of a monitor into buckets with the given sorted upper bounds
+// plus a final unbounded bucket.
+func (s *sqlStore) LatencyHistogram(ctx context.Context, monitorSlug, monitorName string, start, end int64, bounds []float64) ([]int, error) {
+	// Assign every check a bucket index in the database and count per bucket.
+	var cases strings.Builder
+	args := make([]interface{}, 0, len(bounds)+4)
+	cases.WriteString("CASE")
+	for i, b := range bounds {
+		fmt.Fprintf(&cases, " WHEN time <= ? THEN %d", i)
+		args = append(args, b)
+	}
+	fmt.Fprintf(&cases, " ELSE %d END", len(bounds))
+	args = append(args, monitorSlug, monitorName, start, end)
+
+	rows, err := s.db.QueryContext(ctx, s.q(`
+		SELECT bucket, COUNT(*) FROM (
+			SELECT `+cases.String()+` AS bucket
+			FROM log_entries
+			WHERE `+latencyFilter+`
+		) AS buckets
+		GROUP BY bucket
+	`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latency histogram for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+	defer rows.Close()
+
+	counts := make([]int, len(bounds)+1)
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan latency histogram for %s/%s: %w", monitorSlug, monitorName, err)
+		}
+		if bucket >= 0 && bucket < len(counts) {
+			counts[bucket] = count
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+
+	return counts, nil
+}
+
+// newLatencyHistogram returns empty histogram buckets for the given sorted upper bounds.
+func newLatencyHistogram(bounds []float64) []LatencyBucket {
+	histogram := make([]LatencyBucket, len(bounds)+1)
+	for i := range histogram {
+		if i > 0 {
+			histogram[i].MinMs = bounds[i-1]
+		}
+		if i < len(bounds) {
+			histogram[i].MaxMs = &bounds[i]
+		}
+	}
+	return histogram
+}
+
+// equalBounds reports whether two sets of bucket bounds are identical.
+func equalBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// latencyCases are response times with their nearest-rank percentiles.
+var latencyCases = []struct {
+	name  string
+	times []float64
+	want  LatencyStats // Count, Min, Avg and Max are checked too
+}{
+	{"one check", []float64{42},
+		LatencyStats{Count: 1, Min: 42, Avg: 42, P50: 42, P90: 42, P95: 42, P99: 42, Max: 42}},
+	{"two checks", []float64{20, 10},
+		LatencyStats{Count: 2, Min: 10, Avg: 15, P50: 10, P90: 20, P95: 20, P99: 20, Max: 20}},
+	{"all tied", []float64{100, 100, 100, 100},
+		LatencyStats{Count: 4, Min: 100, Avg: 100, P50: 100, P90: 100, P95: 100, P99: 100, Max: 100}},
+	{"tied median", []float64{30, 20, 10, 20, 20},
+		LatencyStats{Count: 5, Min: 10, Avg: 20, P50: 20, P90: 30, P95: 30, P99: 30, Max: 30}},
+	{"tied tail", []float64{1, 2, 3, 4, 5, 6, 7, 8, 90, 90},
+		LatencyStats{Count: 10, Min: 1, Avg: 21.6, P50: 5, P90: 90, P95: 90, P99: 90, Max: 90}},
+}
+
+func TestLatencyStatsPercentiles(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range latencyCases {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if _, err := store.Migrate(ctx); err != nil {
+				t.Fatalf("Migrate: %v", err)
+			}
+			if err := store.SyncMonitors(ctx, []Monitor{{Slug: "prod", Name: "api", URL: "http://example.com/"}}); err != nil {
+				t.Fatalf("SyncMonitors: %v", err)
+			}
+			for i, ms := range tt.times {
+				entry := MonitorLogEntry{Timestamp: 1000 + int64(i), Time: ms, Response: "200", State: StateUp, IntervalSeconds: 60}
+				if err := store.SaveChecks(ctx, []CheckRecord{{Slug: "prod", Name: "api", Entry: entry}}); err != nil {
+					t.Fatalf("SaveChecks: %v", err)
+				}
+			}
+
+			got, err := store.LatencyStats(ctx, "prod", "api", 1000, 2000)
+			if err != nil {
+				t.Fatalf("LatencyStats: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("LatencyStats = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollupPercentile(t *testing.T) {
+	tests := []struct {
+		name  string
+		times []float64
+		p     float64
+		want  float64
+	}{
+		{"one check", []float64{42}, 50, 42},
+		{"one check at the tail", []float64{42}, 99, 42},
+		{"all tied", []float64{100, 100, 100, 100}, 50, 100},
+		{"all tied at the tail", []float64{100, 100, 100, 100}, 99, 100},
+		{"tied in the unbounded bucket", []float64{20000, 20000}, 90, 20000},
+		// Two checks in the 25-50 bucket: the median rank is halfway into it.
+		{"interpolated", []float64{30, 40}, 50, 35},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRollup(0)
+			for _, ms := range tt.times {
+				r.add(MonitorLogEntry{Time: ms, State: StateUp})
+			}
+			if got := r.Percentile(tt.p); got != tt.want {
+				t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,500 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+const (
+	// SourceFile marks a monitor defined in the configuration files. It can only be changed there.
+	SourceFile = "file"
+	// SourceAPI marks a monitor managed through the API. Its definition is kept in the database.
+	SourceAPI = "api"
+)
+
+var (
+	// ErrMonitorNotFound is returned when a monitor to change does not exist.
+	ErrMonitorNotFound = errors.New("monitor not found")
+	// ErrMonitorExists is returned when a monitor to create would take the name or id of another.
+	ErrMonitorExists = errors.New("monitor already exists")
+	// ErrMonitorReadOnly is returned when a monitor to change is defined in the configuration files.
+	ErrMonitorReadOnly = errors.New("monitor is read-only")
+	// ErrRedactedHeader is returned when a monitor to save has a redacted header value that
+	// cannot be replaced by a current one.
+	ErrRedactedHeader = errors.New("header value is redacted")
+)
+
+// ParseMonitor decodes and validates the JSON definition of a monitor managed through the API, as
+// strictly as a monitor in monitors.json. A source of SourceAPI is accepted, so that a monitor read
+// from the API can be sent back. The error lists every problem found as ConfigErrors.
+func ParseMonitor(data []byte) (Monitor, error) {
+	f := &configFile{line: func(configPath) int { return 0 }}
+	var m Monitor
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		f.errorf(nil, "invalid JSON: %v", err)
+		return m, f.errs
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		f.errorf(nil, "expected a monitor object, got %s", describeValue(v))
+		return m, f.errs
+	}
+
+	f.checkValue(nil, v, reflect.TypeOf(Monitor{}))
+	if len(f.errs) > 0 {
+		return m, f.errs
+	}
+	if err := decodeAs(v, &m); err != nil {
+		f.errorf(nil, "%v", err)
+		return m, f.errs
+	}
+	if m.Source == SourceAPI {
+		m.Source = ""
+	}
+	f.validateMonitor(nil, m)
+	if len(f.errs) > 0 {
+		return m, f.errs
+	}
+	return m, nil
+}
+
+// combineConfig combines the monitors of the configuration files with the ones managed through the
+// API and the ones found by discovery providers, and resolves the result, locating its problems at
+// source. Monitors in the files take precedence over managed monitors, which take precedence over
+// discovered ones: a monitor with the same slug and name or id as one from an earlier source is
+// skipped until that one is removed.
+func (s *Service) combineConfig(file *monitorsFile, managed []Monitor, discovered map[string][]Monitor, source string) (*monitorsFile, error) {
+	config := &monitorsFile{
+		Monitors:  make([]Monitor, 0, len(file.Monitors)+len(managed)),
+		SLOs:      file.SLOs,
+		Retention: file.Retention,
+	}
+	keys := make(map[string]string, len(file.Monitors)+len(managed))
+	ids := make(map[string]string, len(file.Monitors)+len(managed))
+	add := func(m Monitor, source string) {
+		m.Source = source
+		config.Monitors = append(config.Monitors, m)
+		keys[monitorKey(m.Slug, m.Name)] = source
+		if m.ID != "" {
+			ids[m.ID] = source
+		}
+	}
+	// shadowed reports whether a monitor is skipped for one from an earlier source.
+	shadowed := func(m Monitor, source string) bool {
+		key := monitorKey(m.Slug, m.Name)
+		other, ok := keys[key]
+		if !ok && m.ID != "" {
+			other, ok = ids[m.ID]
+		}
+		if ok {
+			log.Printf("Warning: Monitor '%s' from %s is not run: a monitor with the same name or id comes from %s.", key, source, other)
+		}
+		return ok
+	}
+
+	for _, m := range file.Monitors {
+		add(m, SourceFile)
+	}
+	var errs ConfigErrors
+	for _, m := range managed {
+		key := monitorKey(m.Slug, m.Name)
+		if keys[key] == SourceAPI {
+			errs = append(errs, ConfigError{File: source, Message: fmt.Sprintf("monitor '%s' is defined more than once", key)})
+			continue
+		}
+		if !shadowed(m, SourceAPI) {
+			add(m, SourceAPI)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	for _, provider := range sortedKeys(discovered) {
+		for _, m := range discovered[provider] {
+			if !shadowed(m, provider) {
+				add(m, provider)
+			}
+		}
+	}
+
+	if err := resolveConfig(config, s.retention, source); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// definedOutsideAPI says where a monitor with the given slug and name, or id if not empty, is
+// defined if that is not through the API: in the configuration files or by a discovery provider.
+// Callers hold reloadMu.
+func (s *Service) definedOutsideAPI(key, id string) (string, bool) {
+	for _, m := range s.fileConfig.Monitors {
+		if monitorKey(m.Slug, m.Name) == key || (id != "" && m.ID == id) {
+			return "in " + s.configPath, true
+		}
+	}
+	for _, provider := range sortedKeys(s.discovered) {
+		for _, m := range s.discovered[provider] {
+			if monitorKey(m.Slug, m.Name) == key || (id != "" && m.ID == id) {
+				return "by " + provider + " discovery", true
+			}
+		}
+	}
+	return "", false
+}
+
+// changeManaged applies change to a copy of the monitors managed through the API, then stores the
+// result and applies it to the running service. If the result is invalid or cannot be applied,
+// nothing is changed. A dry run only validates the result.
+func (s *Service) changeManaged(ctx context.Context, dryRun bool, change func(managed []Monitor) ([]Monitor, error)) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.runCtx == nil || s.runCtx.Err() != nil {
+		return fmt.Errorf("the monitoring service is not running")
+	}
+
+	managed := make([]Monitor, len(s.managed))
+	copy(managed, s.managed)
+	managed, err := change(managed)
+	if err != nil {
+		return err
+	}
+	config, err := s.combineConfig(s.fileConfig, managed, s.discovered, "")
+	if err != nil || dryRun {
+		return err
+	}
+
+	if err := s.store.ReplaceManagedMonitors(ctx, managed); err != nil {
+		return err
+	}
+	if _, err := s.applyConfig(ctx, config); err != nil {
+		if restoreErr := s.store.ReplaceManagedMonitors(context.WithoutCancel(ctx), s.managed); restoreErr != nil {
+			log.Printf("Error: Failed to restore the monitors managed through the API: %v", restoreErr)
+		}
+		return err
+	}
+	s.managed = managed
+	return nil
+}
+
+// findManaged returns the index of the managed monitor with the given slug and name. A monitor
+// defined in the configuration files or discovered is reported as ErrMonitorReadOnly. Callers
+// hold reloadMu.
+func (s *Service) findManaged(managed []Monitor, slug, name string) (int, error) {
+	key := monitorKey(slug, name)
+	if where, ok := s.definedOutsideAPI(key, ""); ok {
+		return -1, fmt.Errorf("%w: '%s' is defined %s", ErrMonitorReadOnly, key, where)
+	}
+	for i, m := range managed {
+		if monitorKey(m.Slug, m.Name) == key {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%w: '%s'", ErrMonitorNotFound, key)
+}
+
+// checkAvailable returns ErrMonitorExists if another monitor than managed[self] already has the
+// slug and name or the id of m. Callers hold reloadMu.
+func (s *Service) checkAvailable(managed []Monitor, self int, m Monitor) error {
+	key := monitorKey(m.Slug, m.Name)
+	if where, ok := s.definedOutsideAPI(key, m.ID); ok {
+		return fmt.Errorf("%w: a monitor with the name or id of '%s' is defined %s", ErrMonitorExists, key, where)
+	}
+	for i, other := range managed {
+		if i != self && (monitorKey(other.Slug, other.Name) == key || other.ID == m.ID) {
+			return fmt.Errorf("%w: '%s' has the same name or id", ErrMonitorExists, monitorKey(other.Slug, other.Name))
+		}
+	}
+	return nil
+}
+
+// keepRedactedHeaders replaces header values that were redacted by the API with their current
+// values in a copy of its headers, so that a monitor read from the API can be sent back unchanged.
+// A redacted value for a header without a current value returns ErrRedactedHeader.
+func keepRedactedHeaders(m *Monitor, current Monitor) error {
+	if len(m.Headers) == 0 {
+		return nil
+	}
+	headers := make(map[string]string, len(m.Headers))
+	for key, value := range m.Headers {
+		if value == redactedValue {
+			currentValue, ok := current.Headers[key]
+			if !ok {
+				return fmt.Errorf("%w: monitor '%s' has no current value for header '%s'", ErrRedactedHeader, monitorKey(m.Slug, m.Name), key)
+			}
+			value = currentValue
+		}
+		headers[key] = value
+	}
+	m.Headers = headers
+	return nil
+}
+
+// CreateMonitor adds a monitor managed through the API and starts it. A random id is assigned
+// unless one is given. History left under the monitor's name, for example by a deleted monitor,
+// is picked up again.
+func (s *Service) CreateMonitor(ctx context.Context, m Monitor) (Monitor, error) {
+	err := s.changeManaged(ctx, false, func(managed []Monitor) ([]Monitor, error) {
+		if err := s.checkAvailable(managed, -1, m); err != nil {
+			return nil, err
+		}
+		if err := keepRedactedHeaders(&m, Monitor{}); err != nil {
+			return nil, err
+		}
+		if m.ID == "" {
+			var err error
+			if m.ID, err = newMonitorID(); err != nil {
+				return nil, err
+			}
+		}
+		return append(managed, m), nil
+	})
+	if err != nil {
+		return Monitor{}, err
+	}
+	log.Printf("Monitor '%s/%s' was created through the API.", m.Slug, m.Name)
+	m.Source = SourceAPI
+	return m.redacted(), nil
+}
+
+// UpdateMonitor replaces the definition of a monitor managed through the API and restarts it. The
+// monitor may be given a new slug and name, in which case its history follows it; its id cannot
+// be changed.
+func (s *Service) UpdateMonitor(ctx context.Context, slug, name string, m Monitor) (Monitor, error) {
+	err := s.changeManaged(ctx, false, func(managed []Monitor) ([]Monitor, error) {
+		i, err := s.findManaged(managed, slug, name)
+		if err != nil {
+			return nil, err
+		}
+		current := managed[i]
+		if m.ID == "" {
+			m.ID = current.ID
+		} else if m.ID != current.ID {
+			return nil, ConfigErrors{{Message: fmt.Sprintf("monitor '%s': id cannot be changed from '%s'", monitorKey(slug, name), current.ID)}}
+		}
+		if err := s.checkAvailable(managed, i, m); err != nil {
+			return nil, err
+		}
+		if err := keepRedactedHeaders(&m, current); err != nil {
+			return nil, err
+		}
+		managed[i] = m
+		return managed, nil
+	})
+	if err != nil {
+		return Monitor{}, err
+	}
+	log.Printf("Monitor '%s/%s' was updated through the API.", m.Slug, m.Name)
+	m.Source = SourceAPI
+	return m.redacted(), nil
+}
+
+// PatchMonitor applies a JSON merge patch (RFC 7386) to the definition of a monitor managed
+// through the API and restarts it: keys in the patch replace the current settings, objects such
+// as headers are merged and null removes a setting.
+func (s *Service) PatchMonitor(ctx context.Context, slug, name string, patch []byte) (Monitor, error) {
+	var changes interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return Monitor{}, ConfigErrors{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	var m Monitor
+	err := s.changeManaged(ctx, false, func(managed []Monitor) ([]Monitor, error) {
+		i, err := s.findManaged(managed, slug, name)
+		if err != nil {
+			return nil, err
+		}
+		current := managed[i]
+		var definition interface{}
+		encoded, err := json.Marshal(current)
+		if err == nil {
+			err = json.Unmarshal(encoded, &definition)
+		}
+		if err == nil {
+			encoded, err = json.Marshal(mergePatch(definition, changes))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to patch monitor '%s': %w", monitorKey(slug, name), err)
+		}
+		if m, err = ParseMonitor(encoded); err != nil {
+			return nil, err
+		}
+		if m.ID != current.ID {
+			return nil, ConfigErrors{{Message: fmt.Sprintf("monitor '%s': id cannot be changed from '%s'", monitorKey(slug, name), current.ID)}}
+		}
+		if err := s.checkAvailable(managed, i, m); err != nil {
+			return nil, err
+		}
+		if err := keepRedactedHeaders(&m, current); err != nil {
+			return nil, err
+		}
+		managed[i] = m
+		return managed, nil
+	})
+	if err != nil {
+		return Monitor{}, err
+	}
+	log.Printf("Monitor '%s/%s' was updated through the API.", m.Slug, m.Name)
+	m.Source = SourceAPI
+	return m.redacted(), nil
+}
+
+// mergePatch applies a JSON merge patch to a decoded JSON value.
+func mergePatch(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	merged, ok := target.(map[string]interface{})
+	if !ok {
+		merged = make(map[string]interface{}, len(changes))
+	}
+	for k, v := range changes {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = mergePatch(merged[k], v)
+	}
+	return merged
+}
+
+// SetMonitorPaused pauses or resumes a monitor managed through the API.
+func (s *Service) SetMonitorPaused(ctx context.Context, slug, name string, paused bool) (Monitor, error) {
+	var m Monitor
+	err := s.changeManaged(ctx, false, func(managed []Monitor) ([]Monitor, error) {
+		i, err := s.findManaged(managed, slug, name)
+		if err != nil {
+			return nil, err
+		}
+		managed[i].Paused = paused
+		m = managed[i]
+		return managed, nil
+	})
+	if err != nil {
+		return Monitor{}, err
+	}
+	if paused {
+		log.Printf("Monitor '%s/%s' was paused through the API.", slug, name)
+	} else {
+		log.Printf("Monitor '%s/%s' was resumed through the API.", slug, name)
+	}
+	m.Source = SourceAPI
+	return m.redacted(), nil
+}
+
+// DeleteMonitor stops a monitor managed through the API and removes its definition. Its history
+// is archived, as for a monitor removed from monitors.json.
+func (s *Service) DeleteMonitor(ctx context.Context, slug, name string) error {
+	err := s.changeManaged(ctx, false, func(managed []Monitor) ([]Monitor, error) {
+		i, err := s.findManaged(managed, slug, name)
+		if err != nil {
+			return nil, err
+		}
+		return append(managed[:i], managed[i+1:]...), nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Monitor '%s/%s' was deleted through the API.", slug, name)
+	return nil
+}
+
+// ManagedMonitors returns the definitions of the monitors managed through the API, oldest first.
+func (s *sqlStore) ManagedMonitors(ctx context.Context) ([]Monitor, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, definition FROM managed_monitors ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query managed monitors: %w", err)
+	}
+	defer rows.Close()
+
+	var monitors []Monitor
+	for rows.Next() {
+		var id, definition string
+		if err := rows.Scan(&id, &definition); err != nil {
+			return nil, fmt.Errorf("failed to scan managed monitor: %w", err)
+		}
+		var m Monitor
+		if err := json.Unmarshal([]byte(definition), &m); err != nil {
+			return nil, fmt.Errorf("failed to decode managed monitor '%s': %w", id, err)
+		}
+		m.ID = id
+		monitors = append(monitors, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration for managed monitors: %w", err)
+	}
+	return monitors, nil
+}
+
+// ReplaceManagedMonitors stores the given definitions and deletes all others. Unchanged
+// definitions keep their update time.
+func (s *sqlStore) ReplaceManagedMonitors(ctx context.Context, monitors []Monitor) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, definition FROM managed_monitors`)
+	if err != nil {
+		return fmt.Errorf("failed to read managed monitors: %w", err)
+	}
+	stored := make(map[string]string)
+	for rows.Next() {
+		var id, definition string
+		if err := rows.Scan(&id, &definition); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan managed monitor: %w", err)
+		}
+		stored[id] = definition
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("error during rows iteration for managed monitors: %w", err)
+	}
+	rows.Close()
+
+	now := time.Now().Unix()
+	for _, m := range monitors {
+		if m.ID == "" {
+			return fmt.Errorf("managed monitor '%s/%s' has no id", m.Slug, m.Name)
+		}
+		id := m.ID
+		m.ID, m.Source = "", ""
+		encoded, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to encode managed monitor '%s/%s': %w", m.Slug, m.Name, err)
+		}
+		definition := string(encoded)
+
+		previous, ok := stored[id]
+		delete(stored, id)
+		switch {
+		case !ok:
+			_, err = tx.ExecContext(ctx, s.q(`INSERT INTO managed_monitors (id, definition, created_at, updated_at) VALUES (?, ?, ?, ?)`),
+				id, definition, now, now)
+		case previous != definition:
+			_, err = tx.ExecContext(ctx, s.q(`UPDATE managed_monitors SET definition = ?, updated_at = ? WHERE id = ?`),
+				definition, now, id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to store managed monitor '%s/%s': %w", m.Slug, m.Name, err)
+		}
+	}
+	for id := range stored {
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM managed_monitors WHERE id = ?`), id); err != nil {
+			return fmt.Errorf("failed to delete managed monitor '%s': %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit managed monitors: %w", err)
+	}
+	return nil
+}
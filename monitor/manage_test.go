@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestKeepRedactedHeaders(t *testing.T) {
+	current := Monitor{Slug: "prod", Name: "api", Headers: map[string]string{"Authorization": "Bearer secret"}}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"no headers", nil, nil, false},
+		{"redacted value is kept", map[string]string{"Authorization": redactedValue}, map[string]string{"Authorization": "Bearer secret"}, false},
+		{"new value replaces it", map[string]string{"Authorization": "Bearer new"}, map[string]string{"Authorization": "Bearer new"}, false},
+		{"redacted value of a new header", map[string]string{"Authorization": redactedValue, "X-Token": redactedValue}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Monitor{Slug: "prod", Name: "api", Headers: tt.headers}
+			err := keepRedactedHeaders(&m, current)
+			if tt.wantErr {
+				if !errors.Is(err, ErrRedactedHeader) {
+					t.Errorf("error = %v, want ErrRedactedHeader", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("keepRedactedHeaders: %v", err)
+			}
+			if !reflect.DeepEqual(m.Headers, tt.want) {
+				t.Errorf("headers = %v, want %v", m.Headers, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagedMonitorRedactedHeaders(t *testing.T) {
+	ctx := context.Background()
+	site := newTestSite(t)
+	s := startTestService(t, `[]`, Config{})
+
+	m := Monitor{Slug: "prod", Name: "api", URL: site.URL, Headers: map[string]string{"X-Token": redactedValue}}
+	if _, err := s.CreateMonitor(ctx, m); !errors.Is(err, ErrRedactedHeader) {
+		t.Fatalf("CreateMonitor with a redacted header: error = %v, want ErrRedactedHeader", err)
+	}
+	m.Headers = map[string]string{"Authorization": "Bearer secret"}
+	created, err := s.CreateMonitor(ctx, m)
+	if err != nil {
+		t.Fatalf("CreateMonitor: %v", err)
+	}
+
+	// A monitor read from the API can be sent back unchanged.
+	created.Source = ""
+	if _, err := s.UpdateMonitor(ctx, "prod", "api", created); err != nil {
+		t.Fatalf("UpdateMonitor with its redacted header: %v", err)
+	}
+	if got := s.managed[0].Headers["Authorization"]; got != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the current value kept", got)
+	}
+
+	created.Headers["X-Token"] = redactedValue
+	if _, err := s.UpdateMonitor(ctx, "prod", "api", created); !errors.Is(err, ErrRedactedHeader) {
+		t.Errorf("UpdateMonitor with a new redacted header: error = %v, want ErrRedactedHeader", err)
+	}
+	if _, err := s.PatchMonitor(ctx, "prod", "api", []byte(`{"headers": {"X-Token": "<redacted>"}}`)); !errors.Is(err, ErrRedactedHeader) {
+		t.Errorf("PatchMonitor with a new redacted header: error = %v, want ErrRedactedHeader", err)
+	}
+	if _, ok := s.managed[0].Headers["X-Token"]; ok {
+		t.Error("a rejected change stored X-Token")
+	}
+}
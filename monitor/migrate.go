@@ -0,0 +1,456 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// embeddedMigrations holds the versioned schema migrations, one directory per database. Each
+// version has a NNNN_name.up.sql file and a NNNN_name.down.sql file that reverts it.
+//
+//go:embed migrations/*/*.sql
+var embeddedMigrations embed.FS
+
+// baselineVersion is the migration that creates the schema as it was before migrations were
+// versioned. Databases created earlier are brought up to it by upgradeLegacySchema instead.
+const baselineVersion = 1
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration has been applied to a database.
+type MigrationStatus struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	AppliedAt int64  `json:"applied_at,omitempty"`
+}
+
+// loadMigrations reads the migrations in dir, ordered by version.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration file '%s' must be named NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+		number, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration file '%s' does not start with a version number", file)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration '%s': %w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has files with different names: '%s' and '%s'", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// tableExists reports whether the database has a table with the given name.
+func (s *sqlStore) tableExists(ctx context.Context, table string) (bool, error) {
+	var n int
+	if err := s.db.QueryRowContext(ctx, s.q(s.dialect.tableExists), table).Scan(&n); err != nil {
+		return false, fmt.Errorf("error checking for table %s: %w", table, err)
+	}
+	return n > 0, nil
+}
+
+// prepareMigrations creates the schema_migrations table if needed and returns the applied
+// versions with the time they were applied. A database created before migrations were versioned
+// is upgraded to the baseline schema and recorded as being at the baseline version, in the same
+// transaction, so that an interrupted upgrade leaves the database as it was.
+func (s *sqlStore) prepareMigrations(ctx context.Context, conn *sql.Conn) (map[int]int64, error) {
+	tracked, err := s.tableExists(ctx, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if !tracked {
+		legacy := false
+		if s.dialect.upgradeLegacy != nil {
+			if legacy, err = s.tableExists(ctx, "monitors"); err != nil {
+				return nil, err
+			}
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+		if legacy {
+			log.Println("Upgrading database created before versioned migrations...")
+			if err := s.dialect.upgradeLegacy(ctx, s, tx); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			CREATE TABLE schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at BIGINT NOT NULL
+			);
+		`); err != nil {
+			return nil, fmt.Errorf("error creating schema_migrations table: %w", err)
+		}
+		if legacy {
+			if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+				baselineVersion, "baseline", time.Now().Unix()); err != nil {
+				return nil, fmt.Errorf("error recording baseline migration: %w", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit schema_migrations: %w", err)
+		}
+	}
+
+	return s.appliedMigrations(ctx)
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations with the time they were applied.
+func (s *sqlStore) appliedMigrations(ctx context.Context) (map[int]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("error scanning schema_migrations: %w", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// withMigrationLock runs fn on a dedicated connection while holding the dialect's migration lock,
+// so that several instances sharing a database do not migrate it at the same time.
+func (s *sqlStore) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if s.dialect.lockMigrations != "" {
+		if _, err := conn.ExecContext(ctx, s.dialect.lockMigrations); err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), s.dialect.unlockMigrations)
+	}
+	return fn(conn)
+}
+
+// Migrate applies every pending migration in order, each in its own transaction.
+func (s *sqlStore) Migrate(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations(embeddedMigrations, s.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := s.prepareMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := s.runMigration(ctx, conn, m.up, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().Unix()); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Applied migration %d_%s.", m.Version, m.Name)
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDownTo reverts applied migrations newer than version, newest first.
+func (s *sqlStore) MigrateDownTo(ctx context.Context, version int) ([]Migration, error) {
+	migrations, err := loadMigrations(embeddedMigrations, s.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := s.prepareMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if m.Version <= version {
+				break
+			}
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted: it has no down file", m.Version, m.Name)
+			}
+			if err := s.runMigration(ctx, conn, m.down, `DELETE FROM schema_migrations WHERE version = ?`, m.Version); err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Reverted migration %d_%s.", m.Version, m.Name)
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// runMigration executes a migration script and the statement recording it in one transaction.
+func (s *sqlStore) runMigration(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q(record), args...); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	return tx.Commit()
+}
+
+// MigrationStatus lists every known migration and whether it has been applied. The database is
+// not modified; a database created before versioned migrations is reported at the baseline.
+func (s *sqlStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(embeddedMigrations, s.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]int64)
+	tracked, err := s.tableExists(ctx, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if tracked {
+		if applied, err = s.appliedMigrations(ctx); err != nil {
+			return nil, err
+		}
+	} else if s.dialect.upgradeLegacy != nil {
+		legacy, err := s.tableExists(ctx, "monitors")
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			applied[baselineVersion] = 0
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		statuses = append(statuses, MigrationStatus{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+// upgradeLegacySchema brings a SQLite database created before versioned migrations up to the
+// baseline schema within tx. Such databases may be missing columns, tables and indexes that were
+// added over time.
+func upgradeLegacySchema(ctx context.Context, s *sqlStore, tx *sql.Tx) error {
+	// Create 'monitors' table if it doesn't exist.
+	// Added 'slug' field and a composite primary key (slug, name) for uniqueness.
+	_, err := tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS monitors (
+            slug TEXT NOT NULL,
+            name TEXT NOT NULL,
+            url TEXT NOT NULL,
+            id TEXT,
+            archived_at INTEGER,
+            PRIMARY KEY (slug, name)
+        );
+    `)
+	if err != nil {
+		return fmt.Errorf("error creating monitors table: %w", err)
+	}
+
+	if err := ensureMonitorIDs(ctx, tx); err != nil {
+		return err
+	}
+
+	// Create 'log_entries' table if it doesn't exist.
+	// Updated FOREIGN KEY to reference both slug and name from the monitors table.
+	_, err = tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS log_entries (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            monitor_slug TEXT NOT NULL,
+            monitor_name TEXT NOT NULL,
+            timestamp INTEGER NOT NULL,
+            time REAL NOT NULL,
+            response TEXT NOT NULL,
+            interval_seconds INTEGER NOT NULL DEFAULT 0,
+            state TEXT NOT NULL DEFAULT '',
+            rolled_up INTEGER NOT NULL DEFAULT 0,
+            FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON DELETE CASCADE
+        );
+    `)
+	if err != nil {
+		return fmt.Errorf("error creating log_entries table: %w", err)
+	}
+
+	// Databases created before per-entry intervals were recorded lack this column.
+	if _, err := ensureColumn(ctx, tx, "log_entries", "interval_seconds", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// The state column was added later; derive it for older rows from their raw response.
+	added, err := ensureColumn(ctx, tx, "log_entries", "state", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	if added {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE log_entries
+			SET state = CASE WHEN response LIKE '2%' THEN 'up' ELSE 'down' END
+			WHERE state = ''
+		`); err != nil {
+			return fmt.Errorf("error backfilling log entry states: %w", err)
+		}
+	}
+
+	// Entries saved before rolled_up was tracked were already counted into the rollups
+	// if the rollup tables exist.
+	added, err = ensureColumn(ctx, tx, "log_entries", "rolled_up", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	if added {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE log_entries SET rolled_up = 1
+			WHERE EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'rollups_minute')
+		`); err != nil {
+			return fmt.Errorf("error marking log entries as rolled up: %w", err)
+		}
+	}
+
+	// Create indexes to improve query performance on the log_entries table.
+	// Updated index to include monitor_slug as well.
+	_, err = tx.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_log_entries_monitor_slug_name_timestamp ON log_entries (monitor_slug, monitor_name, timestamp);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating index on log_entries: %w", err)
+	}
+
+	// Create the 'incidents' table and its index if they don't exist.
+	_, err = tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS incidents (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            monitor_slug TEXT NOT NULL,
+            monitor_name TEXT NOT NULL,
+            started_at INTEGER NOT NULL,
+            ended_at INTEGER,
+            first_error TEXT NOT NULL,
+            last_error TEXT NOT NULL,
+            check_count INTEGER NOT NULL DEFAULT 1,
+            FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON DELETE CASCADE
+        );
+    `)
+	if err != nil {
+		return fmt.Errorf("error creating incidents table: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_incidents_monitor_slug_name_started_at ON incidents (monitor_slug, monitor_name, started_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating index on incidents: %w", err)
+	}
+
+	return createRollupTables(ctx, s, tx)
+}
+
+// ensureColumn adds a column to an existing table if it is not already present,
+// reporting whether the column was added.
+func ensureColumn(ctx context.Context, tx *sql.Tx, table, column, definition string) (bool, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("error reading columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, fmt.Errorf("error scanning columns of %s: %w", table, err)
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("error reading columns of %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return false, fmt.Errorf("error adding column %s to %s: %w", column, table, err)
+	}
+	log.Printf("Added column '%s' to table '%s'.", column, table)
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// legacySchema is a database as created before states, ids, incidents and rollups were stored.
+const legacySchema = `
+	CREATE TABLE monitors (
+		slug TEXT NOT NULL,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		PRIMARY KEY (slug, name)
+	);
+	CREATE TABLE log_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		monitor_slug TEXT NOT NULL,
+		monitor_name TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		time REAL NOT NULL,
+		response TEXT NOT NULL,
+		FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON DELETE CASCADE
+	);
+	INSERT INTO monitors (slug, name, url) VALUES ('prod', 'api', 'https://api.example.com');
+	INSERT INTO log_entries (monitor_slug, monitor_name, timestamp, time, response)
+	VALUES ('prod', 'api', 1700000000, 120, '200 OK'), ('prod', 'api', 1700000030, 0, 'Error: timeout');
+`
+
+// openLegacyStore creates a SQLite database with the given schema and opens it as a store.
+func openLegacyStore(t *testing.T, schema string) *sqlStore {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store.(*sqlStore)
+}
+
+// hasColumn reports whether a SQLite table has a column.
+func hasColumn(t *testing.T, s *sqlStore, table, column string) bool {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestUpgradeLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	s := openLegacyStore(t, legacySchema)
+	applied, err := s.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(applied) == 0 || applied[0].Version != baselineVersion+1 {
+		t.Errorf("Migrate applied %+v, want the migrations after the baseline", applied)
+	}
+
+	checks, err := s.ListChecks(ctx, "prod", "api", 1700000000, 1700000060)
+	if err != nil {
+		t.Fatalf("ListChecks: %v", err)
+	}
+	if len(checks) != 2 || checks[0].State != StateUp || checks[1].State != StateDown {
+		t.Errorf("checks = %+v, want their states derived from the responses", checks)
+	}
+	monitors, err := s.ListAllMonitors(ctx)
+	if err != nil || len(monitors) != 1 || monitors[0].ID == "" {
+		t.Errorf("monitors = %+v, %v; want api with an id", monitors, err)
+	}
+	minutes, err := s.Rollups(ctx, ResolutionMinute, "prod", "api", 1700000000-60, 1700000060)
+	if err != nil || len(minutes) != 1 || minutes[0].Up != 1 || minutes[0].Down != 1 {
+		t.Errorf("minute rollups = %+v, %v; want both checks backfilled", minutes, err)
+	}
+
+	statuses, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("migration %d is not applied", status.Version)
+		}
+	}
+}
+
+func TestUpgradeLegacySchemaRollsBack(t *testing.T) {
+	// Two monitors with the same id make the upgrade fail after it has added columns.
+	s := openLegacyStore(t, `
+		CREATE TABLE monitors (slug TEXT NOT NULL, name TEXT NOT NULL, url TEXT NOT NULL, id TEXT, PRIMARY KEY (slug, name));
+		CREATE TABLE log_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			monitor_slug TEXT NOT NULL,
+			monitor_name TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			time REAL NOT NULL,
+			response TEXT NOT NULL
+		);
+		INSERT INTO monitors VALUES ('prod', 'api', 'https://api.example.com', 'same'), ('prod', 'web', 'https://example.com', 'same');
+	`)
+	if _, err := s.Migrate(context.Background()); err == nil {
+		t.Fatal("Migrate succeeded with duplicate monitor ids")
+	}
+	if hasColumn(t, s, "monitors", "archived_at") {
+		t.Error("the failed upgrade added monitors.archived_at")
+	}
+	if tracked, err := s.tableExists(context.Background(), "schema_migrations"); err != nil || tracked {
+		t.Errorf("schema_migrations exists after a failed upgrade: %t, %v", tracked, err)
+	}
+}
@@ -0,0 +1,119 @@
+-- Baseline schema. History tables follow renames of their monitor through ON UPDATE CASCADE.
+
+CREATE TABLE monitors (
+    slug TEXT NOT NULL,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL,
+    id TEXT,
+    archived_at BIGINT,
+    PRIMARY KEY (slug, name)
+);
+
+CREATE UNIQUE INDEX idx_monitors_id ON monitors (id);
+
+CREATE TABLE log_entries (
+    id BIGSERIAL PRIMARY KEY,
+    monitor_slug TEXT NOT NULL,
+    monitor_name TEXT NOT NULL,
+    timestamp BIGINT NOT NULL,
+    time DOUBLE PRECISION NOT NULL,
+    response TEXT NOT NULL,
+    interval_seconds INTEGER NOT NULL DEFAULT 0,
+    state TEXT NOT NULL DEFAULT '',
+    rolled_up INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX idx_log_entries_monitor_slug_name_timestamp ON log_entries (monitor_slug, monitor_name, timestamp);
+
+CREATE TABLE incidents (
+    id BIGSERIAL PRIMARY KEY,
+    monitor_slug TEXT NOT NULL,
+    monitor_name TEXT NOT NULL,
+    started_at BIGINT NOT NULL,
+    ended_at BIGINT,
+    first_error TEXT NOT NULL,
+    last_error TEXT NOT NULL,
+    check_count INTEGER NOT NULL DEFAULT 1,
+    FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX idx_incidents_monitor_slug_name_started_at ON incidents (monitor_slug, monitor_name, started_at);
+
+CREATE TABLE rollups_minute (
+    monitor_slug TEXT NOT NULL,
+    monitor_name TEXT NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    up_count INTEGER NOT NULL DEFAULT 0,
+    degraded_count INTEGER NOT NULL DEFAULT 0,
+    down_count INTEGER NOT NULL DEFAULT 0,
+    unknown_count INTEGER NOT NULL DEFAULT 0,
+    latency_count INTEGER NOT NULL DEFAULT 0,
+    latency_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+    latency_min DOUBLE PRECISION NOT NULL DEFAULT 0,
+    latency_max DOUBLE PRECISION NOT NULL DEFAULT 0,
+    hist_0 INTEGER NOT NULL DEFAULT 0,
+    hist_1 INTEGER NOT NULL DEFAULT 0,
+    hist_2 INTEGER NOT NULL DEFAULT 0,
+    hist_3 INTEGER NOT NULL DEFAULT 0,
+    hist_4 INTEGER NOT NULL DEFAULT 0,
+    hist_5 INTEGER NOT NULL DEFAULT 0,
+    hist_6 INTEGER NOT NULL DEFAULT 0,
+    hist_7 INTEGER NOT NULL DEFAULT 0,
+    hist_8 INTEGER NOT NULL DEFAULT 0,
+    hist_9 INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (monitor_slug, monitor_name, bucket_start),
+    FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE rollups_hourly (
+    monitor_slug TEXT NOT NULL,
+    monitor_name TEXT NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    up_count INTEGER NOT NULL DEFAULT 0,
+    degraded_count INTEGER NOT NULL DEFAULT 0,
+    down_count INTEGER NOT NULL DEFAULT 0,
+    unknown_count INTEGER NOT NULL DEFAULT 0,
+    latency_count INTEGER NOT NULL DEFAULT 0,
+    latency_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+    latency_min DOUBLE PRECISION NOT NULL DEFAULT 0,
+    latency_max DOUBLE PRECISION NOT NULL DEFAULT 0,
+    hist_0 INTEGER NOT NULL DEFAULT 0,
+    hist_1 INTEGER NOT NULL DEFAULT 0,
+    hist_2 INTEGER NOT NULL DEFAULT 0,
+    hist_3 INTEGER NOT NULL DEFAULT 0,
+    hist_4 INTEGER NOT NULL DEFAULT 0,
+    hist_5 INTEGER NOT NULL DEFAULT 0,
+    hist_6 INTEGER NOT NULL DEFAULT 0,
+    hist_7 INTEGER NOT NULL DEFAULT 0,
+    hist_8 INTEGER NOT NULL DEFAULT 0,
+    hist_9 INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (monitor_slug, monitor_name, bucket_start),
+    FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE rollups_daily (
+    monitor_slug TEXT NOT NULL,
+    monitor_name TEXT NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    up_count INTEGER NOT NULL DEFAULT 0,
+    degraded_count INTEGER NOT NULL DEFAULT 0,
+    down_count INTEGER NOT NULL DEFAULT 0,
+    unknown_count INTEGER NOT NULL DEFAULT 0,
+    latency_count INTEGER NOT NULL DEFAULT 0,
+    latency_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+    latency_min DOUBLE PRECISION NOT NULL DEFAULT 0,
+    latency_max DOUBLE PRECISION NOT NULL DEFAULT 0,
+    hist_0 INTEGER NOT NULL DEFAULT 0,
+    hist_1 INTEGER NOT NULL DEFAULT 0,
+    hist_2 INTEGER NOT NULL DEFAULT 0,
+    hist_3 INTEGER NOT NULL DEFAULT 0,
+    hist_4 INTEGER NOT NULL DEFAULT 0,
+    hist_5 INTEGER NOT NULL DEFAULT 0,
+    hist_6 INTEGER NOT NULL DEFAULT 0,
+    hist_7 INTEGER NOT NULL DEFAULT 0,
+    hist_8 INTEGER NOT NULL DEFAULT 0,
+    hist_9 INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (monitor_slug, monitor_name, bucket_start),
+    FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+ALTER TABLE log_entries DROP COLUMN resolved_ip;
+ALTER TABLE log_entries DROP COLUMN response_size;
+ALTER TABLE log_entries DROP COLUMN error_message;
+ALTER TABLE log_entries DROP COLUMN error_class;
+ALTER TABLE log_entries DROP COLUMN status_code;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS rollups_daily;
+DROP TABLE IF EXISTS rollups_hourly;
+DROP TABLE IF EXISTS rollups_minute;
+DROP TABLE IF EXISTS incidents;
+DROP TABLE IF EXISTS log_entries;
+DROP TABLE IF EXISTS monitors;
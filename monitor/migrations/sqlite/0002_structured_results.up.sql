@@ -0,0 +1,28 @@
+-- Store the outcome of a check in columns instead of the free-form response string, and
+-- derive them from the response of existing checks.
+
+ALTER TABLE log_entries ADD COLUMN status_code INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE log_entries ADD COLUMN error_class TEXT NOT NULL DEFAULT '';
+ALTER TABLE log_entries ADD COLUMN error_message TEXT NOT NULL DEFAULT '';
+ALTER TABLE log_entries ADD COLUMN response_size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE log_entries ADD COLUMN resolved_ip TEXT NOT NULL DEFAULT '';
+
+UPDATE log_entries
+SET status_code = CAST(response AS INTEGER)
+WHERE response GLOB '[0-9][0-9][0-9]';
+
+UPDATE log_entries
+SET error_class = 'assertion',
+    error_message = 'unexpected status code ' || status_code
+WHERE status_code != 0 AND (status_code < 200 OR status_code >= 300);
+
+UPDATE log_entries
+SET error_message = SUBSTR(response, 8),
+    error_class = CASE
+        WHEN response LIKE '%no such host%' OR response LIKE '%server misbehaving%' OR response LIKE '%dial tcp: lookup %' THEN 'dns'
+        WHEN response LIKE '%tls:%' OR response LIKE '%x509:%' THEN 'tls'
+        WHEN response LIKE '%connection refused%' THEN 'refused'
+        WHEN response LIKE '%timeout%' OR response LIKE '%deadline exceeded%' THEN 'timeout'
+        ELSE 'other'
+    END
+WHERE response LIKE 'Error: %';
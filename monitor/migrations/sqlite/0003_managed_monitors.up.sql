@@ -0,0 +1,9 @@
+-- Monitors created through the API. Their definition has the same JSON form as a monitor in
+-- monitors.json; their history is kept in the monitors table and the history tables as usual.
+
+CREATE TABLE managed_monitors (
+    id TEXT PRIMARY KEY,
+    definition TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
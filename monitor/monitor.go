@@ -1,14 +1,22 @@
 package monitor
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
@@ -19,21 +27,82 @@ const (
 	BasePath = "."
 	// DefaultCheckInterval is the time between monitoring checks.
 	DefaultCheckInterval = 5 * time.Minute
+	// MinCheckInterval is the shortest check interval, as checks record their interval in seconds.
+	MinCheckInterval = time.Second
 )
 
 // Config holds the configuration for the monitoring service.
 type Config struct {
-	DBPath        string
+	DBPath string
+	// ConfigPath is the monitors configuration: a JSON, YAML or TOML file, or a directory of them
+	// whose monitors are merged. Defaults to DefaultConfigPath under BasePath.
+	ConfigPath string
+	// Store overrides the database. When nil, the SQLite database at DBPath is used.
+	Store         Store
 	CheckInterval time.Duration
-	RetentionDays int
+	// Retention says how long raw checks and rollups are kept. Slugs can override it in monitors.json.
+	Retention RetentionPolicy
+	// Notifier receives state change and flapping notifications. Defaults to LogNotifier.
+	Notifier Notifier
+	// FlapWindow, FlapLowThreshold and FlapHighThreshold tune flap detection.
+	// Zero values fall back to the Default* constants.
+	FlapWindow        int
+	FlapLowThreshold  float64
+	FlapHighThreshold float64
+	// WriteBatchSize, WriteFlushInterval and WriteQueueSize tune how check results are batched
+	// into the database. Zero values fall back to the DefaultWrite* constants.
+	WriteBatchSize     int
+	WriteFlushInterval time.Duration
+	WriteQueueSize     int
+	// ConfigWatchInterval is how often the monitors configuration is checked for changes, which
+	// are then applied as by Reload. Zero disables watching.
+	ConfigWatchInterval time.Duration
+	// Discovery lists the providers that find monitors to run in addition to the configured ones.
+	Discovery []DiscoveryProvider
 }
 
 // Service encapsulates the monitoring logic and its dependencies.
 type Service struct {
-	db             *sql.DB
-	checkInterval  time.Duration
-	retentionPeriod time.Duration
+	store         Store
+	writer        *resultWriter
+	checkInterval time.Duration
+	retention     RetentionPolicy
+	configPath    string
+	configWatch   time.Duration
+
+	// configMu guards the loaded configuration, which Reload replaces.
+	configMu       sync.RWMutex
+	slugRetention  map[string]RetentionPolicy
 	monitorsConfig []Monitor
+	slos           []SLO
+
+	// runCtx is the context monitors run under; cancel stops it and aborts in-flight checks.
+	runCtx context.Context
+	cancel context.CancelFunc
+	// runners holds the scheduling loop of each configured monitor, keyed by monitorKey.
+	// reloadMu serializes Start, Reload and changes through the API, which change it.
+	runners  map[string]*monitorRunner
+	reloadMu sync.Mutex
+	// fileConfig is the configuration last read from configPath, managed holds the monitors
+	// managed through the API and discovered the monitors found by each discovery provider.
+	// They are guarded by reloadMu.
+	fileConfig *monitorsFile
+	managed    []Monitor
+	discovered map[string][]Monitor
+	discovery  []DiscoveryProvider
+	// workers tracks the background goroutines started by Start.
+	workers sync.WaitGroup
+	// inFlight is the number of checks currently running.
+	inFlight atomic.Int64
+
+	// statuses holds the current state of each monitor, keyed by monitorKey.
+	statuses map[string]*monitorStatus
+	statusMu sync.RWMutex
+
+	notifier   Notifier
+	flapWindow int
+	flapLow    float64
+	flapHigh   float64
 }
 
 // MonitorConfig (old struct, no longer used for monitors.json parsing directly)
@@ -45,240 +114,517 @@ type Service struct {
 type MonitorLogEntry struct {
 	Timestamp int64   `json:"timestamp"`
 	Time      float64 `json:"time"`
-	Response  string  `json:"response"`
+	// Response is the status code or "Error: <message>". It is kept for older clients; the
+	// structured fields below should be used instead.
+	Response string `json:"response"`
+	State    State  `json:"state"`
+	// IntervalSeconds is the check interval that was in effect when this entry was produced.
+	IntervalSeconds int64 `json:"interval_seconds"`
+	// StatusCode is the HTTP status code, or 0 when no response was received.
+	StatusCode int `json:"status_code"`
+	// ErrorClass and ErrorMessage say why the check failed. Both are empty for a successful check.
+	ErrorClass   ErrorClass `json:"error_class,omitempty"`
+	ErrorMessage string     `json:"error_message,omitempty"`
+	// ResponseSize is the size of the response body in bytes.
+	ResponseSize int64 `json:"response_size"`
+	// ResolvedIP is the address the check connected to.
+	ResolvedIP string `json:"resolved_ip,omitempty"`
 }
 
 // Monitor represents a single configured monitor for API responses, including the new slug field.
 type Monitor struct {
+	// ID identifies the monitor's history independently of its slug and name. When omitted
+	// from monitors.json a random id is assigned and kept in the database.
+	ID   string `json:"id,omitempty"`
 	Slug string `json:"slug"`
 	Name string `json:"name"`
 	URL  string `json:"url"`
+	// Type is the kind of check. Only MonitorTypeHTTP is supported, which is also the default.
+	Type string `json:"type,omitempty"`
+	// Headers are added to every request of the monitor's checks.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Labels describe the monitor, such as the team that owns it or the labels of the target it
+	// was discovered from. They do not affect its checks.
+	Labels map[string]string `json:"labels,omitempty"`
+	// PreviousNames lists names the monitor used to have, as "slug/name" or a bare name under
+	// the same slug, so that its history follows a rename.
+	PreviousNames []MonitorRef `json:"previous_names,omitempty"`
+	// Interval overrides the service-wide check interval for this monitor.
+	Interval Duration `json:"interval,omitempty"`
+	// DownInterval is used instead of Interval while the monitor is failing,
+	// so that recovery is noticed sooner.
+	DownInterval Duration `json:"down_interval,omitempty"`
+	// LatencyThreshold marks the monitor as degraded when a successful check takes longer than this.
+	LatencyThreshold Duration `json:"latency_threshold,omitempty"`
+	// Paused disables checks for this monitor.
+	Paused bool `json:"paused,omitempty"`
+	// Maintenance lists scheduled windows during which checks are recorded as maintenance.
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+	// DependsOn lists monitors this one relies on. While any of them is down, failures of
+	// this monitor are recorded as unreachable instead of down and do not alert.
+	DependsOn []MonitorRef `json:"depends_on,omitempty"`
+	// Source says where the monitor is defined: SourceFile, SourceAPI or the name of the
+	// discovery provider that found it. It is set by the service and cannot be configured.
+	Source string `json:"source,omitempty"`
+}
+
+// Duration is a time.Duration that is read from and written to JSON as a string such as "30s".
+// A whole number of days such as "30d" is also accepted.
+type Duration time.Duration
+
+// MarshalJSON encodes the duration in Go's duration string format.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts either a duration string ("1m30s") or a number of seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(time.Duration(value * float64(time.Second)))
+	case string:
+		parsed, err := parseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s", string(data))
+	}
+	return nil
+}
+
+// parseDuration parses a Go duration string, additionally accepting a whole number of days ("7d").
+func parseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	return time.ParseDuration(value)
 }
 
 // MonitorSummary provides high-level aggregated data for a monitor.
 type MonitorSummary struct {
-	CurrentStatus          string  `json:"current_status"`
-	UptimePercentage24h    float64 `json:"uptime_percentage_24h"`
-	AverageResponseTime24h float64 `json:"average_response_time_24h"`
+	CurrentStatus          string        `json:"current_status"`
+	State                  State         `json:"state"`
+	StateSince             int64         `json:"state_since"`
+	Flapping               bool          `json:"flapping"`
+	FlapPercent            float64       `json:"flap_percent"`
+	UptimePercentage24h    float64       `json:"uptime_percentage_24h"`
+	AverageResponseTime24h float64       `json:"average_response_time_24h"`
+	Latency24h             *LatencyStats `json:"latency_24h"`
 }
 
 // NewService creates and initializes a new monitoring service.
 func NewService(config *Config) (*Service, error) {
-	db, err := initializeDatabase(config.DBPath)
+	if err := config.Retention.validate(); err != nil {
+		return nil, err
+	}
+
+	store, err := initializeStore(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	return &Service{
-		db:              db,
-		checkInterval:   config.CheckInterval,
-		retentionPeriod: time.Duration(config.RetentionDays) * 24 * time.Hour,
-	}, nil
+	s := &Service{
+		store:         store,
+		writer:        newResultWriter(store, config.WriteBatchSize, config.WriteFlushInterval, config.WriteQueueSize),
+		checkInterval: config.CheckInterval,
+		retention:     config.Retention,
+		configPath:    config.ConfigPath,
+		configWatch:   config.ConfigWatchInterval,
+		discovery:     config.Discovery,
+		notifier:      config.Notifier,
+		flapWindow:    config.FlapWindow,
+		flapLow:       config.FlapLowThreshold,
+		flapHigh:      config.FlapHighThreshold,
+	}
+	if s.configPath == "" {
+		s.configPath = filepath.Join(BasePath, DefaultConfigPath)
+	}
+	if s.notifier == nil {
+		s.notifier = LogNotifier{}
+	}
+	if s.flapWindow < 2 {
+		s.flapWindow = DefaultFlapWindow
+	}
+	if s.flapHigh <= 0 {
+		s.flapHigh = DefaultFlapHighThreshold
+	}
+	if s.flapLow <= 0 || s.flapLow > s.flapHigh {
+		s.flapLow = DefaultFlapLowThreshold
+	}
+	return s, nil
 }
 
-// Start begins the monitoring process. It loads monitor configurations and runs checks periodically.
-func (s *Service) Start() error {
+// Start begins the monitoring process. It loads monitor configurations and runs checks periodically
+// until ctx is cancelled or Close is called.
+func (s *Service) Start(ctx context.Context) error {
 	log.Println("Starting monitoring service...")
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
 
-	config, err := s.loadMonitorsConfig()
+	file, err := readConfig(s.configPath)
 	if err != nil {
 		return fmt.Errorf("could not load monitors configuration: %w", err)
 	}
-	s.monitorsConfig = config
+	managed, err := s.store.ManagedMonitors(ctx)
+	if err != nil {
+		return fmt.Errorf("could not load monitors managed through the API: %w", err)
+	}
+	config, err := s.combineConfig(file, managed, s.discovered, s.configPath)
+	if err != nil {
+		return fmt.Errorf("could not load monitors configuration: %w", err)
+	}
+	s.fileConfig, s.managed = file, managed
+	s.configMu.Lock()
+	s.monitorsConfig = config.Monitors
+	s.slos = config.SLOs
+	s.slugRetention = config.slugRetention
+	s.configMu.Unlock()
 
 	if len(s.monitorsConfig) == 0 {
-		log.Println("Warning: No monitors found in monitors.json. Monitoring will not start.")
-		return nil
+		log.Printf("Warning: No monitors found in %s or managed through the API. Monitors added later are started as they are added.", s.configPath)
 	}
 
-	if err := s.addMonitorsToDB(); err != nil {
+	if err := s.store.SyncMonitors(ctx, s.monitorsConfig); err != nil {
 		return fmt.Errorf("error ensuring monitors are in the database: %w", err)
 	}
 
-	// Start the monitoring process in a background goroutine.
-	go func() {
-		// Perform an initial check immediately.
-		s.monitorAll()
+	if err := s.loadInitialStates(ctx); err != nil {
+		return fmt.Errorf("error loading monitor states: %w", err)
+	}
 
-		// Then, continue checking on a ticker.
-		ticker := time.NewTicker(s.checkInterval)
-		defer ticker.Stop()
+	s.runCtx, s.cancel = context.WithCancel(ctx)
+	ctx = s.runCtx
 
-		for range ticker.C {
-			s.monitorAll()
-		}
+	// Start one scheduling loop per monitor so each can follow its own interval.
+	s.runners = make(map[string]*monitorRunner, len(s.monitorsConfig))
+	for _, m := range s.monitorsConfig {
+		s.startRunner(m)
+	}
+
+	// Evaluate SLO burn rates in the background.
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.runSLOEvaluator(ctx)
 	}()
 
 	// Start the data retention cron job in the background.
-	go s.startRetentionCron()
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.startRetentionCron(ctx)
+	}()
+
+	// Apply changes to the monitors configuration as they are saved.
+	if s.configWatch > 0 {
+		// Hash the files now, so that changes saved while the watcher starts are not missed.
+		loaded := hashConfig(s.configPath)
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.watchConfig(ctx, s.configWatch, loaded)
+		}()
+	}
+
+	// Run the monitors found by discovery providers as they come and go.
+	for _, p := range s.discovery {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.runDiscovery(ctx, p)
+		}()
+	}
 
 	return nil
 }
 
-// Close gracefully shuts down the service by closing the database connection.
-func (s *Service) Close() {
-	log.Println("Shutting down monitoring service...\n")
-	if s.db != nil {
-		s.db.Close()
+// Close gracefully shuts down the service. It cancels in-flight checks, waits for the
+// background goroutines to finish until ctx expires, writes the queued check results within
+// WriteCloseTimeout and then closes the database connection.
+// An error is returned if any checks had to be abandoned.
+func (s *Service) Close(ctx context.Context) error {
+	log.Println("Shutting down monitoring service...")
+	if s.cancel != nil {
+		s.cancel()
 	}
+	// Let a reload in progress finish, so that it does not start monitors while shutting down.
+	s.reloadMu.Lock()
+	s.reloadMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	var abandoned int64
+	select {
+	case <-done:
+		log.Println("All monitoring goroutines have stopped.")
+	case <-ctx.Done():
+		abandoned = s.inFlight.Load()
+		log.Printf("Warning: Shutdown deadline reached, abandoning %d in-flight checks.", abandoned)
+	}
+
+	if s.writer != nil {
+		// ctx may have run out waiting for the checks, so the writer gets a deadline of its own.
+		// Close returns once the writer has stopped, so the database can be closed after it.
+		writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), WriteCloseTimeout)
+		err := s.writer.Close(writeCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Warning: Shutdown deadline reached: %v", err)
+		}
+	}
+	if s.store != nil {
+		if err := s.store.Close(); err != nil {
+			return fmt.Errorf("failed to close database: %w", err)
+		}
+	}
+	if abandoned > 0 {
+		return fmt.Errorf("abandoned %d in-flight checks", abandoned)
+	}
+	return nil
 }
 
-// initializeDatabase connects to the SQLite database and ensures the necessary tables are created.
-func initializeDatabase(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=true")
-	if err != nil {
-		return nil, fmt.Errorf("error opening database: %w", err)
-	}
-
-	// Create 'monitors' table if it doesn't exist.
-	// Added 'slug' field and a composite primary key (slug, name) for uniqueness.
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS monitors (
-            slug TEXT NOT NULL,
-            name TEXT NOT NULL,
-            url TEXT NOT NULL,
-            PRIMARY KEY (slug, name)
-        );
-    `)
-	if err != nil {
-		return nil, fmt.Errorf("error creating monitors table: %w", err)
-	}
-
-	// Create 'log_entries' table if it doesn't exist.
-	// Updated FOREIGN KEY to reference both slug and name from the monitors table.
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS log_entries (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            monitor_slug TEXT NOT NULL,
-            monitor_name TEXT NOT NULL,
-            timestamp INTEGER NOT NULL,
-            time REAL NOT NULL,
-            response TEXT NOT NULL,
-            FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON DELETE CASCADE
-        );
-    `)
-	if err != nil {
-		return nil, fmt.Errorf("error creating log_entries table: %w", err)
+// initializeStore opens the configured store, or the SQLite database at DBPath when none is
+// configured, and applies any pending schema migrations.
+func initializeStore(config *Config) (Store, error) {
+	store := config.Store
+	if store == nil {
+		var err error
+		if store, err = NewSQLiteStore(config.DBPath); err != nil {
+			return nil, err
+		}
 	}
 
-	// Create indexes to improve query performance on the log_entries table.
-	// Updated index to include monitor_slug as well.
-	_, err = db.Exec(`
-		CREATE INDEX IF NOT EXISTS idx_log_entries_monitor_slug_name_timestamp ON log_entries (monitor_slug, monitor_name, timestamp);
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("error creating index on log_entries: %w", err)
+	if _, err := store.Migrate(context.Background()); err != nil {
+		store.Close()
+		return nil, err
 	}
 
 	log.Println("Database initialized successfully.")
-	return db, nil
+	return store, nil
 }
 
-// loadMonitorsConfig reads and parses the monitors.json file, now expecting an array of Monitor objects.
-func (s *Service) loadMonitorsConfig() ([]Monitor, error) {
-	monitorsFile := filepath.Join(BasePath, "monitors.json")
-	monitorsData, err := ioutil.ReadFile(monitorsFile)
-	if err != nil {
-		return nil, fmt.Errorf("error reading monitors.json: %w", err)
-	}
-
-	var monitors []Monitor
-	if err := json.Unmarshal(monitorsData, &monitors); err != nil {
-		return nil, fmt.Errorf("error parsing monitors.json: %w", err)
-	}
+// monitorsFile is the content of monitors.json. The file is either an array of monitors
+// or an object with "monitors" and optional "slos" keys.
+type monitorsFile struct {
+	Monitors []Monitor `json:"monitors"`
+	SLOs     []SLO     `json:"slos"`
+	// Retention overrides the retention policy per slug.
+	Retention map[string]retentionOverride `json:"retention"`
 
-	return monitors, nil
+	slugRetention map[string]RetentionPolicy
 }
 
-// addMonitorsToDB syncs the monitors from the config file to the database.
-// Now inserts slug, name, and url.
-func (s *Service) addMonitorsToDB() error {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+// parseMonitorsFile decodes either form of monitors.json.
+func parseMonitorsFile(data []byte) (*monitorsFile, error) {
+	var config monitorsFile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &config.Monitors); err != nil {
+			return nil, err
+		}
+		return &config, nil
 	}
-	defer tx.Rollback()
-
-	// Clear existing monitors to prevent orphaned log entries and simplify updates
-	// when monitor definitions change or are removed.
-	if _, err := tx.Exec("DELETE FROM monitors"); err != nil {
-		return fmt.Errorf("failed to clear existing monitors: %w", err)
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
 	}
+	return &config, nil
+}
 
+// runMonitor checks a single monitor until ctx is cancelled. While the monitor is failing it is
+// checked every DownInterval (if configured) and returns to its normal interval once it recovers.
+func (s *Service) runMonitor(ctx context.Context, monitor Monitor) {
+	interval := s.intervalFor(monitor, true)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
 
-	stmt, err := tx.Prepare("INSERT INTO monitors (slug, name, url) VALUES (?, ?, ?)")
-	if err != nil {
-		return fmt.Errorf("failed to prepare insert statement: %w", err)
-	}
-	defer stmt.Close()
-
-	for _, monitor := range s.monitorsConfig {
-		// Use INSERT OR REPLACE if you want to update existing monitors on slug/name conflict
-		// For now, simple INSERT IGNORE assumes monitor definitions are largely static or handled by DELETE above
-		if _, err := stmt.Exec(monitor.Slug, monitor.Name, monitor.URL); err != nil {
-			// Don't stop for one error, but log it.
-			log.Printf("Warning: Could not add monitor '%s/%s' to DB: %v", monitor.Slug, monitor.Name, err)
+		state := s.checkMonitor(ctx, monitor, interval)
+		if ctx.Err() != nil {
+			return
+		}
+		next := s.intervalFor(monitor, state != StateDown)
+		if next != interval {
+			log.Printf("Monitor '%s/%s' interval changed from %s to %s", monitor.Slug, monitor.Name, interval, next)
+			interval = next
 		}
+		timer.Reset(interval)
 	}
-
-	return tx.Commit()
 }
 
-// monitorAll iterates through the configured monitors and checks each one.
-func (s *Service) monitorAll() {
-	log.Println("Running scheduled monitor checks...\n")
-	for _, monitor := range s.monitorsConfig {
-		go s.checkMonitor(monitor.Slug, monitor.Name, monitor.URL)
+// intervalFor returns the check interval for a monitor given whether its last check succeeded.
+func (s *Service) intervalFor(monitor Monitor, healthy bool) time.Duration {
+	if !healthy && monitor.DownInterval > 0 {
+		return time.Duration(monitor.DownInterval)
+	}
+	if monitor.Interval > 0 {
+		return time.Duration(monitor.Interval)
 	}
+	return s.checkInterval
 }
 
-// checkMonitor performs a single HTTP check for a given monitor and saves the result.
-// Now accepts slug and name.
-func (s *Service) checkMonitor(slug, name, url string) {
+// checkMonitor performs a single HTTP check for a given monitor, saves the result and
+// returns the state it produced. A check that is cancelled through ctx is not recorded,
+// since its outcome says nothing about the monitored site.
+func (s *Service) checkMonitor(ctx context.Context, monitor Monitor, interval time.Duration) State {
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+
+	slug, name := monitor.Slug, monitor.Name
+	var resolvedIP string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				resolvedIP = host
+			}
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, monitor.URL, nil)
+	if err != nil {
+		log.Printf("Monitor '%s/%s' has an invalid request: %v\n", slug, name, err)
+		return StateDown
+	}
+	for key, value := range monitor.Headers {
+		if strings.EqualFold(key, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+
 	start := time.Now()
-	resp, err := http.Get(url)
+	resp, err := http.DefaultClient.Do(req)
 	elapsed := time.Since(start)
 	ms := float64(elapsed.Microseconds()) / 1000.0
 
+	if ctx.Err() != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		log.Printf("Monitor '%s/%s' check cancelled: %v\n", slug, name, ctx.Err())
+		return StateDown
+	}
+
 	var responseCode string
+	var responseSize int64
+	statusCode := 0
 	if err != nil {
 		responseCode = fmt.Sprintf("Error: %v", err)
 		log.Printf("Monitor '%s/%s' check failed: %v\n", slug, name, err)
 	} else {
 		defer resp.Body.Close()
+		statusCode = resp.StatusCode
 		responseCode = fmt.Sprintf("%d", resp.StatusCode)
+		responseSize, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBodySize))
 		log.Printf("Monitor '%s/%s' check completed: Status %s, Time %.2fms\n", slug, name, responseCode, ms)
 	}
 
+	now := time.Now()
+	state := evaluateState(monitor, statusCode, err, elapsed, now)
+	if state == StateDown {
+		if parent, ok := s.unreachableParent(monitor); ok {
+			log.Printf("Monitor '%s/%s' is unreachable because '%s' is down\n", slug, name, parent)
+			state = StateUnreachable
+		}
+	}
+	errorClass, errorMessage := describeFailure(statusCode, err)
 	logEntry := MonitorLogEntry{
-		Timestamp: time.Now().Unix(),
-		Time:      ms,
-		Response:  responseCode,
+		Timestamp:       now.Unix(),
+		Time:            ms,
+		Response:        responseCode,
+		State:           state,
+		IntervalSeconds: int64(interval.Round(time.Second) / time.Second),
+		StatusCode:      statusCode,
+		ErrorClass:      errorClass,
+		ErrorMessage:    errorMessage,
+		ResponseSize:    responseSize,
+		ResolvedIP:      resolvedIP,
+	}
+	change := s.recordState(slug, name, state, logEntry.Timestamp)
+
+	// The check itself has completed, so let it be written and notified even if shutdown begins now.
+	s.writer.enqueue(CheckRecord{Slug: slug, Name: name, Entry: logEntry})
+	s.notifyChange(context.WithoutCancel(ctx), slug, name, change, logEntry.Timestamp)
+	return state
+}
+
+// SaveChecks stores a batch of checks in one transaction. Each check is inserted, counted into
+// the rollups and applied to its monitor's incidents in order.
+func (s *sqlStore) SaveChecks(ctx context.Context, checks []CheckRecord) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for %d checks: %w", len(checks), err)
 	}
+	defer tx.Rollback()
 
-	if err := s.saveLogEntry(slug, name, logEntry); err != nil {
-		log.Printf("Error saving log entry for monitor '%s/%s': %v\n", slug, name, err)
+	for _, c := range checks {
+		if err := s.insertCheck(ctx, tx, c.Slug, c.Name, c.Entry); err != nil {
+			return err
+		}
+		if err := s.trackIncident(ctx, tx, c.Slug, c.Name, c.Entry); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %d checks: %w", len(checks), err)
 	}
+	return nil
 }
 
-// saveLogEntry saves a single monitor log entry to the database.
-// Now accepts monitorSlug and monitorName.
-func (s *Service) saveLogEntry(monitorSlug, monitorName string, entry MonitorLogEntry) error {
-	_, err := s.db.Exec(`
-        INSERT INTO log_entries (monitor_slug, monitor_name, timestamp, time, response)
-        VALUES (?, ?, ?, ?, ?)
-    `, monitorSlug, monitorName, entry.Timestamp, entry.Time, entry.Response)
+// insertCheck inserts a check and adds it to the rollups.
+func (s *sqlStore) insertCheck(ctx context.Context, tx *sql.Tx, monitorSlug, monitorName string, entry MonitorLogEntry) error {
+	_, err := tx.ExecContext(ctx, s.q(`
+        INSERT INTO log_entries (monitor_slug, monitor_name, timestamp, time, response, state, interval_seconds, rolled_up,
+            status_code, error_class, error_message, response_size, resolved_ip)
+        VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?)
+    `), monitorSlug, monitorName, entry.Timestamp, entry.Time, entry.Response, entry.State, entry.IntervalSeconds,
+		entry.StatusCode, entry.ErrorClass, entry.ErrorMessage, entry.ResponseSize, entry.ResolvedIP)
 	if err != nil {
 		return fmt.Errorf("failed to insert log entry for %s/%s: %w", monitorSlug, monitorName, err)
 	}
-	return nil
+	return s.addToRollups(ctx, tx, monitorSlug, monitorName, entry)
 }
 
-// GetMonitors returns a list of all configured monitors.
+// LastCheck returns the most recent check of a monitor, or nil if it has none.
+func (s *sqlStore) LastCheck(ctx context.Context, monitorSlug, monitorName string) (*MonitorLogEntry, error) {
+	entry, err := scanCheck(s.db.QueryRowContext(ctx, s.q(`
+		SELECT `+checkColumns+` FROM log_entries
+		WHERE monitor_slug = ? AND monitor_name = ?
+		ORDER BY timestamp DESC, id DESC
+		LIMIT 1
+	`), monitorSlug, monitorName))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last check for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+	return &entry, nil
+}
+
+// GetMonitors returns a list of all configured monitors. Header values are redacted, since they
+// often hold credentials.
 func (s *Service) GetMonitors() []Monitor {
-	// Directly return the loaded monitorsConfig as it now matches the Monitor struct
-	monitors := make([]Monitor, len(s.monitorsConfig))
-	copy(monitors, s.monitorsConfig)
+	monitors := s.configuredMonitors()
+	for i := range monitors {
+		monitors[i] = monitors[i].redacted()
+	}
 	// Sort for consistent output.
 	sort.Slice(monitors, func(i, j int) bool {
 		if monitors[i].Slug != monitors[j].Slug {
@@ -289,10 +635,59 @@ func (s *Service) GetMonitors() []Monitor {
 	return monitors
 }
 
+// redactedValue replaces secret values in API responses.
+const redactedValue = "<redacted>"
+
+// redacted returns a copy of the monitor with its header values replaced by redactedValue.
+func (m Monitor) redacted() Monitor {
+	if len(m.Headers) == 0 {
+		return m
+	}
+	headers := make(map[string]string, len(m.Headers))
+	for key := range m.Headers {
+		headers[key] = redactedValue
+	}
+	m.Headers = headers
+	return m
+}
+
+// configuredMonitors returns a copy of the loaded monitors.
+func (s *Service) configuredMonitors() []Monitor {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	monitors := make([]Monitor, len(s.monitorsConfig))
+	copy(monitors, s.monitorsConfig)
+	return monitors
+}
+
+// isConfigured reports whether a monitor with the given slug and name is in the loaded configuration.
+func (s *Service) isConfigured(slug, name string) bool {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	for _, m := range s.monitorsConfig {
+		if m.Slug == slug && m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // GetMonitorsBySlug returns a list of monitors associated with a specific slug.
 func (s *Service) GetMonitorsBySlug(slug string) ([]Monitor, error) {
+	monitors, err := s.store.ListMonitorsBySlug(context.Background(), slug)
+	if err != nil {
+		return nil, err
+	}
+	if len(monitors) == 0 {
+		return nil, fmt.Errorf("no monitors found for slug '%s'", slug)
+	}
+	return monitors, nil
+}
+
+// ListMonitorsBySlug returns the monitors under a slug that have not been archived.
+func (s *sqlStore) ListMonitorsBySlug(ctx context.Context, slug string) ([]Monitor, error) {
 	var monitors []Monitor
-	rows, err := s.db.Query(`SELECT slug, name, url FROM monitors WHERE slug = ?`, slug)
+	rows, err := s.db.QueryContext(ctx, s.q(`SELECT id, slug, name, url FROM monitors WHERE slug = ? AND archived_at IS NULL`), slug)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query monitors for slug '%s': %w", slug, err)
 	}
@@ -300,7 +695,7 @@ func (s *Service) GetMonitorsBySlug(slug string) ([]Monitor, error) {
 
 	for rows.Next() {
 		var m Monitor
-		if err := rows.Scan(&m.Slug, &m.Name, &m.URL); err != nil {
+		if err := rows.Scan(&m.ID, &m.Slug, &m.Name, &m.URL); err != nil {
 			return nil, fmt.Errorf("failed to scan monitor for slug '%s': %w", slug, err)
 		}
 		monitors = append(monitors, m)
@@ -310,60 +705,59 @@ func (s *Service) GetMonitorsBySlug(slug string) ([]Monitor, error) {
 		return nil, fmt.Errorf("error during rows iteration for slug '%s': %w", slug, err)
 	}
 
-	if len(monitors) == 0 {
-		return nil, fmt.Errorf("no monitors found for slug '%s'", slug)
-	}
-
 	return monitors, nil
 }
 
-
 // GetMonitorSummary calculates and returns the summary for a specific monitor over the last 24 hours.
 // Now accepts slug and name.
 func (s *Service) GetMonitorSummary(monitorSlug, monitorName string) (*MonitorSummary, error) {
 	// First, check if the monitor is configured, to avoid querying for something that doesn't exist.
 	// This check relies on the in-memory config which might not be exhaustive if DB was manually altered.
 	// A more robust check might query the DB for existence of (slug, name) pair.
-	found := false
-	for _, m := range s.monitorsConfig {
-		if m.Slug == monitorSlug && m.Name == monitorName {
-			found = true
-			break
-		}
-	}
-	if !found {
+	if !s.isConfigured(monitorSlug, monitorName) {
 		return nil, fmt.Errorf("monitor '%s/%s' not found in configuration", monitorSlug, monitorName)
 	}
 
 	var summary MonitorSummary
 
 	// Get the most recent status.
-	err := s.db.QueryRow(`
-		SELECT response FROM log_entries
-		WHERE monitor_slug = ? AND monitor_name = ?
-		ORDER BY timestamp DESC
-		LIMIT 1
-	`, monitorSlug, monitorName).Scan(&summary.CurrentStatus)
+	last, err := s.store.LastCheck(context.Background(), monitorSlug, monitorName)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			summary.CurrentStatus = "No data yet"
-		} else {
-			return nil, fmt.Errorf("failed to get current status for %s/%s: %w", monitorSlug, monitorName, err)
-		}
+		return nil, fmt.Errorf("failed to get current status for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+	if last == nil {
+		summary.CurrentStatus = "No data yet"
+		summary.State = StatePending
+	} else {
+		summary.CurrentStatus = last.Response
+		summary.State = last.State
+		summary.StateSince = last.Timestamp
 	}
 
-	// Calculate uptime and average response time over the last 24 hours.
-	twentyFourHoursAgo := time.Now().Add(-24 * time.Hour).Unix()
-	err = s.db.QueryRow(`
-		SELECT
-			COALESCE(AVG(CASE WHEN response LIKE '2%' THEN 100.0 ELSE 0.0 END), 0),
-			COALESCE(AVG(time), 0)
-		FROM log_entries
-		WHERE monitor_slug = ? AND monitor_name = ? AND timestamp >= ?
-	`, monitorSlug, monitorName, twentyFourHoursAgo).Scan(&summary.UptimePercentage24h, &summary.AverageResponseTime24h)
+	// The scheduler's view is authoritative, since it also knows about paused monitors
+	// and when the current state began.
+	if status, ok := s.currentStatus(monitorSlug, monitorName); ok {
+		summary.State = status.State
+		summary.StateSince = status.Since
+		summary.Flapping = status.Flapping
+		summary.FlapPercent = status.FlapPercent
+	}
+
+	// Calculate uptime and average response time over the last 24 hours from the rollups.
+	// Checks taken while paused or in maintenance do not count towards uptime.
+	now := time.Now().Unix()
+	twentyFourHoursAgo := now - int64((24 * time.Hour).Seconds())
+	day, err := s.aggregateRange(context.Background(), monitorSlug, monitorName, twentyFourHoursAgo, now+1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate summary statistics for %s/%s: %w", monitorSlug, monitorName, err)
 	}
+	summary.UptimePercentage24h = day.UptimePercent()
+	summary.AverageResponseTime24h = day.AverageLatency()
+
+	summary.Latency24h, err = s.GetLatencyStats(context.Background(), monitorSlug, monitorName, twentyFourHoursAgo, now)
+	if err != nil {
+		return nil, err
+	}
 
 	return &summary, nil
 }
@@ -371,23 +765,21 @@ func (s *Service) GetMonitorSummary(monitorSlug, monitorName string) (*MonitorSu
 // GetMonitorChecks retrieves detailed check logs for a monitor within a given time range.
 // Now accepts slug and name.
 func (s *Service) GetMonitorChecks(monitorSlug, monitorName string, start, end int64) ([]MonitorLogEntry, error) {
-	found := false
-	for _, m := range s.monitorsConfig {
-		if m.Slug == monitorSlug && m.Name == monitorName {
-			found = true
-			break
-		}
-	}
-	if !found {
+	if !s.isConfigured(monitorSlug, monitorName) {
 		return nil, fmt.Errorf("monitor '%s/%s' not found in configuration", monitorSlug, monitorName)
 	}
 
-	rows, err := s.db.Query(`
-		SELECT timestamp, time, response
+	return s.store.ListChecks(context.Background(), monitorSlug, monitorName, start, end)
+}
+
+// ListChecks returns the checks of a monitor within [start, end], oldest first.
+func (s *sqlStore) ListChecks(ctx context.Context, monitorSlug, monitorName string, start, end int64) ([]MonitorLogEntry, error) {
+	rows, err := s.db.QueryContext(ctx, s.q(`
+		SELECT `+checkColumns+`
 		FROM log_entries
 		WHERE monitor_slug = ? AND monitor_name = ? AND timestamp >= ? AND timestamp <= ?
 		ORDER BY timestamp ASC
-	`, monitorSlug, monitorName, start, end)
+	`), monitorSlug, monitorName, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query checks for %s/%s: %w", monitorSlug, monitorName, err)
 	}
@@ -395,8 +787,8 @@ func (s *Service) GetMonitorChecks(monitorSlug, monitorName string, start, end i
 
 	var checks []MonitorLogEntry
 	for rows.Next() {
-		var entry MonitorLogEntry
-		if err := rows.Scan(&entry.Timestamp, &entry.Time, &entry.Response); err != nil {
+		entry, err := scanCheck(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan check entry for %s/%s: %w", monitorSlug, monitorName, err)
 		}
 		checks = append(checks, entry)
@@ -408,40 +800,3 @@ func (s *Service) GetMonitorChecks(monitorSlug, monitorName string, start, end i
 
 	return checks, nil
 }
-
-// startRetentionCron runs a periodic job to purge old records from the database.
-func (s *Service) startRetentionCron() {
-	// For a long-running service, a more robust cron library might be better,
-	// but a ticker is simple and effective for a daily task.
-	log.Println("Starting data retention cron job...")
-	ticker := time.NewTicker(24 * time.Hour)
-	defer ticker.Stop()
-
-	// Run once on startup, then continue on the ticker schedule.
-	s.purgeOldRecords()
-
-	for range ticker.C {
-		s.purgeOldRecords()
-	}
-}
-
-// purgeOldRecords deletes log entries from the database that are older than the configured retention period.
-func (s *Service) purgeOldRecords() {
-	// Calculate the cutoff timestamp. Any record older than this will be deleted.
-	cutoff := time.Now().Add(-s.retentionPeriod).Unix()
-	log.Printf("Purging log entries older than %s (timestamp %d)...\n", time.Unix(cutoff, 0).Format(time.RFC3339), cutoff)
-
-	result, err := s.db.Exec(`DELETE FROM log_entries WHERE timestamp < ?`, cutoff)
-	if err != nil {
-		log.Printf("Error: Failed to purge old log entries: %v\n", err)
-		return
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Printf("Error: Failed to retrieve number of purged rows: %v\n", err)
-		return
-	}
-
-	log.Printf("Successfully purged %d old log entries.\n", rowsAffected)
-}
@@ -0,0 +1,152 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// NotificationKind identifies what a notification is about.
+type NotificationKind string
+
+const (
+	// NotifyStateChange is sent when a monitor moves from one state to another.
+	NotifyStateChange NotificationKind = "state_change"
+	// NotifyFlappingStarted is sent once when a monitor starts flapping. Individual
+	// state changes are suppressed until it stabilises.
+	NotifyFlappingStarted NotificationKind = "flapping_started"
+	// NotifyFlappingStopped is sent once when a flapping monitor stabilises, with its settled state.
+	NotifyFlappingStopped NotificationKind = "flapping_stopped"
+	// NotifySLOBurnRate is sent when an SLO starts burning its error budget faster than allowed.
+	NotifySLOBurnRate NotificationKind = "slo_burn_rate"
+	// NotifySLOBurnRateResolved is sent when an SLO's burn rate is back within its thresholds.
+	NotifySLOBurnRateResolved NotificationKind = "slo_burn_rate_resolved"
+)
+
+// Notification describes a monitor event that may need someone's attention.
+type Notification struct {
+	Kind      NotificationKind `json:"kind"`
+	Slug      string           `json:"slug"`
+	Name      string           `json:"name"`
+	SLO       string           `json:"slo,omitempty"`
+	From      State            `json:"from,omitempty"`
+	To        State            `json:"to"`
+	Timestamp int64            `json:"timestamp"`
+	Message   string           `json:"message"`
+}
+
+// Notifier delivers notifications about monitor events.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes notifications to the application log. It is used when no other notifier is configured.
+type LogNotifier struct{}
+
+// Notify logs the notification.
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Printf("ALERT [%s] %s", n.Kind, n.Message)
+	return nil
+}
+
+// WebhookNotifier posts notifications as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that posts to url with a bounded timeout.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Notify posts the notification to the webhook URL.
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notify sends a notification through the configured notifier, logging any delivery failure.
+func (s *Service) notify(ctx context.Context, n Notification) {
+	if err := s.notifier.Notify(ctx, n); err != nil {
+		log.Printf("Error sending %s notification for monitor '%s/%s': %v", n.Kind, n.Slug, n.Name, err)
+	}
+}
+
+// notifyChange decides which notification, if any, a recorded state change should produce.
+// State changes of a flapping monitor are collapsed into a single started/stopped pair.
+func (s *Service) notifyChange(ctx context.Context, slug, name string, change stateChange, at int64) {
+	switch {
+	case change.FlappingStarted:
+		s.notify(ctx, Notification{
+			Kind:      NotifyFlappingStarted,
+			Slug:      slug,
+			Name:      name,
+			From:      change.Previous,
+			To:        change.Current,
+			Timestamp: at,
+			Message: fmt.Sprintf("Monitor '%s/%s' is flapping (%.0f%% state change); notifications are suppressed until it stabilises",
+				slug, name, change.FlapPercent),
+		})
+	case change.FlappingStopped:
+		s.notify(ctx, Notification{
+			Kind:      NotifyFlappingStopped,
+			Slug:      slug,
+			Name:      name,
+			To:        change.Current,
+			Timestamp: at,
+			Message:   fmt.Sprintf("Monitor '%s/%s' stopped flapping and is %s", slug, name, change.Current),
+		})
+	case change.alerts():
+		s.notify(ctx, Notification{
+			Kind:      NotifyStateChange,
+			Slug:      slug,
+			Name:      name,
+			From:      change.Previous,
+			To:        change.Current,
+			Timestamp: at,
+			Message:   fmt.Sprintf("Monitor '%s/%s' is %s (was %s)", slug, name, change.Current, change.Previous),
+		})
+	}
+}
+
+// alerts reports whether a change is notified on its own, rather than suppressed or collapsed into
+// flapping notifications. Becoming unreachable is suppressed, since the parent alerts instead.
+// Leaving it is compared with the state last notified: a failure is notified as usual, but a
+// recovery only if the failure before it was.
+func (c stateChange) alerts() bool {
+	switch {
+	case c.Flapping || c.FlappingStarted || c.FlappingStopped:
+		return false
+	case c.Current == StateUnreachable:
+		return false
+	case c.Previous == StateUnreachable:
+		if c.Current == c.Reported {
+			return false
+		}
+		return c.Current != StateUp || c.Reported == StateDown || c.Reported == StateDegraded
+	default:
+		return c.Previous != c.Current && c.Previous != StatePending
+	}
+}
@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// recordingNotifier keeps the notifications it is sent.
+type recordingNotifier struct {
+	sent []Notification
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func TestNotifyChangeUnreachable(t *testing.T) {
+	states := map[rune]State{'u': StateUp, 'd': StateDown, 'g': StateDegraded, 'x': StateUnreachable}
+	letters := map[State]string{StateUp: "u", StateDown: "d", StateDegraded: "g", StateUnreachable: "x"}
+	tests := []struct {
+		name   string
+		states string // the states of consecutive checks from pending: up, down, degraded or unreachable (x)
+		want   string // the state changes notified, as from>to in the same letters
+	}{
+		{"becoming unreachable is suppressed", "ux", ""},
+		{"unreachable then down alerts", "uxd", "x>d"},
+		{"unreachable then up after no alert", "uxu", ""},
+		{"unreachable then up after a down alert", "udxu", "u>d x>u"},
+		{"unreachable then up after a degraded alert", "ugxu", "u>g x>u"},
+		{"down again after unreachable", "udxd", "u>d"},
+		{"unreachable, down, unreachable, up", "uxdxu", "x>d x>u"},
+		{"unreachable from the first check", "xu", ""},
+		{"unreachable from the first check then down", "xd", "x>d"},
+		{"normal changes still alert", "udu", "u>d d>u"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &recordingNotifier{}
+			// A large window keeps these short sequences from counting as flapping.
+			s := &Service{statuses: map[string]*monitorStatus{}, notifier: notifier,
+				flapWindow: 100, flapLow: DefaultFlapLowThreshold, flapHigh: DefaultFlapHighThreshold}
+			for i, c := range tt.states {
+				change := s.recordState("prod", "api", states[c], int64(i))
+				s.notifyChange(context.Background(), "prod", "api", change, int64(i))
+			}
+
+			var got []string
+			for _, n := range notifier.sent {
+				if n.Kind != NotifyStateChange {
+					t.Fatalf("unexpected %s notification: %s", n.Kind, n.Message)
+				}
+				got = append(got, letters[n.From]+">"+letters[n.To])
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("notified %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+)
+
+// MonitorPlan describes how a declared set of monitors changes the monitors managed through the API.
+type MonitorPlan struct {
+	Add    []Monitor       `json:"add"`
+	Change []MonitorChange `json:"change"`
+	// Remove lists the managed monitors that are not declared, when pruning.
+	Remove []Monitor `json:"remove"`
+	// Undeclared lists the managed monitors that are not declared and are kept, when not pruning.
+	Undeclared []Monitor `json:"undeclared"`
+	Unchanged  int       `json:"unchanged"`
+	// Applied is false for a dry run.
+	Applied bool `json:"applied"`
+}
+
+// MonitorChange is a managed monitor whose definition changes.
+type MonitorChange struct {
+	Before Monitor `json:"before"`
+	After  Monitor `json:"after"`
+	// Fields lists the settings that change, with header names as in "headers.Authorization".
+	Fields []string `json:"fields"`
+}
+
+// IsEmpty reports whether the plan changes nothing.
+func (p *MonitorPlan) IsEmpty() bool {
+	return len(p.Add) == 0 && len(p.Change) == 0 && len(p.Remove) == 0
+}
+
+// ReadMonitors reads monitors to apply through the API from path, a file or a directory in any of
+// the configuration formats, checking each file as strictly as ValidateConfig. References to other
+// monitors are left to the service to check, since they may refer to monitors defined elsewhere.
+// SLOs and retention cannot be applied and are rejected.
+func ReadMonitors(path string) ([]Monitor, error) {
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.SLOs) > 0 || len(config.Retention) > 0 {
+		return nil, ConfigErrors{{File: path, Message: "slos and retention cannot be applied through the API, set them in the monitors configuration"}}
+	}
+	return config.Monitors, nil
+}
+
+// ApplyMonitors makes the monitors managed through the API match the declared ones in one change:
+// new monitors are added, changed ones are updated and, if prune is set, managed monitors that are
+// not declared are deleted. Declared monitors are matched to managed ones by id, then by
+// slug and name, then by previous names. A dry run only validates and returns the plan. Declared
+// monitors must not be defined in the configuration files or discovered.
+func (s *Service) ApplyMonitors(ctx context.Context, declared []Monitor, prune, dryRun bool) (*MonitorPlan, error) {
+	var plan *MonitorPlan
+	err := s.changeManaged(ctx, dryRun, func(managed []Monitor) ([]Monitor, error) {
+		var err error
+		plan, managed, err = s.planMonitors(managed, declared, prune)
+		return managed, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		plan.Applied = true
+		log.Printf("Monitors applied through the API: %d added, %d changed, %d removed, %d unchanged.",
+			len(plan.Add), len(plan.Change), len(plan.Remove), plan.Unchanged)
+	}
+	return plan, nil
+}
+
+// planMonitors compares the declared monitors with the managed ones and returns the plan and the
+// managed monitors that result from it. Callers hold reloadMu.
+func (s *Service) planMonitors(managed, declared []Monitor, prune bool) (*MonitorPlan, []Monitor, error) {
+	plan := &MonitorPlan{Add: []Monitor{}, Change: []MonitorChange{}, Remove: []Monitor{}, Undeclared: []Monitor{}}
+	byKey := make(map[string]int, len(managed))
+	byID := make(map[string]int, len(managed))
+	for i, m := range managed {
+		byKey[monitorKey(m.Slug, m.Name)] = i
+		byID[m.ID] = i
+	}
+
+	var errs ConfigErrors
+	declaredKeys := make(map[string]bool, len(declared))
+	matched := make(map[int]bool, len(declared))
+	next := make([]Monitor, 0, len(declared)+len(managed))
+	for _, m := range declared {
+		key := monitorKey(m.Slug, m.Name)
+		if where, ok := s.definedOutsideAPI(key, m.ID); ok {
+			return nil, nil, fmt.Errorf("%w: a monitor with the name or id of '%s' is defined %s", ErrMonitorReadOnly, key, where)
+		}
+		if declaredKeys[key] {
+			errs = append(errs, ConfigError{Message: fmt.Sprintf("monitor '%s' is declared more than once", key)})
+			continue
+		}
+		declaredKeys[key] = true
+
+		i, ok := byID[m.ID]
+		if !ok {
+			i, ok = byKey[key]
+		}
+		for _, ref := range withSlugs(m.PreviousNames, m.Slug) {
+			if ok {
+				break
+			}
+			i, ok = byKey[ref.String()]
+			ok = ok && !matched[i]
+		}
+		if !ok {
+			if err := keepRedactedHeaders(&m, Monitor{}); err != nil {
+				return nil, nil, err
+			}
+			if m.ID == "" {
+				var err error
+				if m.ID, err = newMonitorID(); err != nil {
+					return nil, nil, err
+				}
+			}
+			plan.Add = append(plan.Add, m.planned())
+			next = append(next, m)
+			continue
+		}
+
+		current := managed[i]
+		switch {
+		case matched[i]:
+			errs = append(errs, ConfigError{Message: fmt.Sprintf("monitor '%s' matches '%s', which is already declared", key, monitorKey(current.Slug, current.Name))})
+			continue
+		case m.ID == "":
+			m.ID = current.ID
+		case m.ID != current.ID:
+			errs = append(errs, ConfigError{Message: fmt.Sprintf("monitor '%s': id cannot be changed from '%s'", key, current.ID)})
+			continue
+		}
+		matched[i] = true
+		if err := keepRedactedHeaders(&m, current); err != nil {
+			return nil, nil, err
+		}
+		fields := changedFields(current, m)
+		if len(fields) == 0 {
+			plan.Unchanged++
+			next = append(next, current)
+			continue
+		}
+		plan.Change = append(plan.Change, MonitorChange{Before: current.planned(), After: m.planned(), Fields: fields})
+		next = append(next, m)
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	for i, m := range managed {
+		switch {
+		case matched[i]:
+		case prune:
+			plan.Remove = append(plan.Remove, m.planned())
+		default:
+			plan.Undeclared = append(plan.Undeclared, m.planned())
+			next = append(next, m)
+		}
+	}
+	return plan, next, nil
+}
+
+// planned returns the monitor as it is shown in a plan: managed through the API, with its header
+// values redacted.
+func (m Monitor) planned() Monitor {
+	m.Source = SourceAPI
+	return m.redacted()
+}
+
+// changedFields lists the settings that differ between two definitions of a monitor. References
+// to monitors under the same slug compare equal with or without the slug.
+func changedFields(before, after Monitor) []string {
+	a, b := definitionValues(before), definitionValues(after)
+	var fields []string
+	for _, key := range sortedKeys(mergeObjects(a, b)) {
+		if reflect.DeepEqual(a[key], b[key]) {
+			continue
+		}
+		subA, okA := a[key].(map[string]interface{})
+		subB, okB := b[key].(map[string]interface{})
+		if !okA && !okB {
+			fields = append(fields, key)
+			continue
+		}
+		for _, sub := range sortedKeys(mergeObjects(subA, subB)) {
+			if !reflect.DeepEqual(subA[sub], subB[sub]) {
+				fields = append(fields, key+"."+sub)
+			}
+		}
+	}
+	return fields
+}
+
+// definitionValues decodes the settings of a monitor as generic JSON values, without its id and
+// with the slugs of its references filled in.
+func definitionValues(m Monitor) map[string]interface{} {
+	m.ID, m.Source = "", ""
+	m.DependsOn = withSlugs(m.DependsOn, m.Slug)
+	m.PreviousNames = withSlugs(m.PreviousNames, m.Slug)
+	var values map[string]interface{}
+	encoded, _ := json.Marshal(m)
+	json.Unmarshal(encoded, &values)
+	return values
+}
+
+// withSlugs returns a copy of refs with omitted slugs set to slug, in order.
+func withSlugs(refs []MonitorRef, slug string) []MonitorRef {
+	if refs == nil {
+		return nil
+	}
+	filled := make([]MonitorRef, len(refs))
+	for i, ref := range refs {
+		if ref.Slug == "" {
+			ref.Slug = slug
+		}
+		filled[i] = ref
+	}
+	return filled
+}
@@ -0,0 +1,263 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// describePlan summarises a plan as one line per monitor: "+" to add, "~" to change with the
+// changed fields, "-" to remove, "?" undeclared and kept, and "=" with the number unchanged.
+func describePlan(plan *MonitorPlan) []string {
+	var lines []string
+	for _, m := range plan.Add {
+		lines = append(lines, "+ "+monitorKey(m.Slug, m.Name))
+	}
+	for _, c := range plan.Change {
+		lines = append(lines, fmt.Sprintf("~ %s -> %s: %s", monitorKey(c.Before.Slug, c.Before.Name),
+			monitorKey(c.After.Slug, c.After.Name), strings.Join(c.Fields, " ")))
+	}
+	for _, m := range plan.Remove {
+		lines = append(lines, "- "+monitorKey(m.Slug, m.Name))
+	}
+	for _, m := range plan.Undeclared {
+		lines = append(lines, "? "+monitorKey(m.Slug, m.Name))
+	}
+	return append(lines, fmt.Sprintf("= %d", plan.Unchanged))
+}
+
+func TestPlanMonitors(t *testing.T) {
+	managed := func() []Monitor {
+		return []Monitor{
+			{ID: "api-id", Slug: "prod", Name: "api", URL: "https://api.example.com/", Interval: Duration(time.Minute),
+				Headers: map[string]string{"Authorization": "Bearer secret"}},
+			{ID: "web-id", Slug: "prod", Name: "web", URL: "https://example.com/"},
+			{ID: "login-id", Slug: "prod", Name: "login", URL: "https://login.example.com/"},
+		}
+	}
+	api := Monitor{Slug: "prod", Name: "api", URL: "https://api.example.com/", Interval: Duration(time.Minute),
+		Headers: map[string]string{"Authorization": redactedValue}}
+	web := Monitor{Slug: "prod", Name: "web", URL: "https://example.com/"}
+	login := Monitor{Slug: "prod", Name: "login", URL: "https://login.example.com/"}
+
+	tests := []struct {
+		name     string
+		declared []Monitor
+		prune    bool
+		want     []string
+		next     []string
+	}{
+		{
+			name:     "no-op",
+			declared: []Monitor{api, web, login},
+			want:     []string{"= 3"},
+			next:     []string{"api-id prod/api", "web-id prod/web", "login-id prod/login"},
+		},
+		{
+			name:     "add",
+			declared: []Monitor{api, web, login, {Slug: "prod", Name: "cache", URL: "https://cache.example.com/"}},
+			want:     []string{"+ prod/cache", "= 3"},
+			next:     []string{"api-id prod/api", "web-id prod/web", "login-id prod/login", "* prod/cache"},
+		},
+		{
+			name:     "remove",
+			declared: []Monitor{api, web},
+			prune:    true,
+			want:     []string{"- prod/login", "= 2"},
+			next:     []string{"api-id prod/api", "web-id prod/web"},
+		},
+		{
+			name:     "undeclared without prune",
+			declared: []Monitor{api, web},
+			want:     []string{"? prod/login", "= 2"},
+			next:     []string{"api-id prod/api", "web-id prod/web", "login-id prod/login"},
+		},
+		{
+			name: "update",
+			declared: []Monitor{
+				{Slug: "prod", Name: "api", URL: "https://api.example.com/", Interval: Duration(5 * time.Minute),
+					Headers: map[string]string{"Authorization": "Bearer rotated", "X-Env": "prod"}},
+				web, login,
+			},
+			want: []string{"~ prod/api -> prod/api: headers.Authorization headers.X-Env interval", "= 2"},
+			next: []string{"api-id prod/api", "web-id prod/web", "login-id prod/login"},
+		},
+		{
+			name:     "rename by previous names",
+			declared: []Monitor{api, web, {Slug: "prod", Name: "auth", URL: "https://login.example.com/", PreviousNames: []MonitorRef{{Name: "login"}}}},
+			want:     []string{"~ prod/login -> prod/auth: name previous_names", "= 2"},
+			next:     []string{"api-id prod/api", "web-id prod/web", "login-id prod/auth"},
+		},
+		{
+			name:     "rename by id",
+			declared: []Monitor{api, web, {ID: "login-id", Slug: "prod", Name: "auth", URL: "https://login.example.com/"}},
+			want:     []string{"~ prod/login -> prod/auth: name", "= 2"},
+			next:     []string{"api-id prod/api", "web-id prod/web", "login-id prod/auth"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{fileConfig: &monitorsFile{}}
+			plan, next, err := s.planMonitors(managed(), tt.declared, tt.prune)
+			if err != nil {
+				t.Fatalf("planMonitors: %v", err)
+			}
+			if got := describePlan(plan); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan = %q, want %q", got, tt.want)
+			}
+			var got []string
+			for _, m := range next {
+				id := m.ID
+				if !strings.HasSuffix(id, "-id") && id != "" {
+					id = "*"
+				}
+				got = append(got, id+" "+monitorKey(m.Slug, m.Name))
+			}
+			if !reflect.DeepEqual(got, tt.next) {
+				t.Errorf("managed monitors = %q, want %q", got, tt.next)
+			}
+			for _, m := range next {
+				if m.Headers["Authorization"] == redactedValue {
+					t.Errorf("%s stores the redacted header value", monitorKey(m.Slug, m.Name))
+				}
+			}
+		})
+	}
+}
+
+func TestPlanMonitorsRejects(t *testing.T) {
+	managed := []Monitor{{ID: "api-id", Slug: "prod", Name: "api", URL: "https://api.example.com/"}}
+	s := &Service{
+		fileConfig: &monitorsFile{Monitors: []Monitor{{Slug: "prod", Name: "site", URL: "https://example.com/"}}},
+		configPath: "monitors.json",
+	}
+	tests := []struct {
+		name     string
+		declared []Monitor
+		want     string
+	}{
+		{"declared twice", []Monitor{managed[0], managed[0]}, "monitor 'prod/api' is declared more than once"},
+		{"changed id", []Monitor{{ID: "other-id", Slug: "prod", Name: "api", URL: "https://api.example.com/"}}, "monitor 'prod/api': id cannot be changed from 'api-id'"},
+		{"defined in a file", []Monitor{{Slug: "prod", Name: "site", URL: "https://example.com/"}}, "is defined in monitors.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.planMonitors(managed, tt.declared, false)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("planMonitors error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	base := Monitor{ID: "api-id", Slug: "prod", Name: "api", URL: "https://api.example.com/",
+		Headers: map[string]string{"Authorization": "Bearer secret"}, DependsOn: []MonitorRef{{Name: "db"}}}
+	tests := []struct {
+		name   string
+		change func(m *Monitor)
+		want   []string
+	}{
+		{"unchanged", func(m *Monitor) {}, nil},
+		{"id and source are not settings", func(m *Monitor) { m.ID, m.Source = "", SourceAPI }, nil},
+		{"slug filled in", func(m *Monitor) { m.DependsOn = []MonitorRef{{Slug: "prod", Name: "db"}} }, nil},
+		{"url", func(m *Monitor) { m.URL = "https://api.example.com/health" }, []string{"url"}},
+		{"rename", func(m *Monitor) { m.Name = "gateway" }, []string{"name"}},
+		{"header added", func(m *Monitor) { m.Headers = map[string]string{"Authorization": "Bearer secret", "X-Env": "prod"} }, []string{"headers.X-Env"}},
+		{"headers removed", func(m *Monitor) { m.Headers = nil }, []string{"headers.Authorization"}},
+		{"several", func(m *Monitor) { m.Paused, m.Interval = true, Duration(time.Minute) }, []string{"interval", "paused"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := base
+			tt.change(&after)
+			if got := changedFields(base, after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changedFields = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMonitors(t *testing.T) {
+	ctx := context.Background()
+	site := newTestSite(t).URL
+	s := startTestService(t, `[]`, Config{})
+	for _, name := range []string{"api", "web", "login"} {
+		if _, err := s.CreateMonitor(ctx, Monitor{Slug: "prod", Name: name, URL: site}); err != nil {
+			t.Fatalf("CreateMonitor: %v", err)
+		}
+	}
+	managed := append([]Monitor(nil), s.managed...)
+	runners := runningMonitors(s)
+	declared := []Monitor{
+		{Slug: "prod", Name: "api", URL: site, Interval: Duration(5 * time.Minute)},
+		{Slug: "prod", Name: "auth", URL: site, PreviousNames: []MonitorRef{{Name: "login"}}},
+		{Slug: "prod", Name: "cache", URL: site},
+	}
+	want := []string{"+ prod/cache", "~ prod/api -> prod/api: interval", "~ prod/login -> prod/auth: name previous_names", "? prod/web", "= 0"}
+
+	// A dry run only returns the plan.
+	plan, err := s.ApplyMonitors(ctx, declared, false, true)
+	if err != nil {
+		t.Fatalf("ApplyMonitors dry run: %v", err)
+	}
+	if got := describePlan(plan); plan.Applied || !reflect.DeepEqual(got, want) {
+		t.Errorf("dry run plan = %q (applied %t), want %q", got, plan.Applied, want)
+	}
+	if !reflect.DeepEqual(s.managed, managed) || !reflect.DeepEqual(runningMonitors(s), runners) {
+		t.Fatal("the dry run changed the managed monitors")
+	}
+
+	plan, err = s.ApplyMonitors(ctx, declared, false, false)
+	if err != nil {
+		t.Fatalf("ApplyMonitors: %v", err)
+	}
+	if got := describePlan(plan); !plan.Applied || !reflect.DeepEqual(got, want) {
+		t.Errorf("plan = %q (applied %t), want %q", got, plan.Applied, want)
+	}
+	var keys []string
+	for _, m := range s.managed {
+		keys = append(keys, m.ID+" "+monitorKey(m.Slug, m.Name))
+	}
+	wantKeys := []string{
+		managed[0].ID + " prod/api",
+		managed[2].ID + " prod/auth",
+		plan.Add[0].ID + " prod/cache",
+		managed[1].ID + " prod/web",
+	}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("managed monitors = %q, want %q", keys, wantKeys)
+	}
+	after := runningMonitors(s)
+	if after["prod/web"] != runners["prod/web"] {
+		t.Error("the undeclared monitor was restarted")
+	}
+	if after["prod/login"] != nil || after["prod/api"] == runners["prod/api"] || after["prod/auth"] == nil || after["prod/cache"] == nil {
+		t.Errorf("running monitors = %v, want api restarted, auth and cache started and login stopped", after)
+	}
+	stored, err := s.store.ManagedMonitors(ctx)
+	if err != nil || len(stored) != len(s.managed) {
+		t.Errorf("stored managed monitors = %+v, %v; want %d", stored, err, len(s.managed))
+	}
+
+	// Applying the same declaration again changes nothing.
+	plan, err = s.ApplyMonitors(ctx, declared, false, false)
+	if err != nil {
+		t.Fatalf("ApplyMonitors again: %v", err)
+	}
+	if got := describePlan(plan); !reflect.DeepEqual(got, []string{"? prod/web", "= 3"}) {
+		t.Errorf("plan of an applied declaration = %q, want no changes", got)
+	}
+
+	// An invalid declaration changes nothing.
+	managed = append([]Monitor(nil), s.managed...)
+	_, err = s.ApplyMonitors(ctx, append(declared, declared[0]), true, false)
+	var problems ConfigErrors
+	if !errors.As(err, &problems) || !reflect.DeepEqual(s.managed, managed) {
+		t.Errorf("ApplyMonitors with a duplicate: error = %v, managed changed %t", err, !reflect.DeepEqual(s.managed, managed))
+	}
+}
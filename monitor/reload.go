@@ -0,0 +1,227 @@
+package monitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+// ReloadResult describes how a reload changed the running monitors.
+type ReloadResult struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Updated   []string `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// monitorRunner is the scheduling loop of one configured monitor.
+type monitorRunner struct {
+	monitor Monitor
+	// cancel stops the loop; it is nil for a paused monitor, which has no loop.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop cancels the runner's loop, including an in-flight check, and waits for it to exit.
+func (r *monitorRunner) stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// startRunner starts the scheduling loop of a monitor under the service's run context.
+// Callers hold reloadMu.
+func (s *Service) startRunner(m Monitor) {
+	r := &monitorRunner{monitor: m, done: make(chan struct{})}
+	s.runners[monitorKey(m.Slug, m.Name)] = r
+	if m.Paused {
+		log.Printf("Monitor '%s/%s' is paused, not scheduling checks.", m.Slug, m.Name)
+		close(r.done)
+		return
+	}
+
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(s.runCtx)
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		defer close(r.done)
+		s.runMonitor(ctx, m)
+	}()
+}
+
+// sameMonitor reports whether a configured monitor is unchanged from a running one. A monitor
+// without an explicit id matches regardless of the id it was assigned.
+func sameMonitor(running, configured Monitor) bool {
+	if configured.ID == "" {
+		configured.ID = running.ID
+	}
+	return reflect.DeepEqual(running, configured)
+}
+
+// Reload re-reads the monitors configuration and applies it, together with the monitors managed
+// through the API, to the running service: new monitors are started, removed ones are stopped and
+// archived, and changed ones are restarted with their new settings. History is kept just as across
+// a restart, including for monitors renamed through id or previous_names. If the new configuration
+// is invalid, the running one is kept and the reason is returned.
+func (s *Service) Reload(ctx context.Context) (*ReloadResult, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.runCtx == nil || s.runCtx.Err() != nil {
+		return nil, fmt.Errorf("the monitoring service is not running")
+	}
+
+	file, err := readConfig(s.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration, keeping the running one: %w", err)
+	}
+	config, err := s.combineConfig(file, s.managed, s.discovered, s.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration, keeping the running one: %w", err)
+	}
+	result, err := s.applyConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	s.fileConfig = file
+
+	log.Printf("Configuration reloaded: %d added, %d removed, %d updated, %d unchanged.",
+		len(result.Added), len(result.Removed), len(result.Updated), result.Unchanged)
+	return result, nil
+}
+
+// applyConfig brings the running monitors in line with a resolved configuration. Callers hold reloadMu.
+func (s *Service) applyConfig(ctx context.Context, config *monitorsFile) (*ReloadResult, error) {
+	// Stop every monitor that is removed or changed, and write its queued checks, before the
+	// database is synced: a renamed monitor's history moves, and checks under its old name
+	// could no longer be stored.
+	configured := make(map[string]Monitor, len(config.Monitors))
+	for _, m := range config.Monitors {
+		configured[monitorKey(m.Slug, m.Name)] = m
+	}
+	stopped := make(map[string]*monitorRunner)
+	for key, r := range s.runners {
+		if m, ok := configured[key]; ok && sameMonitor(r.monitor, m) {
+			continue
+		}
+		r.stop()
+		stopped[key] = r
+		delete(s.runners, key)
+	}
+	if err := s.writer.Flush(ctx); err != nil {
+		s.restartRunners(stopped)
+		return nil, fmt.Errorf("failed to write queued checks, keeping the running configuration: %w", err)
+	}
+
+	if err := s.store.SyncMonitors(ctx, config.Monitors); err != nil {
+		s.restartRunners(stopped)
+		return nil, fmt.Errorf("failed to apply configuration to the database, keeping the running one: %w", err)
+	}
+
+	stoppedByID := make(map[string]*monitorRunner, len(stopped))
+	for _, r := range stopped {
+		stoppedByID[r.monitor.ID] = r
+	}
+	result := &ReloadResult{Added: []string{}, Removed: []string{}, Updated: []string{}}
+	for _, m := range config.Monitors {
+		key := monitorKey(m.Slug, m.Name)
+		if r, ok := s.runners[key]; ok {
+			// Unchanged monitors keep running; only pick up the id the sync filled in.
+			r.monitor = m
+			result.Unchanged++
+			continue
+		}
+
+		previous, ok := stoppedByID[m.ID]
+		if ok {
+			delete(stoppedByID, m.ID)
+			result.Updated = append(result.Updated, key)
+		} else {
+			result.Added = append(result.Added, key)
+		}
+		if err := s.moveStatus(ctx, previous, m); err != nil {
+			log.Printf("Error: %v", err)
+		}
+		s.startRunner(m)
+	}
+	for _, r := range stoppedByID {
+		key := monitorKey(r.monitor.Slug, r.monitor.Name)
+		result.Removed = append(result.Removed, key)
+		if _, ok := configured[key]; !ok {
+			s.statusMu.Lock()
+			delete(s.statuses, key)
+			s.statusMu.Unlock()
+		}
+	}
+
+	s.configMu.Lock()
+	s.monitorsConfig = config.Monitors
+	s.slos = config.SLOs
+	s.slugRetention = config.slugRetention
+	s.configMu.Unlock()
+	return result, nil
+}
+
+// restartRunners starts stopped runners again with their previous settings after a failed reload.
+func (s *Service) restartRunners(stopped map[string]*monitorRunner) {
+	for _, r := range stopped {
+		s.startRunner(r.monitor)
+	}
+}
+
+// moveStatus prepares the in-memory state of a monitor that is about to be started by a reload.
+// A renamed monitor keeps the state of its previous name, a monitor that was paused or unpaused
+// starts over from its stored state, and any other changed monitor keeps its state.
+func (s *Service) moveStatus(ctx context.Context, previous *monitorRunner, m Monitor) error {
+	key := monitorKey(m.Slug, m.Name)
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	if previous != nil && previous.monitor.Paused == m.Paused {
+		previousKey := monitorKey(previous.monitor.Slug, previous.monitor.Name)
+		if status, ok := s.statuses[previousKey]; ok {
+			delete(s.statuses, previousKey)
+			s.statuses[key] = status
+			return nil
+		}
+	}
+
+	status, err := s.initialStatus(ctx, m)
+	if err != nil {
+		return err
+	}
+	s.statuses[key] = status
+	return nil
+}
+
+// watchConfig reloads the configuration whenever the hash of the configuration files differs from
+// last, checking every interval until ctx is cancelled. A change that fails to load is reported once.
+func (s *Service) watchConfig(ctx context.Context, interval time.Duration, last [sha256.Size]byte) {
+	log.Printf("Watching %s for changes every %s.", s.configPath, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := hashConfig(s.configPath)
+		if current == last {
+			continue
+		}
+		last = current
+		log.Printf("%s changed, reloading.", s.configPath)
+		if _, err := s.Reload(ctx); err != nil {
+			log.Printf("Error: Reload failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package monitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runningMonitors returns a copy of the service's runners.
+func runningMonitors(s *Service) map[string]*monitorRunner {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	runners := make(map[string]*monitorRunner, len(s.runners))
+	for key, r := range s.runners {
+		runners[key] = r
+	}
+	return runners
+}
+
+// monitorStatuses returns a copy of the service's in-memory states.
+func monitorStatuses(s *Service) map[string]*monitorStatus {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	statuses := make(map[string]*monitorStatus, len(s.statuses))
+	for key, status := range s.statuses {
+		statuses[key] = status
+	}
+	return statuses
+}
+
+// monitorsJSON returns a monitors.json that lists the given monitors, each a JSON object
+// without its url, all checking site.
+func monitorsJSON(site string, monitors ...string) string {
+	for i, m := range monitors {
+		monitors[i] = strings.Replace(m, "{", fmt.Sprintf(`{"url": %q, `, site), 1)
+	}
+	return "[" + strings.Join(monitors, ",\n") + "]"
+}
+
+func TestReload(t *testing.T) {
+	site := newTestSite(t).URL
+	s := startTestService(t, monitorsJSON(site,
+		`{"slug": "prod", "name": "api"}`,
+		`{"slug": "prod", "name": "web"}`,
+		`{"slug": "prod", "name": "db"}`,
+		`{"slug": "prod", "name": "login"}`,
+		`{"slug": "prod", "name": "jobs"}`,
+	), Config{})
+	before := runningMonitors(s)
+	statuses := monitorStatuses(s)
+
+	writeConfig(t, s.configPath, monitorsJSON(site,
+		`{"slug": "prod", "name": "api"}`,
+		`{"slug": "prod", "name": "web", "interval": "5m"}`,
+		`{"slug": "prod", "name": "auth", "previous_names": ["login"]}`,
+		`{"slug": "prod", "name": "jobs", "paused": true}`,
+		`{"slug": "prod", "name": "cache"}`,
+	))
+	result, err := s.Reload(context.Background())
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	want := &ReloadResult{
+		Added:     []string{"prod/cache"},
+		Removed:   []string{"prod/db"},
+		Updated:   []string{"prod/web", "prod/auth", "prod/jobs"},
+		Unchanged: 1,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Reload = %+v, want %+v", result, want)
+	}
+
+	after := runningMonitors(s)
+	if len(after) != 5 {
+		t.Errorf("running %d monitors, want 5", len(after))
+	}
+	if after["prod/api"] != before["prod/api"] {
+		t.Error("the unchanged monitor was restarted")
+	}
+	for _, key := range []string{"prod/web", "prod/auth", "prod/jobs", "prod/cache"} {
+		if r := after[key]; r == nil || r == before[key] {
+			t.Errorf("%s was not started again", key)
+		}
+	}
+	for _, key := range []string{"prod/web", "prod/db", "prod/login", "prod/jobs"} {
+		select {
+		case <-before[key].done:
+		default:
+			t.Errorf("the previous runner of %s was not stopped", key)
+		}
+	}
+	if time.Duration(after["prod/web"].monitor.Interval) != 5*time.Minute {
+		t.Errorf("web runs with %+v, want the new interval", after["prod/web"].monitor)
+	}
+	if after["prod/auth"].monitor.ID != before["prod/login"].monitor.ID {
+		t.Errorf("auth has id %q, want login's %q", after["prod/auth"].monitor.ID, before["prod/login"].monitor.ID)
+	}
+
+	current := monitorStatuses(s)
+	if current["prod/auth"] != statuses["prod/login"] {
+		t.Error("the renamed monitor did not keep its state")
+	}
+	if current["prod/web"] != statuses["prod/web"] {
+		t.Error("the changed monitor did not keep its state")
+	}
+	if current["prod/jobs"] == statuses["prod/jobs"] || current["prod/jobs"].State != StatePaused {
+		t.Errorf("the paused monitor has state %+v, want it to start over as paused", current["prod/jobs"])
+	}
+	for _, key := range []string{"prod/login", "prod/db"} {
+		if _, ok := current[key]; ok {
+			t.Errorf("%s still has a state", key)
+		}
+	}
+	if current["prod/cache"] == nil {
+		t.Error("the added monitor has no state")
+	}
+}
+
+func TestReloadInvalidConfigKeepsRunning(t *testing.T) {
+	site := newTestSite(t).URL
+	s := startTestService(t, monitorsJSON(site, `{"slug": "prod", "name": "api"}`), Config{})
+	before := runningMonitors(s)
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"syntax error", `[{"slug": "prod", "name": "api"`},
+		{"invalid monitor", monitorsJSON(site, `{"slug": "prod", "name": "web", "interval": "500ms"}`)},
+		{"unknown dependency", monitorsJSON(site, `{"slug": "prod", "name": "web", "depends_on": ["db"]}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, s.configPath, tt.config)
+			if _, err := s.Reload(context.Background()); err == nil || !strings.Contains(err.Error(), "keeping the running one") {
+				t.Fatalf("Reload error = %v, want the running configuration kept", err)
+			}
+			if after := runningMonitors(s); !reflect.DeepEqual(after, before) {
+				t.Errorf("runners = %v, want %v", after, before)
+			}
+			if !s.isConfigured("prod", "api") || s.isConfigured("prod", "web") {
+				t.Errorf("configured monitors = %+v, want only api", s.configuredMonitors())
+			}
+		})
+	}
+}
+
+func TestHashConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "monitors.json")
+	writeConfig(t, path, `[]`)
+	initial := hashConfig(path)
+	if initial == ([sha256.Size]byte{}) {
+		t.Fatal("hashConfig of a readable file is zero")
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if hashConfig(path) != initial {
+		t.Error("touching the file changed its hash")
+	}
+	writeConfig(t, path, `[] `)
+	if hashConfig(path) == initial {
+		t.Error("changing the file kept its hash")
+	}
+	if hashConfig(filepath.Join(dir, "missing.json")) != ([sha256.Size]byte{}) {
+		t.Error("hashConfig of a missing file is not zero")
+	}
+
+	files := hashConfig(dir)
+	writeConfig(t, filepath.Join(dir, "README.md"), "notes")
+	if hashConfig(dir) != files {
+		t.Error("a file that is not configuration changed the hash of the directory")
+	}
+	writeConfig(t, filepath.Join(dir, "web.yaml"), "[]")
+	if hashConfig(dir) == files {
+		t.Error("a new configuration file kept the hash of the directory")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	site := newTestSite(t).URL
+	s := startTestService(t, monitorsJSON(site, `{"slug": "prod", "name": "api"}`), Config{ConfigWatchInterval: 10 * time.Millisecond})
+	api := runningMonitors(s)["prod/api"]
+
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	writeConfig(t, s.configPath, monitorsJSON(site, `{"slug": "prod", "name": "api"}`, `{"slug": "prod", "name": "web"}`))
+	waitFor("web to be started", func() bool { return runningMonitors(s)["prod/web"] != nil })
+	if runningMonitors(s)["prod/api"] != api {
+		t.Error("the unchanged monitor was restarted")
+	}
+
+	// An invalid change is not applied, and the next valid one is.
+	writeConfig(t, s.configPath, `[{"slug": "prod"`)
+	time.Sleep(50 * time.Millisecond)
+	if len(runningMonitors(s)) != 2 {
+		t.Errorf("runners after an invalid change = %v, want api and web", runningMonitors(s))
+	}
+	writeConfig(t, s.configPath, monitorsJSON(site, `{"slug": "prod", "name": "api"}`))
+	waitFor("web to be stopped", func() bool { return runningMonitors(s)["prod/web"] == nil })
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ErrorClass says why a check failed.
+type ErrorClass string
+
+const (
+	// ErrorDNS means the monitor's host name could not be resolved.
+	ErrorDNS ErrorClass = "dns"
+	// ErrorTimeout means the request did not complete in time.
+	ErrorTimeout ErrorClass = "timeout"
+	// ErrorRefused means the host refused the connection.
+	ErrorRefused ErrorClass = "refused"
+	// ErrorTLS means the TLS handshake or certificate verification failed.
+	ErrorTLS ErrorClass = "tls"
+	// ErrorAssertion means a response was received but did not meet expectations, such as a
+	// status code outside 2xx.
+	ErrorAssertion ErrorClass = "assertion"
+	// ErrorOther covers every other request error.
+	ErrorOther ErrorClass = "other"
+)
+
+// maxResponseBodySize caps how much of a response body is read to measure its size.
+const maxResponseBodySize = 10 << 20
+
+// checkColumns are the log_entries columns read into a MonitorLogEntry by scanCheck.
+const checkColumns = `timestamp, time, response, state, interval_seconds,
+	status_code, error_class, error_message, response_size, resolved_ip`
+
+// scanCheck scans a row selected with checkColumns.
+func scanCheck(row interface{ Scan(...interface{}) error }) (MonitorLogEntry, error) {
+	var entry MonitorLogEntry
+	var state, errorClass string
+	err := row.Scan(&entry.Timestamp, &entry.Time, &entry.Response, &state, &entry.IntervalSeconds,
+		&entry.StatusCode, &errorClass, &entry.ErrorMessage, &entry.ResponseSize, &entry.ResolvedIP)
+	entry.State = State(state)
+	entry.ErrorClass = ErrorClass(errorClass)
+	return entry, err
+}
+
+// classifyError maps a request error to an ErrorClass.
+func classifyError(err error) ErrorClass {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return ErrorTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	default:
+		return ErrorOther
+	}
+}
+
+// describeFailure returns the error class and message of a check, or empty strings when the
+// check succeeded.
+func describeFailure(statusCode int, checkErr error) (ErrorClass, string) {
+	switch {
+	case checkErr != nil:
+		return classifyError(checkErr), checkErr.Error()
+	case statusCode < 200 || statusCode >= 300:
+		return ErrorAssertion, fmt.Sprintf("unexpected status code %d", statusCode)
+	default:
+		return "", ""
+	}
+}
@@ -0,0 +1,199 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy says how long each tier of monitoring data is kept. A zero duration keeps
+// that tier forever. Minute rollups are kept as long as raw checks.
+type RetentionPolicy struct {
+	Raw    Duration `json:"raw"`
+	Hourly Duration `json:"hourly"`
+	Daily  Duration `json:"daily"`
+}
+
+// DefaultRetention keeps raw checks for 14 days, hourly rollups for a year and daily rollups forever.
+var DefaultRetention = RetentionPolicy{
+	Raw:    Duration(14 * 24 * time.Hour),
+	Hourly: Duration(365 * 24 * time.Hour),
+}
+
+// retentionOverride changes some tiers of the retention policy for one slug.
+// Omitted tiers inherit the service-wide policy.
+type retentionOverride struct {
+	Raw    *Duration `json:"raw"`
+	Hourly *Duration `json:"hourly"`
+	Daily  *Duration `json:"daily"`
+}
+
+// apply returns base with the tiers set in the override replaced.
+func (o retentionOverride) apply(base RetentionPolicy) RetentionPolicy {
+	if o.Raw != nil {
+		base.Raw = *o.Raw
+	}
+	if o.Hourly != nil {
+		base.Hourly = *o.Hourly
+	}
+	if o.Daily != nil {
+		base.Daily = *o.Daily
+	}
+	return base
+}
+
+// validate rejects negative retention periods.
+func (p RetentionPolicy) validate() error {
+	if p.Raw < 0 || p.Hourly < 0 || p.Daily < 0 {
+		return fmt.Errorf("retention periods must not be negative")
+	}
+	return nil
+}
+
+// retentionFor returns the retention policy that applies to a slug.
+func (s *Service) retentionFor(slug string) RetentionPolicy {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	if policy, ok := s.slugRetention[slug]; ok {
+		return policy
+	}
+	return s.retention
+}
+
+// resolveRetention applies the per-slug overrides of monitors.json to the service-wide policy.
+func resolveRetention(base RetentionPolicy, overrides map[string]retentionOverride, monitors []Monitor) (map[string]RetentionPolicy, error) {
+	slugs := make(map[string]bool)
+	for _, m := range monitors {
+		slugs[m.Slug] = true
+	}
+
+	policies := make(map[string]RetentionPolicy, len(overrides))
+	for slug, o := range overrides {
+		if !slugs[slug] {
+			return nil, fmt.Errorf("retention is set for unknown slug '%s'", slug)
+		}
+		policy := o.apply(base)
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid retention for slug '%s': %w", slug, err)
+		}
+		policies[slug] = policy
+	}
+	return policies, nil
+}
+
+// startRetentionCron runs a periodic job to purge old records from the database until ctx is cancelled.
+func (s *Service) startRetentionCron(ctx context.Context) {
+	// For a long-running service, a more robust cron library might be better,
+	// but a ticker is simple and effective for a daily task.
+	log.Println("Starting data retention cron job...")
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	// Run once on startup, then continue on the ticker schedule.
+	s.purgeOldRecords(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping data retention cron job.")
+			return
+		case <-ticker.C:
+			s.purgeOldRecords(ctx)
+		}
+	}
+}
+
+// purgeOldRecords applies each slug's retention policy: raw checks and minute rollups past the
+// raw period, hourly rollups past the hourly period and daily rollups past the daily period are
+// deleted. Raw checks are folded into the rollups before they are deleted, so long-term history survives.
+func (s *Service) purgeOldRecords(ctx context.Context) {
+	slugs, err := s.store.ListSlugs(ctx)
+	if err != nil {
+		log.Printf("Error: Failed to list slugs for retention: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, slug := range slugs {
+		purged, err := s.store.PurgeSlug(ctx, slug, s.retentionFor(slug), now)
+		if err != nil {
+			log.Printf("Error: Failed to apply retention to slug '%s': %v", slug, err)
+			continue
+		}
+		if len(purged) > 0 {
+			log.Printf("Retention for slug '%s' purged %s.", slug, strings.Join(purged, ", "))
+		}
+	}
+}
+
+// ListSlugs returns every slug in the monitors table.
+func (s *sqlStore) ListSlugs(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT slug FROM monitors`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list slugs: %w", err)
+	}
+	defer rows.Close()
+
+	var slugs []string
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, fmt.Errorf("failed to scan slug: %w", err)
+		}
+		slugs = append(slugs, slug)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration for slugs: %w", err)
+	}
+	return slugs, nil
+}
+
+// PurgeSlug applies a retention policy to the data of one slug in a single transaction.
+func (s *sqlStore) PurgeSlug(ctx context.Context, slug string, policy RetentionPolicy, now time.Time) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tiers := []struct {
+		table  string
+		column string
+		keep   Duration
+	}{
+		{"log_entries", "timestamp", policy.Raw},
+		{ResolutionMinute.table(), "bucket_start", policy.Raw},
+		{ResolutionHour.table(), "bucket_start", policy.Hourly},
+		{ResolutionDay.table(), "bucket_start", policy.Daily},
+	}
+
+	var purged []string
+	for _, tier := range tiers {
+		if tier.keep == 0 {
+			continue
+		}
+		cutoff := now.Add(-time.Duration(tier.keep)).Unix()
+
+		if tier.table == "log_entries" {
+			// Anything not yet counted into the rollups must be before its raw rows go.
+			if _, err := s.foldIntoRollups(ctx, tx, `rolled_up = 0 AND monitor_slug = ? AND timestamp < ?`, slug, cutoff); err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, s.q(`DELETE FROM `+tier.table+` WHERE monitor_slug = ? AND `+tier.column+` < ?`), slug, cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge %s: %w", tier.table, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			purged = append(purged, fmt.Sprintf("%d from %s", n, tier.table))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit retention: %w", err)
+	}
+	return purged, nil
+}
@@ -0,0 +1,569 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Resolution is the bucket size of a rollup table.
+type Resolution string
+
+const (
+	// ResolutionMinute aggregates checks per minute.
+	ResolutionMinute Resolution = "minute"
+	// ResolutionHour aggregates checks per hour.
+	ResolutionHour Resolution = "hour"
+	// ResolutionDay aggregates checks per local calendar day.
+	ResolutionDay Resolution = "day"
+)
+
+// resolutions lists the rollup resolutions from finest to coarsest.
+var resolutions = []Resolution{ResolutionMinute, ResolutionHour, ResolutionDay}
+
+// rollupBuckets is the number of latency histogram buckets stored per rollup:
+// one per DefaultLatencyBuckets bound plus a final unbounded bucket.
+var rollupBuckets = len(DefaultLatencyBuckets) + 1
+
+// rollupBounds are the latency histogram bounds of the rollup tables. They are fixed
+// when the tables are created and must not change afterwards.
+var rollupBounds = append([]float64(nil), DefaultLatencyBuckets...)
+
+// Rollup is a pre-aggregated summary of a monitor's checks within one time bucket.
+type Rollup struct {
+	BucketStart  int64   `json:"bucket_start"`
+	Up           int     `json:"up"`
+	Degraded     int     `json:"degraded"`
+	Down         int     `json:"down"`
+	Unknown      int     `json:"unknown"`
+	LatencyCount int     `json:"latency_count"`
+	LatencySum   float64 `json:"latency_sum"`
+	LatencyMin   float64 `json:"latency_min"`
+	LatencyMax   float64 `json:"latency_max"`
+	// Histogram counts checks per latency bucket, used as a mergeable percentile sketch.
+	Histogram []int `json:"histogram"`
+}
+
+// table returns the name of the rollup table for a resolution.
+func (r Resolution) table() string {
+	switch r {
+	case ResolutionMinute:
+		return "rollups_minute"
+	case ResolutionHour:
+		return "rollups_hourly"
+	default:
+		return "rollups_daily"
+	}
+}
+
+// bucketStart returns the start of the bucket containing the Unix timestamp ts.
+// Minute and hour buckets are aligned to UTC; day buckets start at local midnight.
+func (r Resolution) bucketStart(ts int64) int64 {
+	switch r {
+	case ResolutionMinute:
+		return ts - mod(ts, 60)
+	case ResolutionHour:
+		return ts - mod(ts, 3600)
+	default:
+		t := time.Unix(ts, 0)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Unix()
+	}
+}
+
+// nextBucket returns the start of the bucket following the one starting at start.
+func (r Resolution) nextBucket(start int64) int64 {
+	switch r {
+	case ResolutionMinute:
+		return start + 60
+	case ResolutionHour:
+		return start + 3600
+	default:
+		t := time.Unix(start, 0)
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Unix()
+	}
+}
+
+// mod returns the non-negative remainder of a divided by b.
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+// histogramColumns returns the names of the histogram columns of a rollup table.
+func histogramColumns() []string {
+	columns := make([]string, rollupBuckets)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("hist_%d", i)
+	}
+	return columns
+}
+
+// newRollup returns an empty rollup for the bucket starting at start.
+func newRollup(start int64) Rollup {
+	return Rollup{BucketStart: start, Histogram: make([]int, rollupBuckets)}
+}
+
+// add counts a single check into the rollup.
+func (r *Rollup) add(entry MonitorLogEntry) {
+	switch entry.State {
+	case StateUp:
+		r.Up++
+	case StateDegraded:
+		r.Degraded++
+	case StateDown:
+		r.Down++
+	default:
+		r.Unknown++
+	}
+	if !entry.State.CountsTowardsUptime() {
+		return
+	}
+	if r.LatencyCount == 0 || entry.Time < r.LatencyMin {
+		r.LatencyMin = entry.Time
+	}
+	if r.LatencyCount == 0 || entry.Time > r.LatencyMax {
+		r.LatencyMax = entry.Time
+	}
+	r.LatencyCount++
+	r.LatencySum += entry.Time
+	r.Histogram[latencyBucket(entry.Time)]++
+}
+
+// merge adds the counts of another rollup into r.
+func (r *Rollup) merge(other Rollup) {
+	r.Up += other.Up
+	r.Degraded += other.Degraded
+	r.Down += other.Down
+	r.Unknown += other.Unknown
+	if other.LatencyCount > 0 {
+		if r.LatencyCount == 0 || other.LatencyMin < r.LatencyMin {
+			r.LatencyMin = other.LatencyMin
+		}
+		if r.LatencyCount == 0 || other.LatencyMax > r.LatencyMax {
+			r.LatencyMax = other.LatencyMax
+		}
+	}
+	r.LatencyCount += other.LatencyCount
+	r.LatencySum += other.LatencySum
+	for i := range r.Histogram {
+		if i < len(other.Histogram) {
+			r.Histogram[i] += other.Histogram[i]
+		}
+	}
+}
+
+// Total returns the number of checks in the rollup.
+func (r Rollup) Total() int {
+	return r.Up + r.Degraded + r.Down + r.Unknown
+}
+
+// UptimePercent returns the share of counted checks that were up or degraded.
+func (r Rollup) UptimePercent() float64 {
+	counted := r.Up + r.Degraded + r.Down
+	if counted == 0 {
+		return 0
+	}
+	return float64(r.Up+r.Degraded) / float64(counted) * 100
+}
+
+// AverageLatency returns the mean response time of the counted checks.
+func (r Rollup) AverageLatency() float64 {
+	if r.LatencyCount == 0 {
+		return 0
+	}
+	return r.LatencySum / float64(r.LatencyCount)
+}
+
+// Percentile estimates a latency percentile (0-100) from the histogram by interpolating
+// linearly within the bucket that holds the nearest rank.
+func (r Rollup) Percentile(p float64) float64 {
+	if r.LatencyCount == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(r.LatencyCount)
+	seen := 0
+	for i, count := range r.Histogram {
+		if count == 0 || float64(seen+count) < rank {
+			seen += count
+			continue
+		}
+		lower, upper := r.LatencyMin, r.LatencyMax
+		if i > 0 && rollupBounds[i-1] > lower {
+			lower = rollupBounds[i-1]
+		}
+		if i < len(rollupBounds) && rollupBounds[i] < upper {
+			upper = rollupBounds[i]
+		}
+		fraction := (rank - float64(seen)) / float64(count)
+		if fraction < 0 {
+			fraction = 0
+		}
+		return lower + (upper-lower)*fraction
+	}
+	return r.LatencyMax
+}
+
+// LatencyStats converts the rollup into approximate latency statistics.
+func (r Rollup) LatencyStats() *LatencyStats {
+	return &LatencyStats{
+		Count:       r.LatencyCount,
+		Min:         r.LatencyMin,
+		Avg:         r.AverageLatency(),
+		P50:         r.Percentile(50),
+		P90:         r.Percentile(90),
+		P95:         r.Percentile(95),
+		P99:         r.Percentile(99),
+		Max:         r.LatencyMax,
+		Approximate: true,
+	}
+}
+
+// latencyBucket returns the index of the rollup histogram bucket for a response time.
+func latencyBucket(ms float64) int {
+	for i, bound := range rollupBounds {
+		if ms <= bound {
+			return i
+		}
+	}
+	return len(rollupBounds)
+}
+
+// createRollupTables creates the rollup tables if they don't exist and folds in any stored
+// checks that have not been counted into them yet.
+func createRollupTables(ctx context.Context, s *sqlStore, tx *sql.Tx) error {
+	var histogram strings.Builder
+	for _, column := range histogramColumns() {
+		fmt.Fprintf(&histogram, "            %s INTEGER NOT NULL DEFAULT 0,\n", column)
+	}
+	for _, res := range resolutions {
+		_, err := tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS `+res.table()+` (
+            monitor_slug TEXT NOT NULL,
+            monitor_name TEXT NOT NULL,
+            bucket_start INTEGER NOT NULL,
+            up_count INTEGER NOT NULL DEFAULT 0,
+            degraded_count INTEGER NOT NULL DEFAULT 0,
+            down_count INTEGER NOT NULL DEFAULT 0,
+            unknown_count INTEGER NOT NULL DEFAULT 0,
+            latency_count INTEGER NOT NULL DEFAULT 0,
+            latency_sum REAL NOT NULL DEFAULT 0,
+            latency_min REAL NOT NULL DEFAULT 0,
+            latency_max REAL NOT NULL DEFAULT 0,
+`+histogram.String()+`            PRIMARY KEY (monitor_slug, monitor_name, bucket_start),
+            FOREIGN KEY(monitor_slug, monitor_name) REFERENCES monitors(slug, name) ON DELETE CASCADE
+        );
+    `)
+		if err != nil {
+			return fmt.Errorf("error creating %s table: %w", res.table(), err)
+		}
+	}
+
+	n, err := s.foldIntoRollups(ctx, tx, `rolled_up = 0`)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Backfilled rollups from %d log entries.", n)
+	}
+	return nil
+}
+
+// foldIntoRollups adds the log entries matching filter to every rollup table, marks them as
+// rolled up and returns how many entries were folded. filter must exclude rolled up entries.
+func (s *sqlStore) foldIntoRollups(ctx context.Context, tx *sql.Tx, filter string, args ...interface{}) (int, error) {
+	rows, err := tx.QueryContext(ctx, s.q(`
+		SELECT monitor_slug, monitor_name, timestamp, time, state
+		FROM log_entries WHERE `+filter), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read log entries for rollups: %w", err)
+	}
+
+	type bucketKey struct {
+		res        Resolution
+		slug, name string
+		start      int64
+	}
+	buckets := make(map[bucketKey]*Rollup)
+	count := 0
+	for rows.Next() {
+		var slug, name, state string
+		var entry MonitorLogEntry
+		if err := rows.Scan(&slug, &name, &entry.Timestamp, &entry.Time, &state); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan log entry for rollups: %w", err)
+		}
+		entry.State = State(state)
+		for _, res := range resolutions {
+			key := bucketKey{res, slug, name, res.bucketStart(entry.Timestamp)}
+			r, ok := buckets[key]
+			if !ok {
+				rollup := newRollup(key.start)
+				r = &rollup
+				buckets[key] = r
+			}
+			r.add(entry)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("error during rows iteration for rollups: %w", err)
+	}
+	rows.Close()
+
+	for key, r := range buckets {
+		if err := s.upsertRollup(ctx, tx, key.res, key.slug, key.name, *r); err != nil {
+			return 0, err
+		}
+	}
+	if count > 0 {
+		if _, err := tx.ExecContext(ctx, s.q(`UPDATE log_entries SET rolled_up = 1 WHERE `+filter), args...); err != nil {
+			return 0, fmt.Errorf("failed to mark log entries as rolled up: %w", err)
+		}
+	}
+	return count, nil
+}
+
+// upsertRollup merges a rollup into the stored bucket, creating the bucket if needed.
+func (s *sqlStore) upsertRollup(ctx context.Context, tx *sql.Tx, res Resolution, slug, name string, r Rollup) error {
+	table := res.table()
+	hist := histogramColumns()
+
+	columns := append([]string{"monitor_slug", "monitor_name", "bucket_start", "up_count", "degraded_count",
+		"down_count", "unknown_count", "latency_count", "latency_sum", "latency_min", "latency_max"}, hist...)
+	args := []interface{}{slug, name, r.BucketStart, r.Up, r.Degraded, r.Down, r.Unknown,
+		r.LatencyCount, r.LatencySum, r.LatencyMin, r.LatencyMax}
+	for _, count := range r.Histogram {
+		args = append(args, count)
+	}
+
+	sums := append([]string{"up_count", "degraded_count", "down_count", "unknown_count", "latency_count", "latency_sum"}, hist...)
+	updates := make([]string, 0, len(sums)+2)
+	for _, c := range sums {
+		updates = append(updates, fmt.Sprintf("%s = %s.%s + excluded.%s", c, table, c, c))
+	}
+	// An empty side must not drag the min/max towards zero. Every SET expression sees the
+	// row as it was before the update, so latency_count here is still the stored count.
+	updates = append(updates,
+		fmt.Sprintf(`latency_min = CASE WHEN excluded.latency_count = 0 THEN %[1]s.latency_min
+			WHEN %[1]s.latency_count = 0 OR excluded.latency_min < %[1]s.latency_min THEN excluded.latency_min
+			ELSE %[1]s.latency_min END`, table),
+		fmt.Sprintf(`latency_max = CASE WHEN excluded.latency_count = 0 THEN %[1]s.latency_max
+			WHEN %[1]s.latency_count = 0 OR excluded.latency_max > %[1]s.latency_max THEN excluded.latency_max
+			ELSE %[1]s.latency_max END`, table))
+
+	_, err := tx.ExecContext(ctx, s.q(`
+		INSERT INTO `+table+` (`+strings.Join(columns, ", ")+`)
+		VALUES (`+strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")+`)
+		ON CONFLICT(monitor_slug, monitor_name, bucket_start) DO UPDATE SET `+strings.Join(updates, ", ")),
+		args...)
+	if err != nil {
+		return fmt.Errorf("failed to update %s for %s/%s: %w", table, slug, name, err)
+	}
+	return nil
+}
+
+// addToRollups counts a newly saved check into every rollup table.
+func (s *sqlStore) addToRollups(ctx context.Context, tx *sql.Tx, slug, name string, entry MonitorLogEntry) error {
+	for _, res := range resolutions {
+		r := newRollup(res.bucketStart(entry.Timestamp))
+		r.add(entry)
+		if err := s.upsertRollup(ctx, tx, res, slug, name, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRollups returns the stored rollups of a monitor at a given resolution whose buckets start
+// within [start, end), oldest first.
+func (s *Service) GetRollups(ctx context.Context, monitorSlug, monitorName string, res Resolution, start, end int64) ([]Rollup, error) {
+	if !s.isConfigured(monitorSlug, monitorName) {
+		return nil, fmt.Errorf("monitor '%s/%s' not found in configuration", monitorSlug, monitorName)
+	}
+	return s.store.Rollups(ctx, res, monitorSlug, monitorName, start, end)
+}
+
+// Rollups returns the rollups of a monitor whose buckets start within [start, end), oldest first.
+func (s *sqlStore) Rollups(ctx context.Context, res Resolution, monitorSlug, monitorName string, start, end int64) ([]Rollup, error) {
+	rows, err := s.db.QueryContext(ctx, s.q(`
+		SELECT `+rollupSelectColumns("bucket_start")+`
+		FROM `+res.table()+`
+		WHERE monitor_slug = ? AND monitor_name = ? AND bucket_start >= ? AND bucket_start < ?
+		GROUP BY bucket_start
+		ORDER BY bucket_start ASC
+	`), monitorSlug, monitorName, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s for %s/%s: %w", res.table(), monitorSlug, monitorName, err)
+	}
+	defer rows.Close()
+
+	var rollups []Rollup
+	for rows.Next() {
+		r, err := scanRollup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s for %s/%s: %w", res.table(), monitorSlug, monitorName, err)
+		}
+		rollups = append(rollups, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+
+	return rollups, nil
+}
+
+// rollupSelectColumns returns the aggregate expressions that merge rollup rows, in scanRollup order.
+// bucket is the expression reported as the bucket start.
+func rollupSelectColumns(bucket string) string {
+	columns := []string{
+		"COALESCE(" + bucket + ", 0)",
+		"COALESCE(SUM(up_count), 0)",
+		"COALESCE(SUM(degraded_count), 0)",
+		"COALESCE(SUM(down_count), 0)",
+		"COALESCE(SUM(unknown_count), 0)",
+		"COALESCE(SUM(latency_count), 0)",
+		"COALESCE(SUM(latency_sum), 0)",
+		"COALESCE(MIN(CASE WHEN latency_count > 0 THEN latency_min END), 0)",
+		"COALESCE(MAX(CASE WHEN latency_count > 0 THEN latency_max END), 0)",
+	}
+	for _, column := range histogramColumns() {
+		columns = append(columns, "COALESCE(SUM("+column+"), 0)")
+	}
+	return strings.Join(columns, ", ")
+}
+
+// scanRollup reads a row produced by rollupSelectColumns.
+func scanRollup(row interface{ Scan(...interface{}) error }) (Rollup, error) {
+	r := newRollup(0)
+	dest := []interface{}{&r.BucketStart, &r.Up, &r.Degraded, &r.Down, &r.Unknown,
+		&r.LatencyCount, &r.LatencySum, &r.LatencyMin, &r.LatencyMax}
+	for i := range r.Histogram {
+		dest = append(dest, &r.Histogram[i])
+	}
+	err := row.Scan(dest...)
+	return r, err
+}
+
+// aggregateRange summarises a monitor's checks in [start, end) by combining the coarsest rollups
+// that fit inside the range: whole days, then whole hours, then whole minutes, with the raw log
+// entries covering only the partial minutes at either edge.
+func (s *Service) aggregateRange(ctx context.Context, monitorSlug, monitorName string, start, end int64) (Rollup, error) {
+	total := newRollup(start)
+	if end <= start {
+		return total, nil
+	}
+
+	merge := func(r Rollup, err error) error {
+		if err != nil {
+			return err
+		}
+		total.merge(r)
+		return nil
+	}
+
+	// Carve the range into aligned segments, from the outside in.
+	minuteStart := ResolutionMinute.bucketStart(start + 59)
+	minuteEnd := ResolutionMinute.bucketStart(end)
+	if minuteStart >= minuteEnd {
+		return total, merge(s.store.AggregateChecks(ctx, monitorSlug, monitorName, start, end))
+	}
+	if err := merge(s.store.AggregateChecks(ctx, monitorSlug, monitorName, start, minuteStart)); err != nil {
+		return total, err
+	}
+	if err := merge(s.store.AggregateChecks(ctx, monitorSlug, monitorName, minuteEnd, end)); err != nil {
+		return total, err
+	}
+
+	hourStart := ResolutionHour.bucketStart(minuteStart + 3599)
+	hourEnd := ResolutionHour.bucketStart(minuteEnd)
+	if hourStart >= hourEnd {
+		return total, merge(s.store.AggregateRollups(ctx, ResolutionMinute, monitorSlug, monitorName, minuteStart, minuteEnd))
+	}
+	if err := merge(s.store.AggregateRollups(ctx, ResolutionMinute, monitorSlug, monitorName, minuteStart, hourStart)); err != nil {
+		return total, err
+	}
+	if err := merge(s.store.AggregateRollups(ctx, ResolutionMinute, monitorSlug, monitorName, hourEnd, minuteEnd)); err != nil {
+		return total, err
+	}
+
+	// Day buckets start at local midnight, which only lines up with hour buckets in
+	// time zones with whole-hour offsets; otherwise hours are used throughout.
+	dayStart := ResolutionDay.bucketStart(hourStart)
+	if dayStart < hourStart {
+		dayStart = ResolutionDay.nextBucket(dayStart)
+	}
+	dayEnd := ResolutionDay.bucketStart(hourEnd)
+	if dayStart >= dayEnd || mod(dayStart, 3600) != 0 || mod(dayEnd, 3600) != 0 {
+		return total, merge(s.store.AggregateRollups(ctx, ResolutionHour, monitorSlug, monitorName, hourStart, hourEnd))
+	}
+	if err := merge(s.store.AggregateRollups(ctx, ResolutionHour, monitorSlug, monitorName, hourStart, dayStart)); err != nil {
+		return total, err
+	}
+	if err := merge(s.store.AggregateRollups(ctx, ResolutionHour, monitorSlug, monitorName, dayEnd, hourEnd)); err != nil {
+		return total, err
+	}
+	return total, merge(s.store.AggregateRollups(ctx, ResolutionDay, monitorSlug, monitorName, dayStart, dayEnd))
+}
+
+// AggregateRollups merges the rollups of a monitor whose buckets start within [start, end).
+func (s *sqlStore) AggregateRollups(ctx context.Context, res Resolution, monitorSlug, monitorName string, start, end int64) (Rollup, error) {
+	if end <= start {
+		return newRollup(start), nil
+	}
+	r, err := scanRollup(s.db.QueryRowContext(ctx, s.q(`
+		SELECT `+rollupSelectColumns("MIN(bucket_start)")+`
+		FROM `+res.table()+`
+		WHERE monitor_slug = ? AND monitor_name = ? AND bucket_start >= ? AND bucket_start < ?
+	`), monitorSlug, monitorName, start, end))
+	if err != nil {
+		return r, fmt.Errorf("failed to aggregate %s for %s/%s: %w", res.table(), monitorSlug, monitorName, err)
+	}
+	return r, nil
+}
+
+// AggregateChecks summarises the raw log entries of a monitor within [start, end).
+func (s *sqlStore) AggregateChecks(ctx context.Context, monitorSlug, monitorName string, start, end int64) (Rollup, error) {
+	r := newRollup(start)
+	if end <= start {
+		return r, nil
+	}
+	rows, err := s.db.QueryContext(ctx, s.q(`
+		SELECT timestamp, time, state FROM log_entries
+		WHERE monitor_slug = ? AND monitor_name = ? AND timestamp >= ? AND timestamp < ?
+	`), monitorSlug, monitorName, start, end)
+	if err != nil {
+		return r, fmt.Errorf("failed to query log entries for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry MonitorLogEntry
+		var state string
+		if err := rows.Scan(&entry.Timestamp, &entry.Time, &state); err != nil {
+			return r, fmt.Errorf("failed to scan log entry for %s/%s: %w", monitorSlug, monitorName, err)
+		}
+		entry.State = State(state)
+		r.add(entry)
+	}
+	return r, rows.Err()
+}
+
+// GetRangeSummary summarises a monitor's checks within [start, end) from the rollup tables.
+func (s *Service) GetRangeSummary(ctx context.Context, monitorSlug, monitorName string, start, end int64) (*Rollup, error) {
+	if !s.isConfigured(monitorSlug, monitorName) {
+		return nil, fmt.Errorf("monitor '%s/%s' not found in configuration", monitorSlug, monitorName)
+	}
+	r, err := s.aggregateRange(ctx, monitorSlug, monitorName, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,258 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultDiscoveryRefreshInterval is how often file and DNS SRV discovery look for targets when
+// no refresh_interval is configured.
+const DefaultDiscoveryRefreshInterval = 30 * time.Second
+
+// discoveryConfig is the file that configures the file and DNS SRV discovery providers.
+type discoveryConfig struct {
+	FileSD []struct {
+		Name            string                 `json:"name"`
+		Files           []string               `json:"files"`
+		RefreshInterval Duration               `json:"refresh_interval"`
+		Monitor         map[string]interface{} `json:"monitor"`
+	} `json:"file_sd"`
+	DNSSRV []struct {
+		Name            string                 `json:"name"`
+		Records         []string               `json:"records"`
+		Nameserver      string                 `json:"nameserver"`
+		RefreshInterval Duration               `json:"refresh_interval"`
+		Labels          map[string]string      `json:"labels"`
+		Monitor         map[string]interface{} `json:"monitor"`
+	} `json:"dns_srv"`
+}
+
+// LoadDiscoveryConfig reads the file and DNS SRV discovery providers configured in the JSON, YAML
+// or TOML file at path:
+//
+//	file_sd:
+//	  - name: web
+//	    files: ["targets/*.json"]
+//	    monitor:
+//	      name: "{{.Labels.service}}-{{.Host}}"
+//	      url: "http://{{.Target}}/health"
+//	dns_srv:
+//	  - name: api
+//	    records: ["_http._tcp.api.example.com"]
+//
+// Each provider expands every target it finds into a monitor from its monitor template, whose
+// strings are Go templates of the target. The error lists every problem found as ConfigErrors.
+func LoadDiscoveryConfig(path string) ([]DiscoveryProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read discovery configuration: %w", err)
+	}
+	f := &configFile{name: path}
+	doc, err := f.decode(data)
+	if err != nil {
+		return nil, f.errs
+	}
+	if doc == nil {
+		return nil, nil
+	}
+	doc = f.expandEnv(nil, doc)
+	f.checkValue(nil, doc, reflect.TypeOf(discoveryConfig{}))
+	if len(f.errs) > 0 {
+		return nil, f.errs
+	}
+	var config discoveryConfig
+	if err := decodeAs(doc, &config); err != nil {
+		f.errorf(nil, "%v", err)
+		return nil, f.errs
+	}
+
+	dir := filepath.Dir(path)
+	var providers []DiscoveryProvider
+	names := map[string]bool{SourceFile: true, SourceAPI: true, "docker": true, "kubernetes": true}
+	checkName := func(path configPath, name string) {
+		switch {
+		case name == "":
+			f.errorf(path.with("name"), "name is required")
+		case names[name]:
+			f.errorf(path.with("name"), "name '%s' is already used by another source of monitors", name)
+		}
+		names[name] = true
+	}
+	for i, c := range config.FileSD {
+		path := configPath{"file_sd", i}
+		checkName(path, c.Name)
+		if len(c.Files) == 0 {
+			f.errorf(path.with("files"), "at least one file is required")
+		}
+		// Relative patterns are relative to the discovery configuration.
+		files := make([]string, len(c.Files))
+		for j, pattern := range c.Files {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				f.errorf(path.with("files").with(j), "invalid pattern %q", pattern)
+			}
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(dir, pattern)
+			}
+			files[j] = pattern
+		}
+		tmpl := f.checkTemplate(path.with("monitor"), c.Name, c.Monitor)
+		providers = append(providers, &FileDiscovery{
+			name:            c.Name,
+			files:           files,
+			refreshInterval: refreshInterval(c.RefreshInterval),
+			template:        tmpl,
+		})
+	}
+	for i, c := range config.DNSSRV {
+		path := configPath{"dns_srv", i}
+		checkName(path, c.Name)
+		if len(c.Records) == 0 {
+			f.errorf(path.with("records"), "at least one record is required")
+		}
+		if c.Nameserver != "" {
+			if _, _, err := net.SplitHostPort(c.Nameserver); err != nil {
+				f.errorf(path.with("nameserver"), "expected host:port, got %q", c.Nameserver)
+			}
+		}
+		tmpl := f.checkTemplate(path.with("monitor"), c.Name, c.Monitor)
+		providers = append(providers, &DNSSRVDiscovery{
+			name:            c.Name,
+			records:         c.Records,
+			nameserver:      c.Nameserver,
+			labels:          c.Labels,
+			refreshInterval: refreshInterval(c.RefreshInterval),
+			template:        tmpl,
+		})
+	}
+	sort.SliceStable(f.errs, func(i, j int) bool { return f.errs[i].Line < f.errs[j].Line })
+	if len(f.errs) > 0 {
+		return nil, f.errs
+	}
+	return providers, nil
+}
+
+// refreshInterval returns a configured refresh interval, or the default if it is not set.
+func refreshInterval(d Duration) time.Duration {
+	if d <= 0 {
+		return DefaultDiscoveryRefreshInterval
+	}
+	return time.Duration(d)
+}
+
+// discoveredTarget is the data a monitor template is executed with.
+type discoveredTarget struct {
+	// Target is the address of the target as found, such as "10.0.0.1:8080".
+	Target string
+	// Host and Port split Target; Port is empty if it has none.
+	Host, Port string
+	// Labels are the labels of the target, which the monitor also carries.
+	Labels map[string]string
+}
+
+// newDiscoveredTarget splits the address of a target and carries its labels.
+func newDiscoveredTarget(target string, labels map[string]string) discoveredTarget {
+	t := discoveredTarget{Target: target, Host: target, Labels: labels}
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		t.Host, t.Port = host, port
+	}
+	return t
+}
+
+// monitorTemplate expands discovered targets into monitors.
+type monitorTemplate struct {
+	// values are the monitor settings, whose strings are templates.
+	values map[string]interface{}
+}
+
+// checkTemplate checks the monitor template of a provider and fills in its defaults: the slug is
+// the provider name, the name the target and the URL http://<target>/. The strings of the template
+// are parsed, and its keys must be monitor settings other than id and source.
+func (f *configFile) checkTemplate(path configPath, provider string, values map[string]interface{}) *monitorTemplate {
+	tmpl := &monitorTemplate{values: map[string]interface{}{
+		"slug": provider,
+		"name": "{{.Target}}",
+		"url":  "http://{{.Target}}/",
+	}}
+	fields := jsonFields(reflect.TypeOf(Monitor{}))
+	for _, key := range sortedKeys(values) {
+		switch _, ok := fields[key]; {
+		case !ok:
+			f.errorf(path.with(key), "unknown key '%s'", key)
+		case key == "id" || key == "source":
+			f.errorf(path.with(key), "%s cannot be set for discovered monitors", key)
+		}
+		tmpl.values[key] = values[key]
+	}
+	walkStrings(path, tmpl.values, func(path configPath, s string) string {
+		if _, err := parseMonitorTemplate(s); err != nil {
+			f.errorf(path, "invalid template: %v", err)
+		}
+		return s
+	})
+	return tmpl
+}
+
+// parseMonitorTemplate parses one string of a monitor template. Missing labels expand to "".
+func parseMonitorTemplate(s string) (*template.Template, error) {
+	return template.New("").Option("missingkey=zero").Parse(s)
+}
+
+// expand builds the monitor of a target. The monitor carries the labels of the target, under the
+// ones set by the template. The error lists every problem found as ConfigErrors.
+func (t *monitorTemplate) expand(target discoveredTarget) (Monitor, error) {
+	var errs ConfigErrors
+	values := walkStrings(nil, t.values, func(path configPath, s string) string {
+		tmpl, err := parseMonitorTemplate(s)
+		var out strings.Builder
+		if err == nil {
+			err = tmpl.Execute(&out, target)
+		}
+		if err != nil {
+			errs = append(errs, ConfigError{Message: fmt.Sprintf("%s: %v", path, err)})
+		}
+		return out.String()
+	}).(map[string]interface{})
+	if len(errs) > 0 {
+		return Monitor{}, errs
+	}
+
+	if len(target.Labels) > 0 {
+		labels := make(map[string]interface{}, len(target.Labels))
+		for key, value := range target.Labels {
+			labels[key] = value
+		}
+		own, _ := values["labels"].(map[string]interface{})
+		values["labels"] = mergeObjects(labels, own)
+	}
+	return buildMonitor(values)
+}
+
+// walkStrings returns a copy of a decoded configuration value with every string replaced by the
+// result of fn, which is given its path.
+func walkStrings(path configPath, v interface{}, fn func(path configPath, s string) string) interface{} {
+	switch value := v.(type) {
+	case string:
+		return fn(path, value)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			out[key] = walkStrings(path.with(key), item, fn)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+			out[i] = walkStrings(path.with(i), item, fn)
+		}
+		return out
+	default:
+		return v
+	}
+}
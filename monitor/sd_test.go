@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestTemplate checks a monitor template for the provider "web", failing the test on errors.
+func newTestTemplate(t *testing.T, values map[string]interface{}) *monitorTemplate {
+	t.Helper()
+	f := &configFile{name: "discovery.yaml", line: func(configPath) int { return 0 }}
+	tmpl := f.checkTemplate(configPath{"file_sd", 0, "monitor"}, "web", values)
+	if len(f.errs) > 0 {
+		t.Fatalf("checkTemplate: %v", f.errs)
+	}
+	return tmpl
+}
+
+func TestMonitorTemplateExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		target  string
+		labels  map[string]string
+		want    Monitor
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			target: "10.0.0.1:8080",
+			want:   Monitor{Slug: "web", Name: "10.0.0.1:8080", URL: "http://10.0.0.1:8080/"},
+		},
+		{
+			name: "templated name and url",
+			values: map[string]interface{}{
+				"name": "{{.Labels.service}}-{{.Host}}",
+				"url":  "https://{{.Host}}:{{.Port}}/health",
+			},
+			target: "10.0.0.1:8443",
+			labels: map[string]string{"service": "api"},
+			want: Monitor{Slug: "web", Name: "api-10.0.0.1", URL: "https://10.0.0.1:8443/health",
+				Labels: map[string]string{"service": "api"}},
+		},
+		{
+			name:   "target without a port",
+			values: map[string]interface{}{"url": "http://{{.Host}}{{if .Port}}:{{.Port}}{{end}}/"},
+			target: "db.example.com",
+			want:   Monitor{Slug: "web", Name: "db.example.com", URL: "http://db.example.com/"},
+		},
+		{
+			name: "template labels override target labels",
+			values: map[string]interface{}{
+				"labels": map[string]interface{}{"team": "{{.Labels.env}}-ops", "tier": "frontend"},
+			},
+			target: "10.0.0.1:80",
+			labels: map[string]string{"env": "prod", "team": "web"},
+			want: Monitor{Slug: "web", Name: "10.0.0.1:80", URL: "http://10.0.0.1:80/",
+				Labels: map[string]string{"env": "prod", "team": "prod-ops", "tier": "frontend"}},
+		},
+		{
+			name:   "missing labels are empty",
+			values: map[string]interface{}{"name": "{{.Labels.service}}{{.Host}}"},
+			target: "10.0.0.1:80",
+			want:   Monitor{Slug: "web", Name: "10.0.0.1", URL: "http://10.0.0.1:80/"},
+		},
+		{
+			name:   "other settings",
+			values: map[string]interface{}{"interval": "{{.Labels.interval}}", "paused": true},
+			target: "10.0.0.1:80",
+			labels: map[string]string{"interval": "30s"},
+			want: Monitor{Slug: "web", Name: "10.0.0.1:80", URL: "http://10.0.0.1:80/",
+				Labels: map[string]string{"interval": "30s"}, Interval: Duration(30e9), Paused: true},
+		},
+		{
+			name:    "unknown field",
+			values:  map[string]interface{}{"name": "{{.Service}}"},
+			target:  "10.0.0.1:80",
+			wantErr: "can't evaluate field Service",
+		},
+		{
+			name:    "invalid monitor",
+			values:  map[string]interface{}{"url": "{{.Labels.url}}"},
+			target:  "10.0.0.1:80",
+			wantErr: "url is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newTestTemplate(t, tt.values).expand(newDiscoveredTarget(tt.target, tt.labels))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expand() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expand() error = %v", err)
+			}
+			if !reflect.DeepEqual(m, tt.want) {
+				t.Errorf("expand() = %+v, want %+v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonitorTemplateExpandDoesNotChangeTemplate(t *testing.T) {
+	tmpl := newTestTemplate(t, map[string]interface{}{
+		"labels": map[string]interface{}{"team": "{{.Labels.team}}"},
+	})
+	for _, team := range []string{"a", "b"} {
+		m, err := tmpl.expand(newDiscoveredTarget("10.0.0.1:80", map[string]string{"team": team}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Labels["team"] != team {
+			t.Errorf("labels = %v, want team %s", m.Labels, team)
+		}
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		want   []string
+	}{
+		{"empty", nil, nil},
+		{"valid", map[string]interface{}{"name": "{{.Host}}", "headers": map[string]interface{}{"Host": "{{.Labels.vhost}}"}}, nil},
+		{"unknown key", map[string]interface{}{"target": "x"}, []string{"unknown key 'target'"}},
+		{"id", map[string]interface{}{"id": "x"}, []string{"id cannot be set for discovered monitors"}},
+		{"source", map[string]interface{}{"source": "x"}, []string{"source cannot be set for discovered monitors"}},
+		{"invalid template", map[string]interface{}{"url": "http://{{.Target/"}, []string{"invalid template"}},
+		{"invalid nested template", map[string]interface{}{"labels": map[string]interface{}{"a": "{{end}}"}}, []string{"invalid template"}},
+		{"every problem", map[string]interface{}{"id": "x", "name": "{{"}, []string{"id cannot be set", "invalid template"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &configFile{name: "discovery.yaml", line: func(configPath) int { return 0 }}
+			f.checkTemplate(configPath{"file_sd", 0, "monitor"}, "web", tt.values)
+			if len(f.errs) != len(tt.want) {
+				t.Fatalf("checkTemplate() errors = %v, want %d", f.errs, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(f.errs[i].Error(), want) {
+					t.Errorf("error %d = %q, want one containing %q", i, f.errs[i].Error(), want)
+				}
+			}
+		})
+	}
+}
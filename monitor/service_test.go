@@ -0,0 +1,219 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestSite serves 200 OK to every check.
+func newTestSite(t *testing.T) *httptest.Server {
+	t.Helper()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+// writeConfig writes a monitors configuration file.
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTestService starts a service with a SQLite database and the given monitors.json in a
+// temporary directory, and closes it when the test ends. Config fields that are set are kept.
+func startTestService(t *testing.T, monitors string, config Config) *Service {
+	t.Helper()
+	dir := t.TempDir()
+	if config.ConfigPath == "" {
+		config.ConfigPath = filepath.Join(dir, "monitors.json")
+		writeConfig(t, config.ConfigPath, monitors)
+	}
+	config.DBPath = filepath.Join(dir, "guptime.db")
+	if config.CheckInterval == 0 {
+		config.CheckInterval = time.Hour
+	}
+	s, err := NewService(&config)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		s.Close(context.Background())
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Close(ctx)
+	})
+	return s
+}
+
+// recordingStore records the batches written to a store and when it is closed.
+type recordingStore struct {
+	Store
+	mu     sync.Mutex
+	events []string
+}
+
+func (s *recordingStore) SaveChecks(ctx context.Context, checks []CheckRecord) error {
+	err := s.Store.SaveChecks(ctx, checks)
+	s.record(fmt.Sprintf("save %d", len(checks)))
+	return err
+}
+
+func (s *recordingStore) Close() error {
+	s.record("close")
+	return s.Store.Close()
+}
+
+func (s *recordingStore) record(event string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+// blockingNotifier blocks every notification, whatever its context, until release is closed.
+type blockingNotifier struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, _ Notification) error {
+	close(n.entered)
+	<-n.release
+	return nil
+}
+
+// newDrainTestService starts a service whose checks are queued until it closes, storing them
+// through a recordingStore. Monitors named in up start out up.
+func newDrainTestService(t *testing.T, monitors []Monitor, notifier Notifier, up ...string) (*Service, *recordingStore) {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	sqlite, err := NewSQLiteStore(filepath.Join(dir, "guptime.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &recordingStore{Store: sqlite}
+	if _, err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := store.SyncMonitors(ctx, monitors); err != nil {
+		t.Fatalf("SyncMonitors: %v", err)
+	}
+	for _, name := range up {
+		entry := MonitorLogEntry{Timestamp: time.Now().Unix() - 60, Response: "200", State: StateUp, IntervalSeconds: 60}
+		if err := store.Store.SaveChecks(ctx, []CheckRecord{{Slug: "prod", Name: name, Entry: entry}}); err != nil {
+			t.Fatalf("SaveChecks: %v", err)
+		}
+	}
+
+	path := filepath.Join(dir, "monitors.json")
+	data, err := json.Marshal(monitors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, path, string(data))
+	s, err := NewService(&Config{Store: store, ConfigPath: path, CheckInterval: time.Hour, Notifier: notifier,
+		WriteBatchSize: 100, WriteFlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return s, store
+}
+
+// waitUntil polls done until it is true, failing the test after a few seconds.
+func waitUntil(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestServiceCloseDrainsChecks(t *testing.T) {
+	fast := newTestSite(t)
+	requested := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(30 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	s, store := newDrainTestService(t, []Monitor{
+		{Slug: "prod", Name: "fast", URL: fast.URL},
+		{Slug: "prod", Name: "slow", URL: slow.URL},
+	}, LogNotifier{})
+	<-requested
+	// A check queues its result right after recording its state, before it leaves the workers.
+	waitUntil(t, "the fast check", func() bool {
+		status := monitorStatuses(s)["prod/fast"]
+		s.statusMu.Lock()
+		defer s.statusMu.Unlock()
+		return status.State == StateUp
+	})
+
+	const drainTimeout = 2 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= drainTimeout {
+		t.Errorf("Close took %s, want the slow check cancelled within the %s drain timeout", elapsed, drainTimeout)
+	}
+	if n := s.inFlight.Load(); n != 0 {
+		t.Errorf("%d checks still in flight after Close", n)
+	}
+	// The queued check is written before the database is closed, and the cancelled one is not recorded.
+	if want := []string{"save 1", "close"}; !reflect.DeepEqual(store.events, want) {
+		t.Errorf("store events = %q, want %q", store.events, want)
+	}
+}
+
+func TestServiceCloseReportsAbandonedChecks(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer site.Close()
+	// The down alert outlives the shutdown deadline, since notifications ignore cancellation.
+	notifier := &blockingNotifier{entered: make(chan struct{}), release: make(chan struct{})}
+	s, store := newDrainTestService(t, []Monitor{{Slug: "prod", Name: "api", URL: site.URL}}, notifier, "api")
+	defer close(notifier.release)
+	<-notifier.entered
+
+	const drainTimeout = 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	start := time.Now()
+	err := s.Close(ctx)
+	if err == nil || err.Error() != "abandoned 1 in-flight checks" {
+		t.Errorf("Close error = %v, want 1 abandoned check", err)
+	}
+	if elapsed := time.Since(start); elapsed >= WriteCloseTimeout {
+		t.Errorf("Close took %s, want it to stop waiting at the %s drain timeout", elapsed, drainTimeout)
+	}
+	// The abandoned check had already queued its result, which is written before the database is closed.
+	if want := []string{"save 1", "close"}; !reflect.DeepEqual(store.events, want) {
+		t.Errorf("store events = %q, want %q", store.events, want)
+	}
+}
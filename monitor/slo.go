@@ -0,0 +1,402 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SLOType is the kind of indicator an SLO is measured against.
+type SLOType string
+
+const (
+	// SLOAvailability counts a check as good when the monitor was up or degraded.
+	SLOAvailability SLOType = "availability"
+	// SLOLatency counts a successful check as good when it completed within the SLO's threshold.
+	SLOLatency SLOType = "latency"
+)
+
+// sloEvaluationInterval is how often burn-rate alerts are evaluated.
+const sloEvaluationInterval = time.Minute
+
+// SLO is a service level objective attached to a single monitor or to every monitor under a slug.
+type SLO struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	// Monitor restricts the SLO to one monitor under Slug. When empty the SLO covers the whole slug.
+	Monitor string  `json:"monitor,omitempty"`
+	Type    SLOType `json:"type"`
+	// Target is the percentage of good checks required over Window, e.g. 99.9.
+	Target float64  `json:"target"`
+	Window Duration `json:"window"`
+	// Threshold is the latency a check must stay within to be good. Only used by latency SLOs.
+	Threshold Duration `json:"threshold,omitempty"`
+	// BurnRateAlerts overrides the default multi-window burn-rate alerts.
+	BurnRateAlerts []BurnRateAlert `json:"burn_rate_alerts,omitempty"`
+}
+
+// BurnRateAlert fires when the error budget burns faster than Threshold over both the Long and Short windows.
+type BurnRateAlert struct {
+	Long      Duration `json:"long"`
+	Short     Duration `json:"short"`
+	Threshold float64  `json:"threshold"`
+}
+
+// defaultBurnRateAlerts are the fast- and slow-burn alerts recommended for a 30-day objective:
+// 2% of the budget spent in one hour, or 5% in six hours.
+var defaultBurnRateAlerts = []BurnRateAlert{
+	{Long: Duration(time.Hour), Short: Duration(5 * time.Minute), Threshold: 14.4},
+	{Long: Duration(6 * time.Hour), Short: Duration(30 * time.Minute), Threshold: 6},
+}
+
+// SLOStatus is the current evaluation of an SLO.
+type SLOStatus struct {
+	SLO
+	TotalChecks int `json:"total_checks"`
+	GoodChecks  int `json:"good_checks"`
+	// SLI is the percentage of good checks over the SLO window.
+	SLI float64 `json:"sli"`
+	// ErrorBudgetRemaining is the percentage of the window's error budget that is left.
+	// It becomes negative once the objective has been missed.
+	ErrorBudgetRemaining float64          `json:"error_budget_remaining"`
+	BurnRates            []BurnRateStatus `json:"burn_rates"`
+	Alerting             bool             `json:"alerting"`
+	// Partial is set when a latency SLO has windows longer than the raw checks are kept for, so
+	// only the part of them that is still kept was counted.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// BurnRateStatus is the evaluation of one burn-rate alert.
+type BurnRateStatus struct {
+	BurnRateAlert
+	LongBurnRate  float64 `json:"long_burn_rate"`
+	ShortBurnRate float64 `json:"short_burn_rate"`
+	Firing        bool    `json:"firing"`
+}
+
+// key identifies the SLO for alert bookkeeping.
+func (o SLO) key() string {
+	return o.Slug + "/" + o.Monitor + "/" + o.Name
+}
+
+// alerts returns the burn-rate alerts that apply to the SLO.
+func (o SLO) alerts() []BurnRateAlert {
+	if len(o.BurnRateAlerts) > 0 {
+		return o.BurnRateAlerts
+	}
+	return defaultBurnRateAlerts
+}
+
+// validateSLOs checks SLO definitions against each other and the configured monitors.
+func validateSLOs(slos []SLO, monitors []Monitor) error {
+	slugs := make(map[string]bool)
+	known := make(map[string]bool)
+	for _, m := range monitors {
+		slugs[m.Slug] = true
+		known[monitorKey(m.Slug, m.Name)] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, o := range slos {
+		if o.Name == "" {
+			return fmt.Errorf("SLO for slug '%s' has no name", o.Slug)
+		}
+		if seen[o.key()] {
+			return fmt.Errorf("duplicate SLO '%s'", o.key())
+		}
+		seen[o.key()] = true
+
+		if !slugs[o.Slug] {
+			return fmt.Errorf("SLO '%s' refers to unknown slug '%s'", o.Name, o.Slug)
+		}
+		if o.Monitor != "" && !known[monitorKey(o.Slug, o.Monitor)] {
+			return fmt.Errorf("SLO '%s' refers to unknown monitor '%s/%s'", o.Name, o.Slug, o.Monitor)
+		}
+		if o.Target <= 0 || o.Target >= 100 {
+			return fmt.Errorf("SLO '%s' must have a target between 0 and 100 (exclusive)", o.Name)
+		}
+		if o.Window <= 0 {
+			return fmt.Errorf("SLO '%s' must have a positive window", o.Name)
+		}
+		switch o.Type {
+		case SLOAvailability:
+		case SLOLatency:
+			if o.Threshold <= 0 {
+				return fmt.Errorf("latency SLO '%s' must have a positive threshold", o.Name)
+			}
+		default:
+			return fmt.Errorf("SLO '%s' has unknown type '%s'", o.Name, o.Type)
+		}
+		for _, a := range o.BurnRateAlerts {
+			if a.Long <= 0 || a.Short <= 0 || a.Short > a.Long || a.Threshold <= 0 {
+				return fmt.Errorf("SLO '%s' has an invalid burn-rate alert", o.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// configuredSLOs returns a copy of the loaded SLOs.
+func (s *Service) configuredSLOs() []SLO {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	slos := make([]SLO, len(s.slos))
+	copy(slos, s.slos)
+	return slos
+}
+
+// GetSLOs evaluates every configured SLO.
+func (s *Service) GetSLOs(ctx context.Context) ([]SLOStatus, error) {
+	slos := s.configuredSLOs()
+	statuses := make([]SLOStatus, 0, len(slos))
+	for _, o := range slos {
+		status, err := s.evaluateSLO(ctx, o, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses, nil
+}
+
+// evaluateSLO computes the SLI, remaining error budget and burn rates of an SLO at a point in time.
+func (s *Service) evaluateSLO(ctx context.Context, o SLO, now time.Time) (*SLOStatus, error) {
+	// The first window is the SLO window; each burn-rate alert adds a long and a short window.
+	windows := []time.Duration{time.Duration(o.Window)}
+	for _, a := range o.alerts() {
+		windows = append(windows, time.Duration(a.Long), time.Duration(a.Short))
+	}
+	total, good, err := s.countGoodChecks(ctx, o, now, windows)
+	if err != nil {
+		return nil, err
+	}
+
+	budget := 1 - o.Target/100
+	burnRate := func(i int) float64 {
+		if total[i] == 0 {
+			return 0
+		}
+		return (float64(total[i]-good[i]) / float64(total[i])) / budget
+	}
+
+	status := &SLOStatus{
+		SLO:                  o,
+		TotalChecks:          total[0],
+		GoodChecks:           good[0],
+		SLI:                  100,
+		ErrorBudgetRemaining: 100,
+		BurnRates:            []BurnRateStatus{},
+	}
+	if raw := time.Duration(s.retentionFor(o.Slug).Raw); o.Type == SLOLatency && raw > 0 {
+		for _, w := range windows {
+			status.Partial = status.Partial || w > raw
+		}
+	}
+	if total[0] > 0 {
+		status.SLI = float64(good[0]) / float64(total[0]) * 100
+		status.ErrorBudgetRemaining = (1 - burnRate(0)) * 100
+	}
+	for i, a := range o.alerts() {
+		br := BurnRateStatus{
+			BurnRateAlert: a,
+			LongBurnRate:  burnRate(1 + 2*i),
+			ShortBurnRate: burnRate(2 + 2*i),
+		}
+		br.Firing = br.LongBurnRate >= a.Threshold && br.ShortBurnRate >= a.Threshold
+		status.Alerting = status.Alerting || br.Firing
+		status.BurnRates = append(status.BurnRates, br)
+	}
+	return status, nil
+}
+
+// countGoodChecks returns the number of counted and good checks for an SLO in each of the windows
+// ending at now. Raw checks are only kept for the raw retention of the slug, so the part of a window
+// older than that is counted from the rollups instead. Rollups don't keep the latency of each
+// check, so latency SLOs are counted from the raw checks that are left.
+func (s *Service) countGoodChecks(ctx context.Context, o SLO, now time.Time, windows []time.Duration) ([]int, []int, error) {
+	raw := time.Duration(s.retentionFor(o.Slug).Raw)
+	if raw <= 0 || o.Type != SLOAvailability {
+		return s.store.CountGoodChecks(ctx, o, now, windows)
+	}
+
+	// The rollups take over at the first hour boundary within the raw retention.
+	split := ResolutionHour.bucketStart(now.Add(-raw).Unix() + 3599)
+	rawWindows := make([]time.Duration, len(windows))
+	for i, w := range windows {
+		rawWindows[i] = w
+		if now.Add(-w).Unix() < split {
+			rawWindows[i] = now.Sub(time.Unix(split, 0))
+		}
+	}
+	total, good, err := s.store.CountGoodChecks(ctx, o, now, rawWindows)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, w := range windows {
+		start := now.Add(-w).Unix()
+		if start >= split {
+			continue
+		}
+		r, err := s.sloRollup(ctx, o, now, ResolutionHour.bucketStart(start), split)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count rolled up checks for SLO '%s': %w", o.Name, err)
+		}
+		total[i] += r.Up + r.Degraded + r.Down
+		good[i] += r.Up + r.Degraded
+	}
+	return total, good, nil
+}
+
+// sloRollup merges the rollups of the monitors an SLO covers within [start, end): the hourly
+// rollups while they are kept, and the daily rollups of the days before that.
+func (s *Service) sloRollup(ctx context.Context, o SLO, now time.Time, start, end int64) (Rollup, error) {
+	names := []string{o.Monitor}
+	if o.Monitor == "" {
+		names = nil
+		for _, m := range s.configuredMonitors() {
+			if m.Slug == o.Slug {
+				names = append(names, m.Name)
+			}
+		}
+	}
+
+	hourly := start
+	if keep := time.Duration(s.retentionFor(o.Slug).Hourly); keep > 0 {
+		if cutoff := now.Add(-keep).Unix(); cutoff > start {
+			hourly = min(ResolutionDay.nextBucket(ResolutionDay.bucketStart(cutoff)), end)
+		}
+	}
+
+	total := newRollup(start)
+	for _, name := range names {
+		if hourly > start {
+			r, err := s.store.AggregateRollups(ctx, ResolutionDay, o.Slug, name, ResolutionDay.bucketStart(start), hourly)
+			if err != nil {
+				return total, err
+			}
+			total.merge(r)
+		}
+		r, err := s.store.AggregateRollups(ctx, ResolutionHour, o.Slug, name, hourly, end)
+		if err != nil {
+			return total, err
+		}
+		total.merge(r)
+	}
+	return total, nil
+}
+
+// CountGoodChecks returns the number of counted and good checks for an SLO in each of the
+// windows ending at now, using a single query over the longest window.
+func (s *sqlStore) CountGoodChecks(ctx context.Context, o SLO, now time.Time, windows []time.Duration) ([]int, []int, error) {
+	good := `state IN ('up', 'degraded')`
+	var goodArgs []interface{}
+	if o.Type == SLOLatency {
+		good += ` AND time <= ?`
+		goodArgs = append(goodArgs, float64(time.Duration(o.Threshold).Microseconds())/1000.0)
+	}
+
+	var columns []string
+	var args []interface{}
+	earliest := now.Unix()
+	for _, w := range windows {
+		start := now.Add(-w).Unix()
+		if start < earliest {
+			earliest = start
+		}
+		columns = append(columns,
+			`COALESCE(SUM(CASE WHEN timestamp >= ? THEN 1 ELSE 0 END), 0)`,
+			`COALESCE(SUM(CASE WHEN timestamp >= ? AND `+good+` THEN 1 ELSE 0 END), 0)`)
+		args = append(args, start, start)
+		args = append(args, goodArgs...)
+	}
+
+	filter := `monitor_slug = ?`
+	args = append(args, o.Slug)
+	if o.Monitor != "" {
+		filter += ` AND monitor_name = ?`
+		args = append(args, o.Monitor)
+	}
+	// Latency objectives only look at successful checks; availability counts failures too.
+	counted := `state IN ('up', 'degraded', 'down')`
+	if o.Type == SLOLatency {
+		counted = `state IN ('up', 'degraded')`
+	}
+	args = append(args, earliest, now.Unix())
+
+	query := `SELECT ` + strings.Join(columns, ", ") + ` FROM log_entries
+		WHERE ` + filter + ` AND ` + counted + ` AND timestamp >= ? AND timestamp <= ?`
+
+	values := make([]int, 2*len(windows))
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := s.db.QueryRowContext(ctx, s.q(query), args...).Scan(dest...); err != nil {
+		return nil, nil, fmt.Errorf("failed to count checks for SLO '%s': %w", o.Name, err)
+	}
+
+	total := make([]int, len(windows))
+	goodCounts := make([]int, len(windows))
+	for i := range windows {
+		total[i] = values[2*i]
+		goodCounts[i] = values[2*i+1]
+	}
+	return total, goodCounts, nil
+}
+
+// runSLOEvaluator periodically evaluates SLO burn rates and sends a notification whenever an
+// SLO starts or stops alerting, until ctx is cancelled.
+func (s *Service) runSLOEvaluator(ctx context.Context) {
+	log.Printf("Starting SLO evaluator for %d objectives...", len(s.configuredSLOs()))
+	ticker := time.NewTicker(sloEvaluationInterval)
+	defer ticker.Stop()
+
+	alerting := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping SLO evaluator.")
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		for _, o := range s.configuredSLOs() {
+			status, err := s.evaluateSLO(ctx, o, now)
+			if err != nil {
+				log.Printf("Error evaluating SLO '%s': %v", o.Name, err)
+				continue
+			}
+			if status.Alerting == alerting[o.key()] {
+				continue
+			}
+			alerting[o.key()] = status.Alerting
+
+			n := Notification{
+				Kind:      NotifySLOBurnRate,
+				Slug:      o.Slug,
+				Name:      o.Monitor,
+				SLO:       o.Name,
+				Timestamp: now.Unix(),
+				Message: fmt.Sprintf("SLO '%s' on '%s' is burning its error budget too fast (%.1f%% remaining)",
+					o.Name, o.scope(), status.ErrorBudgetRemaining),
+			}
+			if !status.Alerting {
+				n.Kind = NotifySLOBurnRateResolved
+				n.Message = fmt.Sprintf("SLO '%s' on '%s' is no longer burning its error budget too fast (%.1f%% remaining)",
+					o.Name, o.scope(), status.ErrorBudgetRemaining)
+			}
+			s.notify(ctx, n)
+		}
+	}
+}
+
+// scope returns the slug or monitor the SLO applies to, for messages.
+func (o SLO) scope() string {
+	if o.Monitor == "" {
+		return o.Slug
+	}
+	return monitorKey(o.Slug, o.Monitor)
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEvaluateSLOBeyondRawRetention(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	monitors := []Monitor{
+		{Slug: "prod", Name: "api", URL: "http://example.com/"},
+		{Slug: "prod", Name: "web", URL: "http://example.com/"},
+	}
+	if err := store.SyncMonitors(ctx, monitors); err != nil {
+		t.Fatalf("SyncMonitors: %v", err)
+	}
+
+	// An hourly check of each monitor for five days, failing for ten hours four days ago and
+	// for two hours within the last day. Raw checks are kept for two days.
+	now := time.Now()
+	checks, failed := 0, 0
+	for hour := 0; hour < 5*24; hour++ {
+		state := StateUp
+		if (hour >= 4*24 && hour < 4*24+10) || hour == 3 || hour == 7 {
+			state = StateDown
+		}
+		for _, m := range monitors {
+			entry := MonitorLogEntry{Timestamp: now.Unix() - int64(hour)*3600, Time: 100, Response: "200", State: state}
+			if err := store.SaveChecks(ctx, []CheckRecord{{Slug: m.Slug, Name: m.Name, Entry: entry}}); err != nil {
+				t.Fatalf("SaveChecks: %v", err)
+			}
+			checks++
+			if state == StateDown {
+				failed++
+			}
+		}
+	}
+	retention := RetentionPolicy{Raw: Duration(2 * 24 * time.Hour), Hourly: Duration(3 * 24 * time.Hour)}
+	if _, err := store.PurgeSlug(ctx, "prod", retention, now); err != nil {
+		t.Fatalf("PurgeSlug: %v", err)
+	}
+	s := &Service{store: store, retention: retention, monitorsConfig: monitors}
+
+	tests := []struct {
+		name        string
+		slo         SLO
+		total, good int
+		partial     bool
+	}{
+		{"slug", SLO{Name: "slug", Slug: "prod", Type: SLOAvailability, Target: 99, Window: Duration(30 * 24 * time.Hour)},
+			checks, checks - failed, false},
+		{"monitor", SLO{Name: "monitor", Slug: "prod", Monitor: "api", Type: SLOAvailability, Target: 99, Window: Duration(30 * 24 * time.Hour)},
+			checks / 2, (checks - failed) / 2, false},
+		{"within raw retention", SLO{Name: "day", Slug: "prod", Monitor: "api", Type: SLOAvailability, Target: 99, Window: Duration(24 * time.Hour)},
+			25, 23, false},
+		// Latency SLOs only count the successful checks that are still kept.
+		{"latency", SLO{Name: "latency", Slug: "prod", Monitor: "api", Type: SLOLatency, Target: 99, Window: Duration(30 * 24 * time.Hour), Threshold: Duration(time.Second)},
+			2*24 + 1 - 2, 2*24 + 1 - 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := s.evaluateSLO(ctx, tt.slo, now)
+			if err != nil {
+				t.Fatalf("evaluateSLO: %v", err)
+			}
+			if status.TotalChecks != tt.total || status.GoodChecks != tt.good || status.Partial != tt.partial {
+				t.Errorf("evaluateSLO = %d good of %d (partial %t), want %d of %d (partial %t)",
+					status.GoodChecks, status.TotalChecks, status.Partial, tt.good, tt.total, tt.partial)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// State is the health of a monitor, computed once per check and stored with each log entry.
+type State string
+
+const (
+	// StateUp means the last check succeeded within the latency threshold.
+	StateUp State = "up"
+	// StateDegraded means the last check succeeded but was slower than the latency threshold.
+	StateDegraded State = "degraded"
+	// StateDown means the last check failed or returned a non-2xx status.
+	StateDown State = "down"
+	// StatePaused means the monitor is configured not to run checks.
+	StatePaused State = "paused"
+	// StateMaintenance means the last check ran during a scheduled maintenance window.
+	StateMaintenance State = "maintenance"
+	// StatePending means the monitor has not been checked yet.
+	StatePending State = "pending"
+	// StateUnreachable means the last check failed while a monitor it depends on was down.
+	StateUnreachable State = "unreachable"
+)
+
+// IsAvailable reports whether the state counts as available for uptime purposes.
+func (st State) IsAvailable() bool {
+	return st == StateUp || st == StateDegraded
+}
+
+// CountsTowardsUptime reports whether checks in this state are included in uptime calculations.
+// Checks taken while paused, during maintenance or while a dependency was down are excluded.
+func (st State) CountsTowardsUptime() bool {
+	return st == StateUp || st == StateDegraded || st == StateDown
+}
+
+// MaintenanceWindow is a period during which a monitor's failures are not counted as downtime.
+type MaintenanceWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// StateTransition records a change in a monitor's state.
+type StateTransition struct {
+	Timestamp int64 `json:"timestamp"`
+	From      State `json:"from"`
+	To        State `json:"to"`
+}
+
+// monitorStatus is the in-memory state of a running monitor.
+type monitorStatus struct {
+	State State
+	Since int64
+	flaps *flapDetector
+	// reported is the state last notified, or the first state known, which notifications of
+	// monitors leaving the unreachable state are compared with. Never unreachable.
+	reported State
+}
+
+// stateChange describes the effect of recording a check's state.
+type stateChange struct {
+	Previous        State
+	Current         State
+	Flapping        bool
+	FlappingStarted bool
+	FlappingStopped bool
+	FlapPercent     float64
+	// Reported is the state last notified before this change.
+	Reported State
+}
+
+// newStatus creates the in-memory state of a monitor with an empty flap history.
+func (s *Service) newStatus(state State, since int64) *monitorStatus {
+	return &monitorStatus{
+		State:    state,
+		Since:    since,
+		flaps:    &flapDetector{window: s.flapWindow, low: s.flapLow, high: s.flapHigh},
+		reported: state,
+	}
+}
+
+// inMaintenance reports whether t falls inside one of the monitor's maintenance windows.
+func (m Monitor) inMaintenance(t time.Time) bool {
+	for _, w := range m.Maintenance {
+		if !t.Before(w.Start) && t.Before(w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateState derives a monitor's state from the outcome of a single check.
+func evaluateState(m Monitor, statusCode int, checkErr error, elapsed time.Duration, at time.Time) State {
+	if m.inMaintenance(at) {
+		return StateMaintenance
+	}
+	if checkErr != nil || statusCode < 200 || statusCode >= 300 {
+		return StateDown
+	}
+	if m.LatencyThreshold > 0 && elapsed > time.Duration(m.LatencyThreshold) {
+		return StateDegraded
+	}
+	return StateUp
+}
+
+// monitorKey returns the key used to index per-monitor runtime data.
+func monitorKey(slug, name string) string {
+	return slug + "/" + name
+}
+
+// loadInitialStates seeds the in-memory state of every configured monitor, using the
+// most recent stored state so that transitions are detected correctly across restarts.
+func (s *Service) loadInitialStates(ctx context.Context) error {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	s.statuses = make(map[string]*monitorStatus, len(s.monitorsConfig))
+	for _, m := range s.monitorsConfig {
+		status, err := s.initialStatus(ctx, m)
+		if err != nil {
+			return err
+		}
+		s.statuses[monitorKey(m.Slug, m.Name)] = status
+	}
+	return nil
+}
+
+// initialStatus returns the in-memory state a monitor starts with: paused, the state of its last
+// stored check, or pending if it has none.
+func (s *Service) initialStatus(ctx context.Context, m Monitor) (*monitorStatus, error) {
+	status := s.newStatus(StatePending, time.Now().Unix())
+	if m.Paused {
+		status.State = StatePaused
+		status.reported = StatePaused
+		return status, nil
+	}
+	last, err := s.store.LastCheck(ctx, m.Slug, m.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load last state for %s/%s: %w", m.Slug, m.Name, err)
+	}
+	if last != nil && last.State != "" {
+		status.State = last.State
+		status.Since = last.Timestamp
+		if last.State != StateUnreachable {
+			status.reported = last.State
+		}
+	}
+	return status, nil
+}
+
+// recordState updates the in-memory state and flap history of a monitor and describes the change.
+func (s *Service) recordState(slug, name string, state State, at int64) stateChange {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	key := monitorKey(slug, name)
+	status, ok := s.statuses[key]
+	if !ok {
+		status = s.newStatus(StatePending, at)
+		s.statuses[key] = status
+	}
+	change := stateChange{Previous: status.State, Current: state}
+	if change.Previous != state {
+		log.Printf("Monitor '%s/%s' changed state: %s -> %s", slug, name, change.Previous, state)
+		status.State = state
+		status.Since = at
+	}
+
+	if status.flaps.observe(state) {
+		change.FlappingStarted = status.flaps.flapping
+		change.FlappingStopped = !status.flaps.flapping
+		log.Printf("Monitor '%s/%s' flapping=%t (%.1f%% state change)", slug, name, status.flaps.flapping, status.flaps.percent)
+	}
+	change.Flapping = status.flaps.flapping
+	change.FlapPercent = status.flaps.percent
+
+	change.Reported = status.reported
+	if state != StateUnreachable && (change.Previous == StatePending || change.FlappingStopped || change.alerts()) {
+		status.reported = state
+	}
+	return change
+}
+
+// statusSnapshot is a copy of a monitor's in-memory state that is safe to use without locking.
+type statusSnapshot struct {
+	State       State
+	Since       int64
+	Flapping    bool
+	FlapPercent float64
+}
+
+// currentStatus returns the in-memory state of a monitor, if it is known.
+func (s *Service) currentStatus(slug, name string) (statusSnapshot, bool) {
+	s.statusMu.RLock()
+	defer s.statusMu.RUnlock()
+
+	status, ok := s.statuses[monitorKey(slug, name)]
+	if !ok {
+		return statusSnapshot{}, false
+	}
+	return statusSnapshot{
+		State:       status.State,
+		Since:       status.Since,
+		Flapping:    status.flaps.flapping,
+		FlapPercent: status.flaps.percent,
+	}, true
+}
+
+// GetStateTransitions returns the state changes of a monitor within a given time range.
+// The first entry in the range is reported as a transition only if it differs from the
+// state recorded before the range began.
+func (s *Service) GetStateTransitions(monitorSlug, monitorName string, start, end int64) ([]StateTransition, error) {
+	if !s.isConfigured(monitorSlug, monitorName) {
+		return nil, fmt.Errorf("monitor '%s/%s' not found in configuration", monitorSlug, monitorName)
+	}
+
+	return s.store.StateTransitions(context.Background(), monitorSlug, monitorName, start, end)
+}
+
+// StateTransitions finds state changes by comparing every check in the range with the one before
+// it. The state before the range is looked up separately, so only the range itself is scanned.
+func (s *sqlStore) StateTransitions(ctx context.Context, monitorSlug, monitorName string, start, end int64) ([]StateTransition, error) {
+	var before string
+	err := s.db.QueryRowContext(ctx, s.q(`
+		SELECT state FROM log_entries
+		WHERE monitor_slug = ? AND monitor_name = ? AND timestamp < ?
+		ORDER BY timestamp DESC, id DESC
+		LIMIT 1
+	`), monitorSlug, monitorName, start).Scan(&before)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get state before transitions for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.q(`
+		SELECT timestamp, COALESCE(prev_state, ''), state FROM (
+			SELECT timestamp, state, LAG(state) OVER (ORDER BY timestamp, id) AS prev_state
+			FROM log_entries
+			WHERE monitor_slug = ? AND monitor_name = ? AND timestamp >= ? AND timestamp <= ?
+		) AS checks
+		WHERE prev_state IS NULL OR prev_state != state
+		ORDER BY timestamp ASC
+	`), monitorSlug, monitorName, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query state transitions for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+	defer rows.Close()
+
+	var transitions []StateTransition
+	for rows.Next() {
+		var t StateTransition
+		var from, to string
+		if err := rows.Scan(&t.Timestamp, &from, &to); err != nil {
+			return nil, fmt.Errorf("failed to scan state transition for %s/%s: %w", monitorSlug, monitorName, err)
+		}
+		if from == "" {
+			// The first check in the range follows the one before it, if any.
+			if before == to {
+				continue
+			}
+			from = before
+		}
+		t.From = State(from)
+		if from == "" {
+			t.From = StatePending
+		}
+		t.To = State(to)
+		transitions = append(transitions, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration for %s/%s: %w", monitorSlug, monitorName, err)
+	}
+
+	return transitions, nil
+}
@@ -0,0 +1,191 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // PostgreSQL driver
+	_ "github.com/mattn/go-sqlite3"    // SQLite driver
+)
+
+// Store persists monitors, checks and everything derived from them. The service holds no
+// SQL of its own; every query goes through a Store.
+type Store interface {
+	// Migrate applies all pending schema migrations and returns the ones that were applied.
+	Migrate(ctx context.Context) ([]Migration, error)
+	// MigrateDownTo reverts the migrations newer than version and returns the ones that were reverted.
+	MigrateDownTo(ctx context.Context, version int) ([]Migration, error)
+	// MigrationStatus lists every known migration and whether it has been applied.
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+
+	// SyncMonitors brings the stored monitors in line with the configuration without losing
+	// history, and fills in the stable id of every monitor.
+	SyncMonitors(ctx context.Context, monitors []Monitor) error
+	// ListMonitorsBySlug returns the active monitors stored under a slug.
+	ListMonitorsBySlug(ctx context.Context, slug string) ([]Monitor, error)
+	// ListSlugs returns every slug with stored monitors, including archived ones.
+	ListSlugs(ctx context.Context) ([]string, error)
+	// ManagedMonitors returns the definitions of the monitors managed through the API, oldest first.
+	ManagedMonitors(ctx context.Context) ([]Monitor, error)
+	// ReplaceManagedMonitors replaces the definitions of the monitors managed through the API in
+	// one transaction. Every monitor must have an id.
+	ReplaceManagedMonitors(ctx context.Context, monitors []Monitor) error
+
+	// SaveChecks stores a batch of checks in one transaction, counting each into the rollups
+	// and the incidents of its monitor in order.
+	SaveChecks(ctx context.Context, checks []CheckRecord) error
+	// LastCheck returns the most recent check of a monitor, or nil if it has none.
+	LastCheck(ctx context.Context, slug, name string) (*MonitorLogEntry, error)
+	// ListChecks returns the checks of a monitor within [start, end], oldest first.
+	ListChecks(ctx context.Context, slug, name string, start, end int64) ([]MonitorLogEntry, error)
+	// StateTransitions returns the state changes of a monitor within [start, end], oldest first.
+	StateTransitions(ctx context.Context, slug, name string, start, end int64) ([]StateTransition, error)
+	// LatencyStats returns exact latency percentiles of a monitor within [start, end].
+	LatencyStats(ctx context.Context, slug, name string, start, end int64) (*LatencyStats, error)
+	// LatencyHistogram counts the checks of a monitor within [start, end] into buckets with the given sorted bounds.
+	LatencyHistogram(ctx context.Context, slug, name string, start, end int64, bounds []float64) ([]int, error)
+	// CountGoodChecks returns the counted and good checks of an SLO in each window ending at now.
+	CountGoodChecks(ctx context.Context, o SLO, now time.Time, windows []time.Duration) (total, good []int, err error)
+
+	// Rollups returns the rollups of a monitor whose buckets start within [start, end), oldest first.
+	Rollups(ctx context.Context, res Resolution, slug, name string, start, end int64) ([]Rollup, error)
+	// AggregateRollups merges the rollups of a monitor whose buckets start within [start, end).
+	AggregateRollups(ctx context.Context, res Resolution, slug, name string, start, end int64) (Rollup, error)
+	// AggregateChecks summarises the raw checks of a monitor within [start, end).
+	AggregateChecks(ctx context.Context, slug, name string, start, end int64) (Rollup, error)
+	// PurgeSlug applies a retention policy to the data of one slug and describes what was deleted.
+	PurgeSlug(ctx context.Context, slug string, policy RetentionPolicy, now time.Time) ([]string, error)
+
+	// Incidents returns the incidents overlapping [start, end], newest first. An empty name
+	// returns the incidents of every monitor under the slug.
+	Incidents(ctx context.Context, slug, name string, start, end int64) ([]Incident, error)
+
+	// ListAllMonitors returns every stored monitor, including archived ones.
+	ListAllMonitors(ctx context.Context) ([]ExportedMonitor, error)
+	// Import writes exported records in one transaction. Importing the same records again
+	// changes nothing.
+	Import(ctx context.Context, records []ExportRecord) error
+	// Backup writes a consistent copy of the database to path without stopping writers.
+	Backup(ctx context.Context, path string) error
+
+	// Close releases the underlying database.
+	Close() error
+}
+
+// OpenStore opens a store for the given driver: "sqlite" (the default) with a file path, or
+// "postgres" with a connection URL. The schema is not migrated.
+func OpenStore(driver, source string) (Store, error) {
+	switch driver {
+	case "", "sqlite", "sqlite3":
+		return NewSQLiteStore(source)
+	case "postgres", "postgresql":
+		return NewPostgresStore(source)
+	default:
+		return nil, fmt.Errorf("unknown database driver '%s'", driver)
+	}
+}
+
+// NewSQLiteStore opens the SQLite database at path with foreign keys enforced, in WAL mode.
+func NewSQLiteStore(path string) (Store, error) {
+	// WAL lets the API read while checks are written, and the busy timeout makes a writer
+	// wait for a lock instead of failing with "database is locked".
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=true&_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	return &sqlStore{db: db, dialect: sqliteDialect}, nil
+}
+
+// NewPostgresStore connects to the PostgreSQL database at url.
+func NewPostgresStore(url string) (Store, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+	return &sqlStore{db: db, dialect: postgresDialect}, nil
+}
+
+// dialect holds what differs between the SQL databases a sqlStore can talk to.
+type dialect struct {
+	name string
+	// migrations is the directory of the embedded migrations for this database.
+	migrations string
+	// numbered placeholders ($1, $2, ...) are used instead of '?'.
+	numbered bool
+	// deferForeignKeys postpones foreign key checks to the end of the transaction, so a
+	// monitor can be renamed together with its history. Empty when not needed.
+	deferForeignKeys string
+	// tableExists is a query counting the tables with the name given as its only argument.
+	tableExists string
+	// lockMigrations and unlockMigrations keep concurrent instances from migrating at once.
+	lockMigrations   string
+	unlockMigrations string
+	// upgradeLegacy upgrades a database created before migrations were versioned within a
+	// transaction, if the database ever had such databases.
+	upgradeLegacy func(ctx context.Context, s *sqlStore, tx *sql.Tx) error
+}
+
+var sqliteDialect = dialect{
+	name:             "sqlite",
+	migrations:       "migrations/sqlite",
+	deferForeignKeys: `PRAGMA defer_foreign_keys = ON`,
+	tableExists:      `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+	upgradeLegacy:    upgradeLegacySchema,
+}
+
+// The PostgreSQL schema cascades key updates to history tables, so renames need no deferral.
+var postgresDialect = dialect{
+	name:             "postgres",
+	migrations:       "migrations/postgres",
+	numbered:         true,
+	tableExists:      `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`,
+	lockMigrations:   `SELECT pg_advisory_lock(4871637)`,
+	unlockMigrations: `SELECT pg_advisory_unlock(4871637)`,
+}
+
+// rebind rewrites the '?' placeholders of a query for the dialect.
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlStore is a Store on top of database/sql. The SQL is shared between databases and
+// rewritten for the dialect where needed.
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// q rewrites a query for the store's dialect.
+func (s *sqlStore) q(query string) string {
+	return s.dialect.rebind(query)
+}
+
+// Close closes the database.
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
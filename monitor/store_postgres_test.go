@@ -0,0 +1,58 @@
+package monitor_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"guptime/monitor"
+	"guptime/monitor/storetest"
+)
+
+// TestPostgresStore runs the conformance suite against the PostgreSQL database at
+// GUPTIME_TEST_POSTGRES_DSN, giving each subtest a schema of its own.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("GUPTIME_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("GUPTIME_TEST_POSTGRES_DSN is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	n := 0
+	storetest.Run(t, func(t *testing.T) monitor.Store {
+		n++
+		schema := fmt.Sprintf("guptime_test_%d_%d", time.Now().UnixNano(), n)
+		if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatalf("failed to create schema: %v", err)
+		}
+		t.Cleanup(func() {
+			if _, err := db.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+				t.Errorf("failed to drop schema: %v", err)
+			}
+		})
+		store, err := monitor.NewPostgresStore(withSearchPath(dsn, schema))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+// withSearchPath adds a search_path to a connection string in either the URL or the key=value form.
+func withSearchPath(dsn, schema string) string {
+	switch {
+	case !strings.Contains(dsn, "://"):
+		return dsn + " search_path=" + schema
+	case strings.Contains(dsn, "?"):
+		return dsn + "&search_path=" + schema
+	default:
+		return dsn + "?search_path=" + schema
+	}
+}
@@ -0,0 +1,19 @@
+package monitor_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"guptime/monitor"
+	"guptime/monitor/storetest"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) monitor.Store {
+		store, err := monitor.NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
@@ -0,0 +1,604 @@
+// Package storetest is a conformance suite for monitor.Store implementations. Every backend
+// must pass it against an empty database:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) monitor.Store {
+//			store, err := monitor.NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return store
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"guptime/monitor"
+)
+
+// Run runs the conformance suite. open must return a store on a fresh, empty database for
+// each subtest; Run migrates and closes it.
+func Run(t *testing.T, open func(t *testing.T) monitor.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, ctx context.Context, store monitor.Store)
+	}{
+		{"Migrate", testMigrate},
+		{"SyncMonitors", testSyncMonitors},
+		{"ManagedMonitors", testManagedMonitors},
+		{"Checks", testChecks},
+		{"SaveChecks", testSaveChecks},
+		{"Rollups", testRollups},
+		{"StateTransitions", testStateTransitions},
+		{"Latency", testLatency},
+		{"Incidents", testIncidents},
+		{"CountGoodChecks", testCountGoodChecks},
+		{"PurgeSlug", testPurgeSlug},
+		{"ImportIDCollision", testImportIDCollision},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := open(t)
+			t.Cleanup(func() { store.Close() })
+			if _, err := store.Migrate(ctx); err != nil {
+				t.Fatalf("Migrate: %v", err)
+			}
+			tt.fn(t, ctx, store)
+		})
+	}
+	t.Run("ExportImport", func(t *testing.T) { testExportImport(t, open) })
+	t.Run("ImportOverlapping", func(t *testing.T) { testImportOverlapping(t, open) })
+}
+
+// base is an hour boundary two days ago, far enough back that every check falls into
+// complete rollup buckets and recent enough to survive the default retention.
+var base = time.Now().Add(-48 * time.Hour).Truncate(time.Hour).Unix()
+
+func sync(t *testing.T, ctx context.Context, store monitor.Store, monitors ...monitor.Monitor) []monitor.Monitor {
+	t.Helper()
+	if err := store.SyncMonitors(ctx, monitors); err != nil {
+		t.Fatalf("SyncMonitors: %v", err)
+	}
+	return monitors
+}
+
+func save(t *testing.T, ctx context.Context, store monitor.Store, slug, name string, entries ...monitor.MonitorLogEntry) {
+	t.Helper()
+	checks := make([]monitor.CheckRecord, len(entries))
+	for i, e := range entries {
+		checks[i] = monitor.CheckRecord{Slug: slug, Name: name, Entry: e}
+	}
+	if err := store.SaveChecks(ctx, checks); err != nil {
+		t.Fatalf("SaveChecks: %v", err)
+	}
+}
+
+func check(offset int64, state monitor.State, ms float64) monitor.MonitorLogEntry {
+	return monitor.MonitorLogEntry{Timestamp: base + offset, Time: ms, Response: "200", State: state, IntervalSeconds: 60,
+		StatusCode: 200, ResponseSize: 512, ResolvedIP: "192.0.2.1"}
+}
+
+var api = monitor.Monitor{Slug: "prod", Name: "api", URL: "https://api.example.com"}
+
+func testMigrate(t *testing.T, ctx context.Context, store monitor.Store) {
+	applied, err := store.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second Migrate applied %d migrations, want none", len(applied))
+	}
+	statuses, err := store.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if len(statuses) == 0 {
+		t.Fatal("MigrationStatus returned no migrations")
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("migration %d is not applied", s.Version)
+		}
+	}
+}
+
+func testSyncMonitors(t *testing.T, ctx context.Context, store monitor.Store) {
+	synced := sync(t, ctx, store, api, monitor.Monitor{Slug: "prod", Name: "web", URL: "https://example.com"})
+	if synced[0].ID == "" || synced[1].ID == "" || synced[0].ID == synced[1].ID {
+		t.Fatalf("SyncMonitors assigned ids %q and %q, want two distinct ids", synced[0].ID, synced[1].ID)
+	}
+	save(t, ctx, store, "prod", "api", check(0, monitor.StateUp, 100))
+
+	// Rename api with its history and drop web.
+	renamed := monitor.Monitor{Slug: "prod", Name: "api-v2", URL: api.URL, PreviousNames: []monitor.MonitorRef{{Slug: "prod", Name: "api"}}}
+	synced = sync(t, ctx, store, renamed)
+	if synced[0].ID != sync(t, ctx, store, renamed)[0].ID {
+		t.Error("SyncMonitors changed the id of a renamed monitor")
+	}
+	checks, err := store.ListChecks(ctx, "prod", "api-v2", base, base+3600)
+	if err != nil {
+		t.Fatalf("ListChecks: %v", err)
+	}
+	if len(checks) != 1 {
+		t.Errorf("renamed monitor has %d checks, want 1", len(checks))
+	}
+
+	active, err := store.ListMonitorsBySlug(ctx, "prod")
+	if err != nil {
+		t.Fatalf("ListMonitorsBySlug: %v", err)
+	}
+	if len(active) != 1 || active[0].Name != "api-v2" {
+		t.Errorf("ListMonitorsBySlug = %+v, want only api-v2", active)
+	}
+	slugs, err := store.ListSlugs(ctx)
+	if err != nil {
+		t.Fatalf("ListSlugs: %v", err)
+	}
+	if len(slugs) != 1 || slugs[0] != "prod" {
+		t.Errorf("ListSlugs = %v, want [prod]", slugs)
+	}
+}
+
+func testManagedMonitors(t *testing.T, ctx context.Context, store monitor.Store) {
+	first := monitor.Monitor{ID: "first", Slug: "prod", Name: "api", URL: "https://api.example.com",
+		Headers: map[string]string{"Authorization": "Bearer token"}, Interval: monitor.Duration(time.Minute)}
+	second := monitor.Monitor{ID: "second", Slug: "prod", Name: "web", URL: "https://example.com", Paused: true}
+	if err := store.ReplaceManagedMonitors(ctx, []monitor.Monitor{first, second}); err != nil {
+		t.Fatalf("ReplaceManagedMonitors: %v", err)
+	}
+	managed, err := store.ManagedMonitors(ctx)
+	if err != nil {
+		t.Fatalf("ManagedMonitors: %v", err)
+	}
+	if len(managed) != 2 || managed[0].ID != "first" || managed[1].ID != "second" {
+		t.Fatalf("ManagedMonitors = %+v, want first and second", managed)
+	}
+	if managed[0].Headers["Authorization"] != "Bearer token" || managed[0].Interval != first.Interval || !managed[1].Paused {
+		t.Errorf("ManagedMonitors did not keep the definitions: %+v", managed)
+	}
+
+	second.URL = "https://www.example.com"
+	if err := store.ReplaceManagedMonitors(ctx, []monitor.Monitor{second}); err != nil {
+		t.Fatalf("ReplaceManagedMonitors: %v", err)
+	}
+	managed, err = store.ManagedMonitors(ctx)
+	if err != nil {
+		t.Fatalf("ManagedMonitors: %v", err)
+	}
+	if len(managed) != 1 || managed[0].URL != second.URL {
+		t.Errorf("ManagedMonitors = %+v, want only the updated second", managed)
+	}
+}
+
+func testChecks(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api)
+	last, err := store.LastCheck(ctx, "prod", "api")
+	if err != nil || last != nil {
+		t.Fatalf("LastCheck on empty monitor = %+v, %v; want nil, nil", last, err)
+	}
+
+	failed := check(60, monitor.StateDown, 0)
+	failed.Response = "Error: connection refused"
+	failed.StatusCode = 0
+	failed.ErrorClass = monitor.ErrorRefused
+	failed.ErrorMessage = "connection refused"
+	failed.ResponseSize = 0
+	save(t, ctx, store, "prod", "api", check(0, monitor.StateUp, 100), failed, check(120, monitor.StateUp, 300))
+	last, err = store.LastCheck(ctx, "prod", "api")
+	if err != nil {
+		t.Fatalf("LastCheck: %v", err)
+	}
+	if last == nil || last.Timestamp != base+120 || last.State != monitor.StateUp || last.Time != 300 {
+		t.Errorf("LastCheck = %+v, want the check at +120s", last)
+	}
+
+	checks, err := store.ListChecks(ctx, "prod", "api", base, base+60)
+	if err != nil {
+		t.Fatalf("ListChecks: %v", err)
+	}
+	if len(checks) != 2 || checks[0].Timestamp != base || checks[1].State != monitor.StateDown {
+		t.Errorf("ListChecks = %+v, want the first two checks oldest first", checks)
+	}
+	if checks[0] != check(0, monitor.StateUp, 100) {
+		t.Errorf("ListChecks lost fields: %+v", checks[0])
+	}
+	if checks[1] != failed {
+		t.Errorf("ListChecks lost fields of a failed check: %+v", checks[1])
+	}
+}
+
+func testSaveChecks(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api, monitor.Monitor{Slug: "prod", Name: "web", URL: "https://example.com"})
+	batch := []monitor.CheckRecord{
+		{Slug: "prod", Name: "api", Entry: check(0, monitor.StateDown, 0)},
+		{Slug: "prod", Name: "web", Entry: check(0, monitor.StateUp, 100)},
+		{Slug: "prod", Name: "api", Entry: check(60, monitor.StateDown, 0)},
+		{Slug: "prod", Name: "api", Entry: check(120, monitor.StateUp, 100)},
+	}
+	if err := store.SaveChecks(ctx, batch); err != nil {
+		t.Fatalf("SaveChecks: %v", err)
+	}
+
+	checks, err := store.ListChecks(ctx, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("ListChecks: %v", err)
+	}
+	if len(checks) != 3 {
+		t.Errorf("api has %d checks, want 3", len(checks))
+	}
+	minutes, err := store.Rollups(ctx, monitor.ResolutionMinute, "prod", "web", base, base+3600)
+	if err != nil {
+		t.Fatalf("Rollups: %v", err)
+	}
+	if len(minutes) != 1 || minutes[0].Up != 1 {
+		t.Errorf("web minute rollups = %+v, want one up check", minutes)
+	}
+	incidents, err := store.Incidents(ctx, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("Incidents: %v", err)
+	}
+	if len(incidents) != 1 || incidents[0].CheckCount != 2 || incidents[0].EndedAt == nil {
+		t.Errorf("incidents = %+v, want one closed incident of two checks", incidents)
+	}
+
+	// A batch that fails is not partially written.
+	bad := []monitor.CheckRecord{
+		{Slug: "prod", Name: "web", Entry: check(180, monitor.StateUp, 100)},
+		{Slug: "prod", Name: "missing", Entry: check(180, monitor.StateUp, 100)},
+	}
+	if err := store.SaveChecks(ctx, bad); err == nil {
+		t.Fatal("SaveChecks accepted a check for an unknown monitor")
+	}
+	last, err := store.LastCheck(ctx, "prod", "web")
+	if err != nil {
+		t.Fatalf("LastCheck: %v", err)
+	}
+	if last == nil || last.Timestamp != base {
+		t.Errorf("LastCheck = %+v after a failed batch, want the first web check", last)
+	}
+}
+
+func testRollups(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api)
+	save(t, ctx, store, "prod", "api", check(0, monitor.StateUp, 100), check(10, monitor.StateDegraded, 300), check(70, monitor.StateDown, 0))
+
+	minutes, err := store.Rollups(ctx, monitor.ResolutionMinute, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("Rollups: %v", err)
+	}
+	if len(minutes) != 2 {
+		t.Fatalf("Rollups returned %d minute buckets, want 2", len(minutes))
+	}
+	first := minutes[0]
+	if first.BucketStart != base || first.Up != 1 || first.Degraded != 1 || first.LatencyCount != 2 ||
+		first.LatencySum != 400 || first.LatencyMin != 100 || first.LatencyMax != 300 {
+		t.Errorf("first minute rollup = %+v", first)
+	}
+	if minutes[1].Down != 1 {
+		t.Errorf("second minute rollup = %+v, want one down check", minutes[1])
+	}
+
+	hour, err := store.AggregateRollups(ctx, monitor.ResolutionHour, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("AggregateRollups: %v", err)
+	}
+	raw, err := store.AggregateChecks(ctx, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("AggregateChecks: %v", err)
+	}
+	for _, r := range []monitor.Rollup{hour, raw} {
+		if r.Total() != 3 || r.Up != 1 || r.Degraded != 1 || r.Down != 1 || r.LatencySum != 400 || r.LatencyMax != 300 {
+			t.Errorf("aggregate = %+v, want the three checks", r)
+		}
+	}
+}
+
+func testStateTransitions(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api)
+	save(t, ctx, store, "prod", "api", check(0, monitor.StateUp, 100), check(60, monitor.StateUp, 100),
+		check(120, monitor.StateDown, 0), check(180, monitor.StateUp, 100))
+
+	transitions, err := store.StateTransitions(ctx, "prod", "api", base+60, base+3600)
+	if err != nil {
+		t.Fatalf("StateTransitions: %v", err)
+	}
+	want := []monitor.StateTransition{
+		{Timestamp: base + 120, From: monitor.StateUp, To: monitor.StateDown},
+		{Timestamp: base + 180, From: monitor.StateDown, To: monitor.StateUp},
+	}
+	if len(transitions) != len(want) {
+		t.Fatalf("StateTransitions = %+v, want %+v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("transition %d = %+v, want %+v", i, transitions[i], want[i])
+		}
+	}
+}
+
+func testLatency(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api)
+	for i := int64(1); i <= 100; i++ {
+		save(t, ctx, store, "prod", "api", check(i, monitor.StateUp, float64(i)))
+	}
+
+	stats, err := store.LatencyStats(ctx, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("LatencyStats: %v", err)
+	}
+	if stats.Count != 100 || stats.Min != 1 || stats.Max != 100 || stats.P50 != 50 || stats.P99 != 99 {
+		t.Errorf("LatencyStats = %+v", stats)
+	}
+
+	counts, err := store.LatencyHistogram(ctx, "prod", "api", base, base+3600, []float64{10, 50})
+	if err != nil {
+		t.Fatalf("LatencyHistogram: %v", err)
+	}
+	if len(counts) != 3 || counts[0] != 10 || counts[1] != 40 || counts[2] != 50 {
+		t.Errorf("LatencyHistogram = %v, want [10 40 50]", counts)
+	}
+}
+
+func testIncidents(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api, monitor.Monitor{Slug: "prod", Name: "web", URL: "https://example.com"})
+	down := check(60, monitor.StateDown, 0)
+	down.Response = "Error: dial tcp 192.0.2.1:443: connect: connection refused"
+	down.ErrorClass, down.ErrorMessage = monitor.ErrorRefused, "dial tcp 192.0.2.1:443: connect: connection refused"
+	timeout := check(120, monitor.StateDown, 0)
+	timeout.ErrorClass, timeout.ErrorMessage = monitor.ErrorTimeout, "context deadline exceeded"
+	save(t, ctx, store, "prod", "api", check(0, monitor.StateUp, 100), down, timeout, check(180, monitor.StateUp, 100))
+	save(t, ctx, store, "prod", "web", check(240, monitor.StateDown, 0))
+
+	incidents, err := store.Incidents(ctx, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("Incidents: %v", err)
+	}
+	if len(incidents) != 1 {
+		t.Fatalf("Incidents returned %d incidents, want 1", len(incidents))
+	}
+	got := incidents[0]
+	if got.StartedAt != base+60 || got.EndedAt == nil || *got.EndedAt != base+180 || got.CheckCount != 2 ||
+		got.FirstError != "refused: dial tcp 192.0.2.1:443: connect: connection refused" ||
+		got.LastError != "timeout: context deadline exceeded" || got.Ongoing {
+		t.Errorf("incident = %+v", got)
+	}
+
+	all, err := store.Incidents(ctx, "prod", "", base, base+3600)
+	if err != nil {
+		t.Fatalf("Incidents for slug: %v", err)
+	}
+	if len(all) != 2 || all[0].Name != "web" || !all[0].Ongoing {
+		t.Errorf("slug incidents = %+v, want the ongoing web incident first", all)
+	}
+}
+
+func testCountGoodChecks(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api)
+	now := time.Unix(base+3600, 0)
+	save(t, ctx, store, "prod", "api", check(0, monitor.StateUp, 100), check(2900, monitor.StateDown, 0), check(3300, monitor.StateUp, 900))
+
+	windows := []time.Duration{2 * time.Hour, 10 * time.Minute}
+	availability := monitor.SLO{Name: "availability", Slug: "prod", Type: monitor.SLOAvailability, Target: 99}
+	total, good, err := store.CountGoodChecks(ctx, availability, now, windows)
+	if err != nil {
+		t.Fatalf("CountGoodChecks: %v", err)
+	}
+	if total[0] != 3 || good[0] != 2 || total[1] != 1 || good[1] != 1 {
+		t.Errorf("availability counts = %v/%v, want [2 1]/[3 1]", good, total)
+	}
+
+	latency := monitor.SLO{Name: "latency", Slug: "prod", Monitor: "api", Type: monitor.SLOLatency, Target: 95,
+		Threshold: monitor.Duration(500 * time.Millisecond)}
+	_, good, err = store.CountGoodChecks(ctx, latency, now, windows)
+	if err != nil {
+		t.Fatalf("CountGoodChecks: %v", err)
+	}
+	if good[0] != 1 || good[1] != 0 {
+		t.Errorf("latency good counts = %v, want [1 0]", good)
+	}
+}
+
+func testPurgeSlug(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api)
+	save(t, ctx, store, "prod", "api", check(0, monitor.StateUp, 100), check(7200, monitor.StateUp, 100))
+
+	policy := monitor.RetentionPolicy{Raw: monitor.Duration(time.Hour)}
+	purged, err := store.PurgeSlug(ctx, "prod", policy, time.Unix(base+7200, 0))
+	if err != nil {
+		t.Fatalf("PurgeSlug: %v", err)
+	}
+	if len(purged) == 0 {
+		t.Error("PurgeSlug reported nothing purged")
+	}
+
+	checks, err := store.ListChecks(ctx, "prod", "api", base, base+7200)
+	if err != nil {
+		t.Fatalf("ListChecks: %v", err)
+	}
+	if len(checks) != 1 || checks[0].Timestamp != base+7200 {
+		t.Errorf("checks after purge = %+v, want only the recent one", checks)
+	}
+	hours, err := store.Rollups(ctx, monitor.ResolutionHour, "prod", "api", base, base+7200)
+	if err != nil {
+		t.Fatalf("Rollups: %v", err)
+	}
+	if len(hours) != 1 || hours[0].BucketStart != base {
+		t.Errorf("hourly rollups after purge = %+v, want the purged hour kept", hours)
+	}
+}
+
+func testExportImport(t *testing.T, open func(t *testing.T) monitor.Store) {
+	ctx := context.Background()
+	stores := make([]monitor.Store, 2)
+	for i := range stores {
+		stores[i] = open(t)
+		store := stores[i]
+		t.Cleanup(func() { store.Close() })
+		if _, err := store.Migrate(ctx); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+	}
+	source, target := stores[0], stores[1]
+
+	sync(t, ctx, source, api, monitor.Monitor{Slug: "staging", Name: "api", URL: "https://staging.example.com"})
+	save(t, ctx, source, "prod", "api", check(0, monitor.StateUp, 100), check(60, monitor.StateDown, 0), check(120, monitor.StateUp, 200))
+	save(t, ctx, source, "staging", "api", check(0, monitor.StateUp, 100))
+
+	export := func(store monitor.Store, filter monitor.ExportFilter) []monitor.ExportRecord {
+		t.Helper()
+		var records []monitor.ExportRecord
+		if err := monitor.Export(ctx, store, filter, func(r monitor.ExportRecord) error {
+			if r.Incident != nil {
+				r.Incident.ID = 0
+			}
+			records = append(records, r)
+			return nil
+		}); err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+		return records
+	}
+
+	records := export(source, monitor.ExportFilter{Slug: "prod", End: base + 3600})
+	for _, r := range records {
+		if r.Slug != "prod" {
+			t.Fatalf("Export with a slug filter returned %+v", r)
+		}
+	}
+	// Importing twice, the second time in small batches as if resuming, must not duplicate anything.
+	if err := target.Import(ctx, records); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	for i := 0; i < len(records); i += 2 {
+		if err := target.Import(ctx, records[i:min(i+2, len(records))]); err != nil {
+			t.Fatalf("second Import: %v", err)
+		}
+	}
+
+	imported := export(target, monitor.ExportFilter{End: base + 3600})
+	if len(imported) != len(records) {
+		t.Fatalf("target has %d records after importing %d", len(imported), len(records))
+	}
+	for i := range records {
+		want, _ := json.Marshal(records[i])
+		got, _ := json.Marshal(imported[i])
+		if string(got) != string(want) {
+			t.Errorf("record %d = %s, want %s", i, got, want)
+		}
+	}
+}
+
+func testImportOverlapping(t *testing.T, open func(t *testing.T) monitor.Store) {
+	ctx := context.Background()
+	stores := make([]monitor.Store, 2)
+	for i := range stores {
+		stores[i] = open(t)
+		store := stores[i]
+		t.Cleanup(func() { store.Close() })
+		if _, err := store.Migrate(ctx); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		sync(t, ctx, store, api)
+	}
+	source, target := stores[0], stores[1]
+	save(t, ctx, source, "prod", "api", check(0, monitor.StateUp, 100), check(60, monitor.StateDown, 0), check(120, monitor.StateUp, 200))
+	// The target has a check of its own in the first minute and one at the same time as the second.
+	save(t, ctx, target, "prod", "api", check(30, monitor.StateUp, 300), check(60, monitor.StateDown, 0))
+
+	var records []monitor.ExportRecord
+	if err := monitor.Export(ctx, source, monitor.ExportFilter{End: base + 3600}, func(r monitor.ExportRecord) error {
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	// An hour whose checks the source no longer keeps is only known from its rollup.
+	for _, r := range records {
+		if r.Kind == monitor.RecordRollup && r.Resolution == monitor.ResolutionHour {
+			old := *r.Rollup
+			old.BucketStart = base - 24*3600
+			old.Histogram = append([]int(nil), old.Histogram...)
+			records = append(records, monitor.ExportRecord{Kind: monitor.RecordRollup, Slug: "prod", Name: "api",
+				Resolution: monitor.ResolutionHour, Rollup: &old})
+			break
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := target.Import(ctx, records); err != nil {
+			t.Fatalf("Import %d: %v", i+1, err)
+		}
+	}
+
+	checks, err := target.ListChecks(ctx, "prod", "api", base-24*3600, base+3600)
+	if err != nil {
+		t.Fatalf("ListChecks: %v", err)
+	}
+	if len(checks) != 4 {
+		t.Fatalf("target has %d checks, want its own two and the two new ones: %+v", len(checks), checks)
+	}
+	minutes, err := target.Rollups(ctx, monitor.ResolutionMinute, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("Rollups: %v", err)
+	}
+	if len(minutes) != 3 || minutes[0].Up != 2 || minutes[0].LatencyMax != 300 || minutes[1].Down != 1 || minutes[2].Up != 1 {
+		t.Errorf("minute rollups = %+v, want the stored and imported checks merged", minutes)
+	}
+	raw, err := target.AggregateChecks(ctx, "prod", "api", base, base+3600)
+	if err != nil {
+		t.Fatalf("AggregateChecks: %v", err)
+	}
+	// The day bucket of the checks starts before base; the imported hour is a day earlier.
+	for _, res := range []monitor.Resolution{monitor.ResolutionMinute, monitor.ResolutionHour, monitor.ResolutionDay} {
+		agg, err := target.AggregateRollups(ctx, res, "prod", "api", base-24*3600+1, base+3600)
+		if err != nil {
+			t.Fatalf("AggregateRollups: %v", err)
+		}
+		if agg.Total() != raw.Total() || agg.Up != raw.Up || agg.Down != raw.Down || agg.LatencySum != raw.LatencySum {
+			t.Errorf("%s rollups = %+v, want them to match the checks %+v", res, agg, raw)
+		}
+	}
+	hours, err := target.Rollups(ctx, monitor.ResolutionHour, "prod", "api", base-24*3600, base-23*3600)
+	if err != nil {
+		t.Fatalf("Rollups: %v", err)
+	}
+	if len(hours) != 1 || hours[0].Total() != 3 {
+		t.Errorf("hourly rollups without checks = %+v, want the imported bucket", hours)
+	}
+}
+
+func testImportIDCollision(t *testing.T, ctx context.Context, store monitor.Store) {
+	sync(t, ctx, store, api)
+	monitors, err := store.ListAllMonitors(ctx)
+	if err != nil || len(monitors) != 1 {
+		t.Fatalf("ListAllMonitors = %+v, %v", monitors, err)
+	}
+	id := monitors[0].ID
+
+	// The same monitor is kept, whatever its id.
+	same := monitor.ExportedMonitor{ID: "other", Slug: "prod", Name: "api", URL: api.URL}
+	if err := store.Import(ctx, []monitor.ExportRecord{{Kind: monitor.RecordMonitor, Slug: "prod", Name: "api", Monitor: &same}}); err != nil {
+		t.Fatalf("Import of an existing monitor: %v", err)
+	}
+
+	// Another monitor with the id of api is refused, with its checks.
+	web := monitor.ExportedMonitor{ID: id, Slug: "prod", Name: "web", URL: "https://example.com"}
+	c := check(0, monitor.StateUp, 100)
+	err = store.Import(ctx, []monitor.ExportRecord{
+		{Kind: monitor.RecordMonitor, Slug: "prod", Name: "web", Monitor: &web},
+		{Kind: monitor.RecordCheck, Slug: "prod", Name: "web", Check: &c},
+	})
+	if err == nil || !strings.Contains(err.Error(), "already used by 'prod/api'") {
+		t.Fatalf("Import with a used id = %v, want an error naming prod/api", err)
+	}
+	monitors, err = store.ListAllMonitors(ctx)
+	if err != nil || len(monitors) != 1 || monitors[0].ID != id {
+		t.Errorf("monitors after a refused import = %+v, %v; want only api", monitors, err)
+	}
+}
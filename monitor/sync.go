@@ -0,0 +1,254 @@
+package monitor
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+)
+
+// historyTables are the tables that hold per-monitor history keyed by (monitor_slug, monitor_name).
+// A renamed monitor's rows are moved in all of them.
+var historyTables = []string{
+	"log_entries",
+	"incidents",
+	ResolutionMinute.table(),
+	ResolutionHour.table(),
+	ResolutionDay.table(),
+}
+
+// storedMonitor is a row of the monitors table.
+type storedMonitor struct {
+	ID         string
+	Slug       string
+	Name       string
+	ArchivedAt sql.NullInt64
+}
+
+// newMonitorID returns a random identifier for a monitor that has no explicit id.
+func newMonitorID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate monitor id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ensureMonitorIDs adds the id and archived_at columns to older databases and gives every
+// stored monitor a stable id.
+func ensureMonitorIDs(ctx context.Context, tx *sql.Tx) error {
+	if _, err := ensureColumn(ctx, tx, "monitors", "id", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := ensureColumn(ctx, tx, "monitors", "archived_at", "INTEGER"); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT slug, name FROM monitors WHERE id IS NULL OR id = ''`)
+	if err != nil {
+		return fmt.Errorf("error reading monitors without id: %w", err)
+	}
+	var missing []storedMonitor
+	for rows.Next() {
+		var m storedMonitor
+		if err := rows.Scan(&m.Slug, &m.Name); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning monitor without id: %w", err)
+		}
+		missing = append(missing, m)
+	}
+	rows.Close()
+
+	for _, m := range missing {
+		id, err := newMonitorID()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE monitors SET id = ? WHERE slug = ? AND name = ?`, id, m.Slug, m.Name); err != nil {
+			return fmt.Errorf("error assigning id to monitor '%s/%s': %w", m.Slug, m.Name, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS idx_monitors_id ON monitors (id)`); err != nil {
+		return fmt.Errorf("error creating index on monitors: %w", err)
+	}
+	return nil
+}
+
+// resolvePreviousNames fills in omitted slugs of previous names and rejects ids or previous
+// names that would make two configured monitors claim the same history.
+func resolvePreviousNames(monitors []Monitor) error {
+	configured := make(map[string]bool, len(monitors))
+	for _, m := range monitors {
+		configured[monitorKey(m.Slug, m.Name)] = true
+	}
+
+	ids := make(map[string]string)
+	claimed := make(map[string]string)
+	for i := range monitors {
+		m := &monitors[i]
+		key := monitorKey(m.Slug, m.Name)
+		if m.ID != "" {
+			if other, ok := ids[m.ID]; ok {
+				return fmt.Errorf("monitors '%s' and '%s' have the same id '%s'", other, key, m.ID)
+			}
+			ids[m.ID] = key
+		}
+		for j := range m.PreviousNames {
+			ref := &m.PreviousNames[j]
+			if ref.Slug == "" {
+				ref.Slug = m.Slug
+			}
+			if configured[ref.String()] {
+				return fmt.Errorf("monitor '%s' lists '%s' as a previous name, but it is still configured", key, ref)
+			}
+			if other, ok := claimed[ref.String()]; ok {
+				return fmt.Errorf("monitors '%s' and '%s' both list '%s' as a previous name", other, key, ref)
+			}
+			claimed[ref.String()] = key
+		}
+	}
+	return nil
+}
+
+// SyncMonitors brings the monitors table in line with the configuration without losing history.
+// Each configured monitor is matched to a stored one by explicit id, then by slug and name, then by
+// its previous names; a match under another name is renamed together with its history. Stored
+// monitors that are no longer configured are archived rather than deleted. The stable id of every
+// configured monitor is filled in.
+func (s *sqlStore) SyncMonitors(ctx context.Context, monitors []Monitor) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Renames update the monitors key and its history in several statements; foreign keys
+	// are checked once at commit.
+	if s.dialect.deferForeignKeys != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.deferForeignKeys); err != nil {
+			return fmt.Errorf("failed to defer foreign keys: %w", err)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, slug, name, archived_at FROM monitors`)
+	if err != nil {
+		return fmt.Errorf("failed to read stored monitors: %w", err)
+	}
+	byID := make(map[string]*storedMonitor)
+	byKey := make(map[string]*storedMonitor)
+	for rows.Next() {
+		m := &storedMonitor{}
+		if err := rows.Scan(&m.ID, &m.Slug, &m.Name, &m.ArchivedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stored monitor: %w", err)
+		}
+		byID[m.ID] = m
+		byKey[monitorKey(m.Slug, m.Name)] = m
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("error during rows iteration for stored monitors: %w", err)
+	}
+	rows.Close()
+
+	active := make(map[string]bool)
+	for i := range monitors {
+		m := &monitors[i]
+		key := monitorKey(m.Slug, m.Name)
+
+		stored := byKey[key]
+		if m.ID != "" {
+			if withID, ok := byID[m.ID]; ok {
+				stored = withID
+			}
+		}
+		if stored == nil {
+			for _, ref := range m.PreviousNames {
+				if previous, ok := byKey[ref.String()]; ok && !active[previous.ID] {
+					stored = previous
+					break
+				}
+			}
+		}
+
+		if stored == nil {
+			id := m.ID
+			if id == "" {
+				if id, err = newMonitorID(); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO monitors (id, slug, name, url) VALUES (?, ?, ?, ?)`),
+				id, m.Slug, m.Name, m.URL); err != nil {
+				return fmt.Errorf("failed to add monitor '%s': %w", key, err)
+			}
+			m.ID = id
+			active[id] = true
+			continue
+		}
+
+		if active[stored.ID] {
+			return fmt.Errorf("monitor '%s' matches history already claimed by another monitor", key)
+		}
+		if stored.Slug != m.Slug || stored.Name != m.Name {
+			if other, ok := byKey[key]; ok && other != stored {
+				return fmt.Errorf("cannot move history of '%s/%s' to '%s': a monitor with that name already has history",
+					stored.Slug, stored.Name, key)
+			}
+			if err := s.renameMonitor(ctx, tx, *stored, m.Slug, m.Name); err != nil {
+				return err
+			}
+			log.Printf("Monitor '%s/%s' was renamed to '%s'; its history has been kept.", stored.Slug, stored.Name, key)
+			delete(byKey, monitorKey(stored.Slug, stored.Name))
+			stored.Slug, stored.Name = m.Slug, m.Name
+			byKey[key] = stored
+		}
+
+		id := stored.ID
+		if m.ID != "" && m.ID != stored.ID {
+			// An explicit id replaces the generated one the first time it is configured.
+			id = m.ID
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`UPDATE monitors SET id = ?, url = ?, archived_at = NULL WHERE slug = ? AND name = ?`),
+			id, m.URL, m.Slug, m.Name); err != nil {
+			return fmt.Errorf("failed to update monitor '%s': %w", key, err)
+		}
+		if stored.ArchivedAt.Valid {
+			log.Printf("Monitor '%s' was restored from the archive.", key)
+		}
+		m.ID = id
+		active[stored.ID] = true
+		active[id] = true
+	}
+
+	now := time.Now().Unix()
+	for _, stored := range byID {
+		if active[stored.ID] || stored.ArchivedAt.Valid {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`UPDATE monitors SET archived_at = ? WHERE id = ?`), now, stored.ID); err != nil {
+			return fmt.Errorf("failed to archive monitor '%s/%s': %w", stored.Slug, stored.Name, err)
+		}
+		log.Printf("Monitor '%s/%s' is no longer configured and has been archived with its history.", stored.Slug, stored.Name)
+	}
+
+	return tx.Commit()
+}
+
+// renameMonitor moves a stored monitor and all of its history to a new slug and name.
+func (s *sqlStore) renameMonitor(ctx context.Context, tx *sql.Tx, stored storedMonitor, slug, name string) error {
+	if _, err := tx.ExecContext(ctx, s.q(`UPDATE monitors SET slug = ?, name = ? WHERE id = ?`), slug, name, stored.ID); err != nil {
+		return fmt.Errorf("failed to rename monitor '%s/%s': %w", stored.Slug, stored.Name, err)
+	}
+	for _, table := range historyTables {
+		if _, err := tx.ExecContext(ctx, s.q(`UPDATE `+table+` SET monitor_slug = ?, monitor_name = ? WHERE monitor_slug = ? AND monitor_name = ?`),
+			slug, name, stored.Slug, stored.Name); err != nil {
+			return fmt.Errorf("failed to move %s of '%s/%s': %w", table, stored.Slug, stored.Name, err)
+		}
+	}
+	return nil
+}
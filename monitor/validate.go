@@ -0,0 +1,444 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MonitorTypeHTTP is the monitor type that checks a URL with an HTTP GET request. It is the
+// default and currently the only type.
+const MonitorTypeHTTP = "http"
+
+// ConfigError is a problem in the monitors configuration, located by file and line where known.
+type ConfigError struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error formats the problem as "file:line: message".
+func (e ConfigError) Error() string {
+	if location := e.location(); location != "" {
+		return location + ": " + e.Message
+	}
+	return e.Message
+}
+
+// location formats where the problem is, as "file:line" or "file".
+func (e ConfigError) location() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	return e.File
+}
+
+// ConfigErrors lists every problem found in the monitors configuration.
+type ConfigErrors []ConfigError
+
+// Error joins the problems into one line.
+func (errs ConfigErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	return fmt.Sprintf("%d problems: %s", len(errs), strings.Join(messages, "; "))
+}
+
+// ValidateConfig loads the monitors configuration at path, a file or a directory, as the service
+// would and returns its monitors. The error lists every problem found as ConfigErrors.
+func ValidateConfig(path string, retention RetentionPolicy) ([]Monitor, error) {
+	config, err := loadConfig(path, retention)
+	if err != nil {
+		return nil, err
+	}
+	return config.Monitors, nil
+}
+
+// configPath is a location in a decoded configuration file, as object keys and array indexes.
+type configPath []interface{}
+
+// with returns the path extended by an object key or array index.
+func (p configPath) with(elem interface{}) configPath {
+	return append(p[:len(p):len(p)], elem)
+}
+
+// String formats the path as in "monitors[2].url".
+func (p configPath) String() string {
+	var b strings.Builder
+	for _, elem := range p {
+		switch e := elem.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", e)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, e)
+		}
+	}
+	return b.String()
+}
+
+// configFile collects the problems of one configuration file.
+type configFile struct {
+	name string
+	// line returns the line of a path in the file, or 0 if it is unknown.
+	line func(configPath) int
+	errs ConfigErrors
+}
+
+// errorf records a problem at path.
+func (f *configFile) errorf(path configPath, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if len(path) > 0 {
+		message = path.String() + ": " + message
+	}
+	f.errs = append(f.errs, ConfigError{File: f.name, Line: f.line(path), Message: message})
+}
+
+// monitorErrorf records a problem of a monitor, located at one of its settings.
+func (f *configFile) monitorErrorf(path configPath, m Monitor, format string, args ...interface{}) {
+	f.errs = append(f.errs, ConfigError{
+		File:    f.name,
+		Line:    f.line(path),
+		Message: fmt.Sprintf("monitor '%s': ", monitorKey(m.Slug, m.Name)) + fmt.Sprintf(format, args...),
+	})
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// checkValue reports the parts of a decoded configuration value that would not decode into t:
+// object keys that t does not have, values of the wrong kind and values rejected by t's own
+// decoding, such as invalid durations.
+func (f *configFile) checkValue(path configPath, v interface{}, t reflect.Type) {
+	if v == nil {
+		return
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		if err := decodeAs(v, reflect.New(t).Interface()); err != nil {
+			f.errorf(path, "%s", err)
+			return
+		}
+		// Types such as MonitorRef also accept an object, whose keys are checked below.
+		if _, ok := v.(map[string]interface{}); !ok || t.Kind() != reflect.Struct {
+			return
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		f.checkValue(path, v, t.Elem())
+	case reflect.Struct:
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			f.errorf(path, "expected an object, got %s", describeValue(v))
+			return
+		}
+		fields := jsonFields(t)
+		for _, key := range sortedKeys(object) {
+			field, ok := fields[key]
+			if !ok {
+				f.errorf(path.with(key), "unknown key '%s'", key)
+				continue
+			}
+			f.checkValue(path.with(key), object[key], field.Type)
+		}
+	case reflect.Slice:
+		list, ok := v.([]interface{})
+		if !ok {
+			f.errorf(path, "expected a list, got %s", describeValue(v))
+			return
+		}
+		for i, item := range list {
+			f.checkValue(path.with(i), item, t.Elem())
+		}
+	case reflect.Map:
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			f.errorf(path, "expected an object, got %s", describeValue(v))
+			return
+		}
+		for _, key := range sortedKeys(object) {
+			f.checkValue(path.with(key), object[key], t.Elem())
+		}
+	default:
+		if decodeAs(v, reflect.New(t).Interface()) != nil {
+			f.errorf(path, "expected %s, got %s", describeKind(t), describeValue(v))
+		}
+	}
+}
+
+// decodeAs decodes a decoded configuration value into dst, a pointer.
+func decodeAs(v interface{}, dst interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// jsonFields returns the fields of a struct type by their JSON names.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// describeKind names the kind of value a type expects.
+func describeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	default:
+		return "a number"
+	}
+}
+
+// describeValue names the kind of a decoded configuration value.
+func describeValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return strconv.Quote(value)
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "a list"
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// validateMonitor reports the problems of a monitor that decoded successfully. path locates the
+// monitor in its file.
+func (f *configFile) validateMonitor(path configPath, m Monitor) {
+	if m.Slug == "" {
+		f.monitorErrorf(path, m, "slug is required")
+	}
+	if m.Name == "" {
+		f.monitorErrorf(path, m, "name is required")
+	}
+	if m.URL == "" {
+		f.monitorErrorf(path, m, "url is required")
+	} else if u, err := url.Parse(m.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		f.monitorErrorf(path.with("url"), m, "url %q is not an absolute http or https URL", m.URL)
+	}
+	if m.Type != "" && m.Type != MonitorTypeHTTP {
+		f.monitorErrorf(path.with("type"), m, "unknown monitor type %q, expected %q", m.Type, MonitorTypeHTTP)
+	}
+	if m.Interval < 0 {
+		f.monitorErrorf(path.with("interval"), m, "interval must not be negative")
+	} else if m.Interval > 0 && time.Duration(m.Interval) < MinCheckInterval {
+		f.monitorErrorf(path.with("interval"), m, "interval must be at least %s", MinCheckInterval)
+	}
+	if m.DownInterval < 0 {
+		f.monitorErrorf(path.with("down_interval"), m, "down_interval must not be negative")
+	} else if m.DownInterval > 0 && time.Duration(m.DownInterval) < MinCheckInterval {
+		f.monitorErrorf(path.with("down_interval"), m, "down_interval must be at least %s", MinCheckInterval)
+	}
+	if m.LatencyThreshold < 0 {
+		f.monitorErrorf(path.with("latency_threshold"), m, "latency_threshold must not be negative")
+	}
+	for i, w := range m.Maintenance {
+		if !w.End.After(w.Start) {
+			f.monitorErrorf(path.with("maintenance").with(i), m, "maintenance window ends before it starts")
+		}
+	}
+	if m.Source != "" {
+		f.monitorErrorf(path.with("source"), m, "source is set by the service and cannot be configured")
+	}
+}
+
+// lineIndex maps the paths of a configuration file, formatted by configPath.String, to lines.
+type lineIndex map[string]int
+
+// line returns the line of path, or of its closest ancestor that has one.
+func (idx lineIndex) line(path configPath) int {
+	for n := len(path); n >= 0; n-- {
+		if line, ok := idx[path[:n].String()]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+// jsonLines indexes the lines of a JSON document. Object members are located at their key.
+func jsonLines(data []byte) lineIndex {
+	idx := lineIndex{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// start returns the line of the next token, skipping the separators before it.
+	start := func() int {
+		offset := int(dec.InputOffset())
+		for offset < len(data) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+			offset++
+		}
+		return bytes.Count(data[:offset], []byte("\n")) + 1
+	}
+
+	var walk func(path configPath) error
+	walk = func(path configPath) error {
+		if _, ok := idx[path.String()]; !ok {
+			idx[path.String()] = start()
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				line := start()
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				member := path.with(fmt.Sprint(key))
+				idx[member.String()] = line
+				if err := walk(member); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(path.with(i)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err
+	}
+	// A syntax error is reported when the document is decoded; the lines found before it are kept.
+	walk(nil)
+	return idx
+}
+
+// yamlLines indexes the lines of a YAML document. Mapping entries are located at their key.
+func yamlLines(data []byte) lineIndex {
+	idx := lineIndex{}
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return idx
+	}
+
+	var walk func(path configPath, node *yaml.Node)
+	walk = func(path configPath, node *yaml.Node) {
+		if _, ok := idx[path.String()]; !ok {
+			idx[path.String()] = node.Line
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				member := path.with(node.Content[i].Value)
+				idx[member.String()] = node.Content[i].Line
+				walk(member, node.Content[i+1])
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				walk(path.with(i), item)
+			}
+		case yaml.AliasNode:
+			if node.Alias != nil {
+				walk(path, node.Alias)
+			}
+		}
+	}
+	walk(nil, doc.Content[0])
+	return idx
+}
+
+// tomlLines returns a best-effort line lookup for a TOML document. It follows [table] and
+// [[array]] headers and key = value lines, which covers the usual layout of a configuration
+// file; anything else is located at its closest enclosing table.
+func tomlLines(data []byte) func(configPath) int {
+	lines := strings.Split(string(data), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	// find returns the index of the first line equal to want at or after from, or -1.
+	find := func(from int, want string) int {
+		for i := from; i < len(lines); i++ {
+			if lines[i] == want {
+				return i
+			}
+		}
+		return -1
+	}
+	// findPrefix returns the index of the first line starting with one of prefixes at or after
+	// from, or -1.
+	findPrefix := func(from int, prefixes ...string) int {
+		for i := from; i < len(lines); i++ {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(lines[i], prefix) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+
+	return func(path configPath) int {
+		line, from, table := 0, 0, ""
+		for _, elem := range path {
+			switch key := elem.(type) {
+			case int:
+				i := from - 1
+				for n := 0; n <= key; n++ {
+					if i = find(i+1, "[["+table+"]]"); i < 0 {
+						return line
+					}
+				}
+				line, from = i+1, i+1
+			case string:
+				name := key
+				if table != "" {
+					name = table + "." + key
+				}
+				if i := find(from, "["+name+"]"); i >= 0 {
+					line, from, table = i+1, i+1, name
+					continue
+				}
+				if findPrefix(0, "[["+name+"]]") >= 0 {
+					table = name
+					continue
+				}
+				// A table declared only by its subtables is located at the first of them.
+				if i := findPrefix(from, "["+name+".", "[["+name+"."); i >= 0 {
+					line, from, table = i+1, i, name
+					continue
+				}
+				for i := from; i < len(lines) && !strings.HasPrefix(lines[i], "["); i++ {
+					k, _, ok := strings.Cut(lines[i], "=")
+					if ok && strings.Trim(strings.TrimSpace(k), `"'`) == key {
+						return i + 1
+					}
+				}
+				return line
+			}
+		}
+		return line
+	}
+}
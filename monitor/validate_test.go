@@ -0,0 +1,149 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigErrorLines(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want []string
+	}{
+		{
+			name: "JSON",
+			file: "monitors.json",
+			data: `{
+  "monitors": [
+    {
+      "slug": "prod",
+      "name": "api",
+      "url": "https://api.example.com/",
+      "timeout": "5s",
+      "headers": {
+        "Authorization": 42
+      },
+      "depends_on": ["prod/db", {"slug": "prod", "nam": "db"}]
+    },
+    {
+      "slug": "prod",
+      "name": "web",
+      "url": "ftp://example.com/",
+      "interval": "500ms"
+    }
+  ]
+}`,
+			want: []string{
+				"monitors.json:7: monitors[0].timeout: unknown key 'timeout'",
+				"monitors.json:9: monitors[0].headers.Authorization: expected a string, got 42",
+				"monitors.json:11: monitors[0].depends_on[1].nam: unknown key 'nam'",
+				"monitors.json:16: monitor 'prod/web': url \"ftp://example.com/\" is not an absolute http or https URL",
+				"monitors.json:17: monitor 'prod/web': interval must be at least 1s",
+			},
+		},
+		{
+			name: "JSON list",
+			file: "monitors.json",
+			data: `[
+  {"slug": "prod", "name": "api", "url": "https://api.example.com/"},
+  {"slug": "prod", "name": "web",
+   "paused": "yes"}
+]`,
+			want: []string{
+				"monitors.json:4: monitors[1].paused: expected true or false, got \"yes\"",
+			},
+		},
+		{
+			name: "YAML",
+			file: "monitors.yaml",
+			data: `defaults:
+  interval: 30s
+  retries: 3
+monitors:
+  - slug: prod
+    name: api
+    url: https://api.example.com/
+    headers:
+      Authorization: [a, b]
+    depends_on:
+      - prod/db
+      - slug: prod
+        nam: db
+  - slug: prod
+    name: web
+    url: https://example.com/
+    down_interval: -1m
+`,
+			want: []string{
+				"monitors.yaml:3: defaults.retries: unknown key 'retries'",
+				"monitors.yaml:9: monitors[0].headers.Authorization: expected a string, got a list",
+				"monitors.yaml:13: monitors[0].depends_on[1].nam: unknown key 'nam'",
+				"monitors.yaml:17: monitor 'prod/web': down_interval must not be negative",
+			},
+		},
+		{
+			name: "TOML arrays of tables",
+			file: "monitors.toml",
+			data: `[[monitors]]
+slug = "prod"
+name = "api"
+url = "https://api.example.com/"
+timeout = "5s"
+depends_on = ["prod/db", { slug = "prod", nam = "db" }]
+
+[monitors.headers]
+Authorization = 42
+
+[[monitors]]
+slug = "prod"
+name = "web"
+url = "ftp://example.com/"
+interval = "500ms"
+`,
+			want: []string{
+				"monitors.toml:5: monitors[0].timeout: unknown key 'timeout'",
+				"monitors.toml:6: monitors[0].depends_on[1].nam: unknown key 'nam'",
+				"monitors.toml:9: monitors[0].headers.Authorization: expected a string, got 42",
+				"monitors.toml:14: monitor 'prod/web': url \"ftp://example.com/\" is not an absolute http or https URL",
+				"monitors.toml:15: monitor 'prod/web': interval must be at least 1s",
+			},
+		},
+		{
+			name: "TOML tables",
+			file: "monitors.toml",
+			data: `[defaults]
+interval = "1m"
+
+[groups.prod]
+latency_threshold = "-1s"
+
+[groups.staging.headers]
+X-Env = "staging"
+
+[[monitors]]
+slug = "prod"
+name = "api"
+url = "https://api.example.com/"
+`,
+			want: []string{
+				"monitors.toml:7: groups.staging: group matches no monitors",
+				// Settings from a group are located at the monitor they apply to.
+				"monitors.toml:10: monitor 'prod/api': latency_threshold must not be negative",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, _ := parseConfigFile(tt.file, []byte(tt.data))
+			got := make([]string, len(f.errs))
+			for i, e := range f.errs {
+				got[i] = e.Error()
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultWriteBatchSize is the number of checks after which the writer flushes early.
+	DefaultWriteBatchSize = 100
+	// DefaultWriteFlushInterval is how often the writer flushes queued checks.
+	DefaultWriteFlushInterval = 500 * time.Millisecond
+	// DefaultWriteQueueSize is the number of checks that can wait to be written before checks block.
+	DefaultWriteQueueSize = 1000
+	// WriteCloseTimeout is how long the service waits on shutdown for queued checks to be written,
+	// once the checks have stopped.
+	WriteCloseTimeout = 10 * time.Second
+)
+
+// CheckRecord is a check result waiting to be stored for a monitor.
+type CheckRecord struct {
+	Slug  string
+	Name  string
+	Entry MonitorLogEntry
+}
+
+// WriterMetrics describes the result writer's queue and flushes.
+type WriterMetrics struct {
+	QueueDepth    int `json:"queue_depth"`
+	QueueCapacity int `json:"queue_capacity"`
+	// ChecksWritten and ChecksFailed count checks that were and were not stored.
+	ChecksWritten int64 `json:"checks_written"`
+	ChecksFailed  int64 `json:"checks_failed"`
+	// Flushes is the number of batches written; FlushSeconds is the total time spent writing them.
+	Flushes           int64   `json:"flushes"`
+	FlushSeconds      float64 `json:"flush_seconds"`
+	LastFlushSeconds  float64 `json:"last_flush_seconds"`
+	MaxFlushSeconds   float64 `json:"max_flush_seconds"`
+	LastFlushBatchLen int     `json:"last_flush_batch_size"`
+}
+
+// resultWriter queues check results from the monitor goroutines and stores them in batches,
+// one transaction per batch, so that concurrent checks do not contend for the database.
+type resultWriter struct {
+	store         Store
+	queue         chan CheckRecord
+	batchSize     int
+	flushInterval time.Duration
+
+	// flushRequests asks run to write everything queued and then close the given channel.
+	flushRequests chan chan struct{}
+	// stopping is closed by Close; done is closed once the queue has been drained.
+	stopping  chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	// ctx is the context of writes; abort cancels it when Close gives up waiting, so that the
+	// write in progress stops and the checks left are dropped.
+	ctx   context.Context
+	abort context.CancelFunc
+
+	written atomic.Int64
+	failed  atomic.Int64
+
+	flushMu sync.Mutex
+	flushes int64
+	total   time.Duration
+	last    time.Duration
+	max     time.Duration
+	lastLen int
+}
+
+// newResultWriter starts a writer for store. Zero settings fall back to the Default* constants.
+func newResultWriter(store Store, batchSize int, flushInterval time.Duration, queueSize int) *resultWriter {
+	if batchSize <= 0 {
+		batchSize = DefaultWriteBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultWriteFlushInterval
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultWriteQueueSize
+	}
+	w := &resultWriter{
+		store:         store,
+		queue:         make(chan CheckRecord, queueSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		flushRequests: make(chan chan struct{}),
+		stopping:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	w.ctx, w.abort = context.WithCancel(context.Background())
+	go w.run()
+	return w
+}
+
+// enqueue queues a check to be written. It blocks while the queue is full, so a slow database
+// slows down checks instead of losing them. Checks enqueued after Close are dropped.
+func (w *resultWriter) enqueue(record CheckRecord) {
+	select {
+	case <-w.stopping:
+		w.failed.Add(1)
+		log.Printf("Error: Dropping check for monitor '%s/%s': the result writer is closed.", record.Slug, record.Name)
+		return
+	default:
+	}
+	select {
+	case w.queue <- record:
+	case <-w.stopping:
+		w.failed.Add(1)
+		log.Printf("Error: Dropping check for monitor '%s/%s': the result writer is closed.", record.Slug, record.Name)
+	}
+}
+
+// run collects queued checks into batches and writes a batch when it is full, when the flush
+// interval passes or when Flush asks for it. Once stopping is closed it writes whatever is still
+// queued and returns.
+func (w *resultWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]CheckRecord, 0, w.batchSize)
+	for {
+		select {
+		case record := <-w.queue:
+			batch = append(batch, record)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case flushed := <-w.flushRequests:
+			batch = w.drain(batch)
+			close(flushed)
+		case <-w.stopping:
+			w.drain(batch)
+			return
+		}
+	}
+}
+
+// drain writes the batch and everything currently queued, and returns the emptied batch.
+func (w *resultWriter) drain(batch []CheckRecord) []CheckRecord {
+	for {
+		select {
+		case record := <-w.queue:
+			batch = append(batch, record)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(batch)
+			}
+		default:
+			return w.flush(batch)
+		}
+	}
+}
+
+// flush writes a batch in one transaction and returns the emptied batch for reuse. If the batch
+// fails, its checks are retried one by one so that a single bad check does not lose the others.
+func (w *resultWriter) flush(batch []CheckRecord) []CheckRecord {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx := w.ctx
+	if ctx.Err() != nil {
+		w.failed.Add(int64(len(batch)))
+		log.Printf("Error: Dropping %d checks: the result writer was stopped before they were written.", len(batch))
+		return batch[:0]
+	}
+	start := time.Now()
+	err := w.store.SaveChecks(ctx, batch)
+	if err != nil && ctx.Err() != nil {
+		w.failed.Add(int64(len(batch)))
+		log.Printf("Error: Dropping %d checks: the result writer was stopped while writing them.", len(batch))
+		return batch[:0]
+	}
+	if err != nil {
+		log.Printf("Error: Failed to write %d checks in one batch, retrying one by one: %v", len(batch), err)
+		for _, record := range batch {
+			if err := w.store.SaveChecks(ctx, []CheckRecord{record}); err != nil {
+				w.failed.Add(1)
+				log.Printf("Error saving check for monitor '%s/%s': %v", record.Slug, record.Name, err)
+				continue
+			}
+			w.written.Add(1)
+		}
+	} else {
+		w.written.Add(int64(len(batch)))
+	}
+	w.observeFlush(time.Since(start), len(batch))
+	return batch[:0]
+}
+
+// observeFlush records the latency of a flush.
+func (w *resultWriter) observeFlush(elapsed time.Duration, size int) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	w.flushes++
+	w.total += elapsed
+	w.last = elapsed
+	w.lastLen = size
+	if elapsed > w.max {
+		w.max = elapsed
+	}
+}
+
+// metrics returns a snapshot of the writer's metrics.
+func (w *resultWriter) metrics() WriterMetrics {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	return WriterMetrics{
+		QueueDepth:        len(w.queue),
+		QueueCapacity:     cap(w.queue),
+		ChecksWritten:     w.written.Load(),
+		ChecksFailed:      w.failed.Load(),
+		Flushes:           w.flushes,
+		FlushSeconds:      w.total.Seconds(),
+		LastFlushSeconds:  w.last.Seconds(),
+		MaxFlushSeconds:   w.max.Seconds(),
+		LastFlushBatchLen: w.lastLen,
+	}
+}
+
+// Flush writes every check queued so far, waiting until ctx expires.
+func (w *resultWriter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case w.flushRequests <- flushed:
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting checks and writes everything still queued, waiting until ctx expires.
+// The checks still queued then are dropped. Either way the writer has stopped when Close returns.
+func (w *resultWriter) Close(ctx context.Context) error {
+	w.closeOnce.Do(func() { close(w.stopping) })
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+	}
+	failed := w.failed.Load()
+	w.abort()
+	<-w.done
+	return fmt.Errorf("%d check results were not written: %w", w.failed.Load()-failed, ctx.Err())
+}
+
+// WriterMetrics returns the metrics of the result writer.
+func (s *Service) WriterMetrics() WriterMetrics {
+	return s.writer.metrics()
+}
@@ -0,0 +1,41 @@
+package monitor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingStore is a store whose writes block until their context is cancelled.
+type blockingStore struct {
+	Store
+	writing atomic.Int64
+}
+
+func (s *blockingStore) SaveChecks(ctx context.Context, checks []CheckRecord) error {
+	s.writing.Add(1)
+	defer s.writing.Add(-1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestResultWriterCloseStopsWriting(t *testing.T) {
+	store := &blockingStore{}
+	w := newResultWriter(store, 1, time.Hour, 10)
+	for i := 0; i < 3; i++ {
+		w.enqueue(CheckRecord{Slug: "prod", Name: "api"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Close(ctx); err == nil {
+		t.Fatal("Close succeeded while the store was blocked")
+	}
+	if n := store.writing.Load(); n != 0 {
+		t.Errorf("%d writes still in progress after Close", n)
+	}
+	if m := w.metrics(); m.ChecksFailed != 3 || m.ChecksWritten != 0 || m.QueueDepth != 0 {
+		t.Errorf("metrics = %+v, want 3 failed checks and an empty queue", m)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"guptime/monitor"
+)
+
+// errChangesPending is returned by plan when applying the declared monitors would change
+// something, so that it exits with exitChangesPending.
+var errChangesPending = errors.New("changes are pending")
+
+// exitChangesPending is the exit status of plan when changes are pending, as for
+// 'terraform plan -detailed-exitcode'.
+const exitChangesPending = 2
+
+// runPlan implements the 'guptime plan' subcommand:
+//
+//	guptime plan [-server url] [-prune] -f <path>
+//
+// It prints how applying the monitors declared at path would change the monitors managed through
+// the API of a running instance, without changing anything, and returns errChangesPending if it
+// would change any.
+func runPlan(config *Config, args []string) error {
+	return runDeclared("plan", config, args)
+}
+
+// runApply implements the 'guptime apply' subcommand:
+//
+//	guptime apply [-server url] [-prune] -f <path>
+//
+// It makes the monitors managed through the API of a running instance match the ones declared at
+// path in one change, and prints what was changed.
+func runApply(config *Config, args []string) error {
+	return runDeclared("apply", config, args)
+}
+
+// runDeclared reads the declared monitors and sends them to the running instance, as a dry run
+// for plan. The instance's admin token is read from GUPTIME_TOKEN, or else ADMIN_TOKEN.
+func runDeclared(command string, config *Config, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	path := flags.String("f", "", "monitors file or directory to "+command+", in JSON, YAML or TOML")
+	server := flags.String("server", config.ServerURL, "URL of the running guptime instance")
+	prune := flags.Bool("prune", false, "delete monitors managed through the API that are not declared")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: guptime %s [-server url] [-prune] -f <path>\n", command)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *path == "" || flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	monitors, err := monitor.ReadMonitors(*path)
+	var problems monitor.ConfigErrors
+	if errors.As(err, &problems) {
+		for _, p := range problems {
+			fmt.Println(p.Error())
+		}
+		return fmt.Errorf("%s is invalid", *path)
+	}
+	if err != nil {
+		return err
+	}
+
+	plan, err := requestPlan(*server, config.ServerToken, monitors, *prune, command == "plan")
+	if err != nil {
+		return err
+	}
+	printPlan(os.Stdout, plan)
+	if !plan.Applied && !plan.IsEmpty() {
+		return errChangesPending
+	}
+	return nil
+}
+
+// requestPlan sends the declared monitors to the apply endpoint of the instance at server, with
+// token as the bearer token.
+func requestPlan(server, token string, monitors []monitor.Monitor, prune, dryRun bool) (*monitor.MonitorPlan, error) {
+	body, err := json.Marshal(monitors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode monitors: %w", err)
+	}
+	query := url.Values{}
+	query.Set("prune", fmt.Sprint(prune))
+	query.Set("dry_run", fmt.Sprint(dryRun))
+	endpoint := strings.TrimSuffix(server, "/") + "/api/v1/monitors/apply?" + query.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the request to %s: %w", server, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", server, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response of %s: %w", server, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error    string               `json:"error"`
+			Problems monitor.ConfigErrors `json:"problems"`
+		}
+		if err := json.Unmarshal(data, &failure); err != nil || failure.Error == "" {
+			return nil, fmt.Errorf("%s responded with %s", server, resp.Status)
+		}
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("%s refused the request: %s; set GUPTIME_TOKEN to its admin token", server, failure.Error)
+		}
+		for _, p := range failure.Problems {
+			fmt.Println(p.Error())
+		}
+		if len(failure.Problems) > 0 {
+			return nil, fmt.Errorf("%s rejected the monitors", server)
+		}
+		return nil, fmt.Errorf("%s rejected the monitors: %s", server, failure.Error)
+	}
+
+	var plan monitor.MonitorPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode the response of %s: %w", server, err)
+	}
+	return &plan, nil
+}
+
+// printPlan writes a plan as a list of monitors to add (+), change (~) and remove (-), with the
+// old and new value of every changed setting.
+func printPlan(w io.Writer, plan *monitor.MonitorPlan) {
+	for _, m := range plan.Add {
+		fmt.Fprintf(w, "+ %s/%s\n", m.Slug, m.Name)
+	}
+	for _, c := range plan.Change {
+		name := c.After.Slug + "/" + c.After.Name
+		if before := c.Before.Slug + "/" + c.Before.Name; before != name {
+			name = before + " -> " + name
+		}
+		fmt.Fprintf(w, "~ %s\n", name)
+		for _, field := range c.Fields {
+			before, after := settingValue(c.Before, field), settingValue(c.After, field)
+			if before == after {
+				// Header values are redacted, so only the fact that they changed is known.
+				fmt.Fprintf(w, "    %s: changed\n", field)
+				continue
+			}
+			fmt.Fprintf(w, "    %s: %s -> %s\n", field, before, after)
+		}
+	}
+	for _, m := range plan.Remove {
+		fmt.Fprintf(w, "- %s/%s\n", m.Slug, m.Name)
+	}
+	for _, m := range plan.Undeclared {
+		fmt.Fprintf(w, "  %s/%s is not declared and is kept; use -prune to delete it\n", m.Slug, m.Name)
+	}
+
+	if plan.IsEmpty() {
+		fmt.Fprintf(w, "No changes: %d monitors are up to date.\n", plan.Unchanged)
+		return
+	}
+	if plan.Applied {
+		fmt.Fprintf(w, "Applied: %d added, %d changed, %d removed, %d unchanged.\n",
+			len(plan.Add), len(plan.Change), len(plan.Remove), plan.Unchanged)
+		return
+	}
+	fmt.Fprintf(w, "Plan: %d to add, %d to change, %d to remove, %d unchanged.\n",
+		len(plan.Add), len(plan.Change), len(plan.Remove), plan.Unchanged)
+}
+
+// settingValue formats a setting of a monitor, such as "interval" or "headers.Authorization", as
+// JSON, or "(none)" if it is not set.
+func settingValue(m monitor.Monitor, field string) string {
+	var values map[string]interface{}
+	encoded, _ := json.Marshal(m)
+	json.Unmarshal(encoded, &values)
+
+	key, sub, nested := strings.Cut(field, ".")
+	value, ok := values[key]
+	if nested {
+		object, _ := value.(map[string]interface{})
+		value, ok = object[sub]
+	}
+	if !ok {
+		return "(none)"
+	}
+	formatted, _ := json.Marshal(value)
+	return string(formatted)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"guptime/monitor"
+)
+
+func TestRunDeclaredExitCode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitors.yaml")
+	if err := os.WriteFile(path, []byte("- { slug: prod, name: api, url: \"https://api.example.com/\" }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	api := monitor.Monitor{Slug: "prod", Name: "api", URL: "https://api.example.com/"}
+	tests := []struct {
+		name       string
+		command    func(*Config, []string) error
+		status     int
+		plan       monitor.MonitorPlan
+		wantDryRun string
+		wantErr    error
+		wantFail   bool
+	}{
+		{"plan with changes", runPlan, http.StatusOK, monitor.MonitorPlan{Add: []monitor.Monitor{api}}, "true", errChangesPending, false},
+		{"plan with only undeclared monitors", runPlan, http.StatusOK, monitor.MonitorPlan{Undeclared: []monitor.Monitor{api}, Unchanged: 1}, "true", nil, false},
+		{"plan without changes", runPlan, http.StatusOK, monitor.MonitorPlan{Unchanged: 1}, "true", nil, false},
+		{"apply", runApply, http.StatusOK, monitor.MonitorPlan{Add: []monitor.Monitor{api}, Applied: true}, "false", nil, false},
+		{"rejected", runPlan, http.StatusConflict, monitor.MonitorPlan{}, "true", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dryRun string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/monitors/apply" || r.Header.Get("Authorization") != "Bearer secret" {
+					http.Error(w, `{"error": "unexpected request"}`, http.StatusBadRequest)
+					return
+				}
+				dryRun = r.URL.Query().Get("dry_run")
+				w.WriteHeader(tt.status)
+				if tt.status != http.StatusOK {
+					json.NewEncoder(w).Encode(map[string]string{"error": "monitor is read-only"})
+					return
+				}
+				json.NewEncoder(w).Encode(tt.plan)
+			}))
+			defer server.Close()
+
+			config := &Config{ServerURL: server.URL, ServerToken: "secret"}
+			err := tt.command(config, []string{"-f", path})
+			if tt.wantFail {
+				if err == nil || errors.Is(err, errChangesPending) {
+					t.Errorf("error = %v, want a failure", err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if dryRun != tt.wantDryRun {
+				t.Errorf("dry_run = %q, want %q", dryRun, tt.wantDryRun)
+			}
+		})
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	plan := &monitor.MonitorPlan{
+		Add: []monitor.Monitor{{Slug: "prod", Name: "cache"}},
+		Change: []monitor.MonitorChange{{
+			Before: monitor.Monitor{Slug: "prod", Name: "login", Interval: monitor.Duration(time.Minute), Headers: map[string]string{"Authorization": "<redacted>"}},
+			After:  monitor.Monitor{Slug: "prod", Name: "auth", Headers: map[string]string{"Authorization": "<redacted>"}},
+			Fields: []string{"headers.Authorization", "interval", "name"},
+		}},
+		Remove:     []monitor.Monitor{{Slug: "prod", Name: "old"}},
+		Undeclared: []monitor.Monitor{},
+		Unchanged:  2,
+	}
+	var out bytes.Buffer
+	printPlan(&out, plan)
+	want := `+ prod/cache
+~ prod/login -> prod/auth
+    headers.Authorization: changed
+    interval: "1m0s" -> (none)
+    name: "login" -> "auth"
+- prod/old
+Plan: 1 to add, 1 to change, 1 to remove, 2 unchanged.
+`
+	if out.String() != want {
+		t.Errorf("printPlan wrote:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"guptime/monitor"
+)
+
+// runValidate implements the 'guptime validate' subcommand:
+//
+//	guptime validate [path]
+//
+// It checks the monitors configuration at path, MONITORS_CONFIG by default, without starting the
+// service, and lists every problem with its file and line.
+func runValidate(config *Config, args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: guptime validate [path]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path := config.MonitorsConfig
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	monitors, err := monitor.ValidateConfig(path, config.RetentionPolicy())
+	var problems monitor.ConfigErrors
+	if errors.As(err, &problems) {
+		for _, p := range problems {
+			fmt.Println(p.Error())
+		}
+		return fmt.Errorf("%s is invalid", path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid: %d monitors.\n", path, len(monitors))
+	return nil
+}